@@ -2,78 +2,65 @@ package client
 
 import (
 	"bufio"
-	"encoding/gob"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/iocat/rutgers-cs352/pa1/codec"
 	"github.com/iocat/rutgers-cs352/pa1/command"
 	"github.com/iocat/rutgers-cs352/pa1/model/color"
 	"github.com/iocat/rutgers-cs352/pa1/result"
 )
 
-const (
-	userPrompt     = ""
-	nameCommand    = "@name"
-	privateCommand = "@private"
-	endCommand     = "@end"
-	whoCommand     = "@who"
-	exitCommand    = "@exit"
-)
-
-func deleteEmpty(ss []string) []string {
-	res := []string{}
-	for _, s := range ss {
-		if len(s) != 0 {
-			res = append(res, s)
-		}
-	}
-	return res
-}
+const userPrompt = ""
 
 var (
 	colorGreen  = color.New(color.DisplayStandout, color.FgGreen, color.BgBlack)
 	brightGreen = color.New(color.DisplayBold, color.FgGreen, color.BgBlack)
 	colorRed    = color.New(color.DisplayStandout, color.FgRed, color.BgBlack)
 	brightRed   = color.New(color.DisplayBold, color.FgRed, color.BgBlack)
+	timeColor   = color.New(color.DisplayFaint, color.FgWhite, color.BgBlack)
+	// mentionColor highlights the messages that mention the user
+	mentionColor = color.New(color.DisplayInverted, color.FgYellow, color.BgBlack)
 )
 
-func parseCommand(processed string) *command.Command {
-	var com = &command.Command{}
-	if strings.HasPrefix(processed, privateCommand) {
-		com = command.New(command.Private,
-			deleteEmpty(strings.Split(strings.TrimLeft(processed, privateCommand), " ")))
-	} else if strings.HasPrefix(processed, endCommand) {
-		com = command.New(command.End,
-			deleteEmpty(strings.Split(strings.TrimLeft(processed, endCommand), " ")))
-	} else if strings.HasPrefix(processed, whoCommand) {
-		com = command.New(command.Who, nil)
-	} else if strings.HasPrefix(processed, exitCommand) {
-		com = command.New(command.Exit, nil)
-	} else if strings.HasPrefix(processed, nameCommand) {
-		com = command.New(command.Create,
-			deleteEmpty(strings.Split(strings.TrimLeft(processed, nameCommand), " ")))
-	} else {
-		com = command.New(command.Send, []string{processed})
-	}
-	return com
-}
-
 // Client represents a client that actively communicates with the server
 type Client struct {
-	conn     net.Conn
-	encoder  *gob.Encoder
-	decoder  *gob.Decoder
+	// conn and codec are replaced when the client reconnects
+	conn   net.Conn
+	codec  codec.Codec
+	connMu sync.Mutex
+	// dial reconnects to the server, the client stops when the
+	// connection is lost if it is nil
+	dial Dialer
+	// username and token are only accessed by listenForResults, the
+	// token resumes the session once the connection is lost
 	username string
+	token    string
 	scanner  *bufio.Scanner
-	wg       sync.WaitGroup
+	// sendMu keeps the inputs and the sidebar from sending at once
+	sendMu sync.Mutex
+	// ui is the full-screen interface, the client reads and prints lines
+	// if it is nil. out and errs print the results and the errors
+	ui   *tui
+	out  io.Writer
+	errs io.Writer
+	// whoPending counts the @who sent to refresh the sidebar, whoAgain
+	// sends another one once they are answered
+	whoMu      sync.Mutex
+	whoPending int
+	whoAgain   bool
+	wg         sync.WaitGroup
 	// done channel notifies the client to stop listening on the socket and end
 	// programs
-	done chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 // listenForResults actively listen for incoming data from the socket
@@ -85,11 +72,19 @@ forloop:
 		select {
 		case <-c.done:
 			// Close the stdin
-			_ = os.Stdin.Close()
+			if c.ui != nil {
+				c.ui.stopInput()
+			} else {
+				_ = os.Stdin.Close()
+			}
 			break forloop
 		default:
 			var res = new(result.Result)
-			if err := c.decoder.Decode(&res); err != nil {
+			_, cod := c.connection()
+			if err := cod.Decode(&res); err != nil {
+				if c.dial != nil && c.reconnect() {
+					continue
+				}
 				c.handleCommunicationError("listen for results", err)
 				break forloop
 			}
@@ -107,80 +102,225 @@ forloop:
 		case <-c.done:
 			break forloop
 		default:
-			if c.scanner.Scan() {
-				// Get next line
-				processed := strings.Trim(c.scanner.Text(), " ")
-				if len(processed) == 0 {
-					// skip this command
-					fmt.Print(userPrompt)
+			line, ok := c.readLine()
+			if !ok {
+				if c.ui == nil {
 					break
 				}
-				com := parseCommand(processed)
-				if err := c.encoder.Encode(com); err != nil {
-					c.handleCommunicationError("send command error", err)
-					break forloop
+				// the user quit or the client is done
+				c.send(command.New(command.Exit, nil))
+				c.stop()
+				break forloop
+			}
+			// Get next line
+			processed := strings.Trim(line, " ")
+			if len(processed) == 0 {
+				// skip this command
+				c.prompt()
+				break
+			}
+			com, err := command.Parse(processed)
+			if err != nil {
+				fmt.Fprintln(c.errs, err)
+				c.prompt()
+				break
+			}
+			if err := c.send(com); err != nil {
+				if c.dial != nil {
+					// listenForResults reconnects
+					fmt.Fprintln(c.errs, "Not connected, the command was not sent.")
+					break
 				}
-				fmt.Print(userPrompt)
+				c.handleCommunicationError("send command error", err)
+				break forloop
 			}
+			if c.ui != nil && changesRoom(com.Ctype) {
+				c.refreshMembers()
+			}
+			c.prompt()
 		}
 	}
 	c.wg.Done()
 }
 
+// readLine reads the next line the user entered, ok is not set once
+// there is none
+func (c *Client) readLine() (line string, ok bool) {
+	if c.ui != nil {
+		line, err := c.ui.readLine()
+		return line, err == nil
+	}
+	if !c.scanner.Scan() {
+		return "", false
+	}
+	return c.scanner.Text(), true
+}
+
+// prompt prompts the user for the next line in the line mode
+func (c *Client) prompt() {
+	if c.ui == nil {
+		fmt.Print(userPrompt)
+	}
+}
+
+// send sends a command on the current connection
+func (c *Client) send(com *command.Command) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	_, cod := c.connection()
+	return cod.Encode(com)
+}
+
+// stop notifies the client to stop
+func (c *Client) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+}
+
 // handleResult interprets the result and conduct some operation
 func (c *Client) handleResult(res *result.Result) {
 	switch res.Rtype {
 	case result.Success:
+		if room, members, ok := parseWho(res.Message); ok && c.ui != nil {
+			c.ui.setMembers(room, members)
+			if c.membersAnswered() {
+				return
+			}
+		}
 		if len(res.Message) > 0 {
-			fmt.Printf("%sSERVER: %s\n%s", brightGreen.String(), res.Colorize(colorGreen), color.Reset.String())
+			fmt.Fprintf(c.out, "%sSERVER: %s\n%s", brightGreen.String(), res.Colorize(colorGreen), color.Reset.String())
 		}
 	case result.Message:
-		fmt.Println(res.Message)
+		if res.Author == "" && c.ui != nil {
+			// the notices tell who joined or left
+			c.refreshMembers()
+		}
+		if res.Mentioned {
+			// the bell rings in the terminal
+			fmt.Fprintf(c.out, "\a%s%s%s%s\n", timestamp(res), mentionColor.String(),
+				color.Strip(res.Message), color.Reset.String())
+			return
+		}
+		fmt.Fprintf(c.out, "%s%s\n", timestamp(res), res.Message)
+	case result.Edited:
+		fmt.Fprintf(c.out, "%s%sedited:%s %s\n", timestamp(res), timeColor.String(), color.Reset.String(), res.Message)
+	case result.Token:
+		c.token, c.username = res.Message, res.Author
+		if c.ui != nil {
+			c.ui.setUser(res.Author)
+			c.refreshMembers()
+		}
+	case result.File:
+		c.save(res)
+	case result.Deleted:
+		fmt.Fprintf(c.out, "%s%smessage deleted%s\n", timestamp(res), timeColor.String(), color.Reset.String())
 	case result.Failure:
-		fmt.Printf("%sSERVER ERROR: %s\n%s", brightRed.String(), res.Colorize(colorRed), color.Reset.String())
+		fmt.Fprintf(c.out, "%sSERVER ERROR: %s\n%s", brightRed.String(), res.Colorize(colorRed), color.Reset.String())
 	case result.Exit:
 		if len(res.Message) > 0 {
-			fmt.Printf("%sSERVER: %s\n%s", brightGreen.String(), res.Colorize(colorGreen), color.Reset.String())
+			fmt.Fprintf(c.out, "%sSERVER: %s\n%s", brightGreen.String(), res.Colorize(colorGreen), color.Reset.String())
 		}
-		close(c.done)
+		c.stop()
+	}
+}
+
+// save saves a file the server sent in the working directory, an
+// existing file is not overwritten
+func (c *Client) save(res *result.Result) {
+	name := filepath.Base(res.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		fmt.Fprintf(c.out, "%sERROR: the server sent a file without a name\n%s", brightRed.String(), color.Reset.String())
+		return
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		_, err = io.WriteString(file, res.Message)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(c.out, "%sERROR: save the file: %s\n%s", brightRed.String(), err, color.Reset.String())
+		return
+	}
+	fmt.Fprintf(c.out, "%sSaved %s (%d bytes)\n%s", brightGreen.String(), name, len(res.Message), color.Reset.String())
+}
+
+// timestamp renders the time of a chat message in local time and its ID,
+// the date is added to the messages of the previous days
+func timestamp(res *result.Result) string {
+	if res.Time.IsZero() {
+		return ""
+	}
+	local := res.Time.Local()
+	layout := "15:04"
+	if y, m, d := time.Now().Date(); local.Year() != y || local.Month() != m || local.Day() != d {
+		layout = "Jan 2 15:04"
 	}
+	return fmt.Sprintf("%s%s #%d%s ", timeColor.String(), local.Format(layout), res.ID, color.Reset.String())
 }
 
 func (c *Client) handleCommunicationError(logPrefix string, err error) {
-	defer close(c.done)
+	defer c.stop()
 	if err == io.EOF {
 		// Cleaning things up and close the connection
-		fmt.Println("Connection to server closed unexpectedly")
+		fmt.Fprintln(c.out, "Connection to server closed unexpectedly")
 		return
 	}
 	log.Printf("%s: %s", logPrefix, err)
 }
 
-// New creates a new Client
-func New(conn net.Conn, username string) (*Client, error) {
-
-	encoder := gob.NewEncoder(conn)
-	decoder := gob.NewDecoder(conn)
-	if err := encoder.Encode(
+// New creates a new Client that speaks the wire format of the codec
+func New(conn net.Conn, cod codec.Codec, username string) (*Client, error) {
+	if err := cod.Encode(
 		command.New(command.Create, []string{username})); err != nil {
 		return nil, err
 	}
 	return &Client{
 		conn:     conn,
 		username: username,
-		encoder:  encoder,
-		decoder:  decoder,
+		codec:    cod,
 		scanner:  bufio.NewScanner(os.Stdin),
+		out:      os.Stdout,
+		errs:     os.Stderr,
 		done:     make(chan struct{}),
 	}, nil
 }
 
+// UseTUI makes the client run the full-screen interface, it reports false
+// and the client keeps the line mode if the standard input or output is
+// not a terminal. It has to be called before Start
+func (c *Client) UseTUI() bool {
+	if !isTerminal(stdinFd) || !isTerminal(stdoutFd) {
+		return false
+	}
+	c.ui = newTUI()
+	return true
+}
+
 // Start starts a client
 // This method spawns 2 threads
 // + 1 that actively listens to server message
 // + 1 thread on another hand listens to user input and command
 func (c *Client) Start() {
-	defer c.conn.Close()
+	defer func() {
+		conn, _ := c.connection()
+		conn.Close()
+	}()
+	if c.ui != nil {
+		if err := c.ui.open(); err != nil {
+			fmt.Fprintf(os.Stderr, "Falling back to the line mode: %s\n", err)
+			c.ui = nil
+		} else {
+			c.out, c.errs = c.ui, c.ui
+			log.SetOutput(c.ui)
+			defer func() {
+				c.ui.close()
+				log.SetOutput(os.Stderr)
+			}()
+		}
+	}
 	c.wg.Add(2)
 	go c.listenForResults()
 	go c.listenForInputs()
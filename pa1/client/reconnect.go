@@ -0,0 +1,108 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/codec"
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+const (
+	// MinBackoff is the wait before the first attempt to reconnect
+	MinBackoff = time.Second
+	// MaxBackoff is the longest wait between two attempts to reconnect
+	MaxBackoff = 30 * time.Second
+)
+
+// Dialer opens a new connection to the server and picks its wire format
+type Dialer func() (net.Conn, codec.Codec, error)
+
+// NextBackoff doubles the wait between two attempts to connect, up to
+// MaxBackoff
+func NextBackoff(backoff time.Duration) time.Duration {
+	if backoff < MinBackoff {
+		return MinBackoff
+	}
+	if backoff *= 2; backoff > MaxBackoff {
+		return MaxBackoff
+	}
+	return backoff
+}
+
+// ReconnectWith makes the client reconnect with dial once the connection
+// is lost. The session is resumed with the token the server issued, the
+// client picks its username again if the session expired. It has to be
+// called before Start
+func (c *Client) ReconnectWith(dial Dialer) {
+	c.dial = dial
+}
+
+// connection returns the current connection and its codec
+func (c *Client) connection() (net.Conn, codec.Codec) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn, c.codec
+}
+
+func (c *Client) setConnection(conn net.Conn, cod codec.Codec) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.conn, c.codec = conn, cod
+}
+
+// reconnect dials until the session is resumed or a new one is created,
+// it reports false once the client is done
+func (c *Client) reconnect() bool {
+	var backoff time.Duration
+	for {
+		backoff = NextBackoff(backoff)
+		fmt.Fprintf(c.errs, "Connection to server lost, reconnecting in %s...\n", backoff)
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(backoff):
+		}
+		conn, cod, err := c.dial()
+		if err != nil {
+			continue
+		}
+		if err := c.resume(cod); err != nil {
+			conn.Close()
+			continue
+		}
+		old, _ := c.connection()
+		old.Close()
+		c.setConnection(conn, cod)
+		if c.ui != nil {
+			c.forgetMembers()
+			c.refreshMembers()
+		}
+		return true
+	}
+}
+
+// resume sends the handshake of a new connection. An expired session is
+// forgotten, the next connection picks the username again
+func (c *Client) resume(cod codec.Codec) error {
+	if c.token == "" {
+		return cod.Encode(command.New(command.Create, []string{c.username}))
+	}
+	if err := cod.Encode(command.New(command.Resume, []string{c.token})); err != nil {
+		return err
+	}
+	res := new(result.Result)
+	if err := cod.Decode(res); err != nil {
+		return err
+	}
+	if res.Rtype == result.Failure && strings.HasPrefix(res.Message, "resume:") {
+		c.token = ""
+		c.handleResult(res)
+		return fmt.Errorf("%s", res.Message)
+	}
+	c.handleResult(res)
+	return nil
+}
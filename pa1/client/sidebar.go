@@ -0,0 +1,81 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+)
+
+// parseWho reads the room and its members out of the result of @who,
+// ok is not set if the text is not such a result
+func parseWho(text string) (room string, members []string, ok bool) {
+	for _, line := range strings.Split(text, "\n") {
+		plain := color.Strip(line)
+		switch {
+		case !ok && plain == "":
+		case !ok:
+			if !strings.HasPrefix(plain, "Public #") {
+				return "", nil, false
+			}
+			room, ok = strings.TrimSuffix(strings.TrimPrefix(plain, "Public #"), ":"), true
+		case !strings.HasPrefix(plain, "\t"):
+			// the private sessions and the invites are not listed
+			return room, members, true
+		case !strings.HasPrefix(plain, "\t..."):
+			members = append(members, strings.TrimPrefix(line, "\t"))
+		}
+	}
+	return room, members, ok
+}
+
+// changesRoom checks whether the command takes the user to another room
+func changesRoom(ctype int) bool {
+	switch ctype {
+	case command.Join, command.Leave, command.Switch, command.Private, command.End, command.Accept:
+		return true
+	}
+	return false
+}
+
+// refreshMembers sends @who on its own to refresh the sidebar. Only one is
+// sent at a time, another one is sent once it is answered if the room
+// changed in the meantime
+func (c *Client) refreshMembers() {
+	c.whoMu.Lock()
+	if c.whoPending > 0 {
+		c.whoAgain = true
+		c.whoMu.Unlock()
+		return
+	}
+	c.whoPending++
+	c.whoMu.Unlock()
+	if err := c.send(command.New(command.Who, nil)); err != nil {
+		c.forgetMembers()
+	}
+}
+
+// membersAnswered is called with every result of @who, it reports whether
+// the client asked for it rather than the user
+func (c *Client) membersAnswered() bool {
+	c.whoMu.Lock()
+	if c.whoPending == 0 {
+		c.whoMu.Unlock()
+		return false
+	}
+	c.whoPending--
+	again := c.whoAgain
+	c.whoAgain = false
+	c.whoMu.Unlock()
+	if again {
+		c.refreshMembers()
+	}
+	return true
+}
+
+// forgetMembers forgets the @who that will not be answered
+func (c *Client) forgetMembers() {
+	c.whoMu.Lock()
+	defer c.whoMu.Unlock()
+	c.whoPending, c.whoAgain = 0, false
+}
@@ -0,0 +1,36 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package client
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("terminal: not supported on this platform")
+
+// termState is the state of a terminal before it was put in raw mode
+type termState struct{}
+
+// isTerminal reports false, the client falls back to the line mode
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errNoTerminal
+}
+
+func restore(fd int, state *termState) error {
+	return errNoTerminal
+}
+
+func openInput(fd int) (*os.File, error) {
+	return nil, errNoTerminal
+}
+
+func windowSize(fd int) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
+
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,624 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+)
+
+const (
+	stdinFd  = 0
+	stdoutFd = 1
+	// sidebarWidth is the width of the member sidebar, it is hidden on
+	// the terminals narrower than minPaneWidth plus the sidebar
+	sidebarWidth = 22
+	minPaneWidth = 40
+	// scrollback is the number of lines the message pane keeps
+	scrollback  = 1000
+	inputPrompt = "> "
+	tabStop     = 4
+)
+
+// errQuit is returned by readLine once the user pressed Ctrl-C, or Ctrl-D
+// on an empty line
+var errQuit = errors.New("the user quit")
+
+// the keys that are not characters
+const (
+	keyUnknown rune = -(iota + 1)
+	keyUp
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyPageUp
+	keyPageDown
+)
+
+// tui is the full-screen interface of the client: a status bar on top,
+// the messages with the members of the room on their right and the input
+// line at the bottom. The message pane scrolls with PgUp and PgDn, the
+// input line is edited with the usual keys, recalls the previous lines
+// with Up and Down and completes the words with Tab
+type tui struct {
+	in     *os.File
+	input  *bufio.Reader
+	out    io.Writer
+	state  *termState
+	resize chan os.Signal
+	closed chan struct{}
+
+	// mu guards the screen, the results and the inputs draw it from their
+	// own goroutines
+	mu            sync.Mutex
+	width, height int
+	// lines are the messages, scroll is the number of rows the pane is
+	// scrolled up by
+	lines  []string
+	scroll int
+	bell   bool
+	// room, user and members are shown in the status bar and the sidebar
+	room    string
+	user    string
+	members []string
+	// line is the input line, recall is the index of the history entry
+	// it shows and draft the line that was typed before recalling
+	line    []rune
+	cursor  int
+	history []string
+	recall  int
+	draft   []rune
+}
+
+func newTUI() *tui {
+	return &tui{
+		out:    os.Stdout,
+		resize: make(chan os.Signal, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+// open puts the terminal in raw mode and switches to the alternate screen
+func (t *tui) open() error {
+	in, err := openInput(stdinFd)
+	if err != nil {
+		return err
+	}
+	state, err := makeRaw(stdinFd)
+	if err != nil {
+		in.Close()
+		return err
+	}
+	t.in, t.input, t.state = in, bufio.NewReader(in), state
+	notifyResize(t.resize)
+	go t.watchResize()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.width, t.height = t.size()
+	io.WriteString(t.out, "\x1b[?1049h")
+	t.draw()
+	return nil
+}
+
+// close gives the terminal back in the state it was found in, the last
+// message is printed again as the alternate screen is gone
+func (t *tui) close() {
+	signal.Stop(t.resize)
+	close(t.closed)
+	t.in.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.out, "\x1b[?25h\x1b[?1049l")
+	restore(stdinFd, t.state)
+	if len(t.lines) > 0 {
+		fmt.Fprintf(t.out, "%s%s\n", t.lines[len(t.lines)-1], color.Reset.String())
+	}
+}
+
+// stopInput makes a pending readLine return
+func (t *tui) stopInput() {
+	t.in.Close()
+}
+
+func (t *tui) watchResize() {
+	for {
+		select {
+		case <-t.resize:
+			t.mu.Lock()
+			t.width, t.height = t.size()
+			t.draw()
+			t.mu.Unlock()
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// size returns the size of the terminal, or the usual 80x24 if unknown
+func (t *tui) size() (width, height int) {
+	width, height, err := windowSize(stdoutFd)
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Write adds the lines of text to the message pane, the text keeps its
+// colors across the lines. A bell rings the terminal
+func (t *tui) Write(p []byte) (int, error) {
+	text := string(p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(text)
+	t.draw()
+	return len(p), nil
+}
+
+// add adds the lines of text to the message pane, mu is held
+func (t *tui) add(text string) {
+	if strings.Contains(text, "\a") {
+		t.bell = true
+		text = strings.Replace(text, "\a", "", -1)
+	}
+	lines := strings.Split(text, "\n")
+	if color.Strip(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var active string
+	for _, line := range lines {
+		line = active + line
+		active = sgrAfter(active, line)
+		if t.scroll > 0 {
+			// the pane stays where the user scrolled to
+			t.scroll += len(wrap(line, t.paneWidth()))
+		}
+		t.lines = append(t.lines, line)
+	}
+	if len(t.lines) > scrollback {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-scrollback:]...)
+	}
+}
+
+func (t *tui) setUser(user string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.user = user
+	t.draw()
+}
+
+func (t *tui) setMembers(room string, members []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.room, t.members = room, members
+	t.draw()
+}
+
+// paneWidth is the width of the message pane, the sidebar takes the rest
+func (t *tui) paneWidth() int {
+	if t.width < minPaneWidth+sidebarWidth {
+		return t.width
+	}
+	return t.width - sidebarWidth
+}
+
+// paneRows returns the rows of the message pane that are shown
+func (t *tui) paneRows(width, height int) []string {
+	var rows []string
+	for i := len(t.lines) - 1; i >= 0 && len(rows) < height+t.scroll; i-- {
+		rows = append(wrap(t.lines[i], width), rows...)
+	}
+	if top := len(rows) - height; t.scroll > top {
+		t.scroll = top
+		if t.scroll < 0 {
+			t.scroll = 0
+		}
+	}
+	end := len(rows) - t.scroll
+	start := end - height
+	if start < 0 {
+		start = 0
+	}
+	return rows[start:end]
+}
+
+// draw redraws the whole screen, mu is held
+func (t *tui) draw() {
+	var b bytes.Buffer
+	b.WriteString("\x1b[?25l")
+	if t.bell {
+		b.WriteString("\a")
+		t.bell = false
+	}
+	paneHeight := t.height - 2
+	if paneHeight < 1 {
+		paneHeight = 1
+	}
+
+	status := fmt.Sprintf(" #%s  %s", t.room, t.user)
+	if t.room == "" {
+		status = fmt.Sprintf(" %s", t.user)
+	}
+	if t.scroll > 0 {
+		status += "  [scrolled up, PgDn for the newer messages]"
+	}
+	fmt.Fprintf(&b, "\x1b[1;1H\x1b[2K\x1b[7m%s\x1b[0m", pad(status, t.width))
+
+	pane := t.paneWidth()
+	rows := t.paneRows(pane, paneHeight)
+	blank := paneHeight - len(rows)
+	for i := 0; i < paneHeight; i++ {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K", i+2)
+		if i >= blank {
+			b.WriteString(rows[i-blank])
+		}
+		if pane < t.width {
+			fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[0m│", i+2, pane+1)
+			if i < len(t.members) {
+				b.WriteString(" " + wrap(t.members[i], t.width-pane-2)[0])
+			}
+		}
+	}
+
+	visible := t.width - len(inputPrompt) - 1
+	if visible < 1 {
+		visible = 1
+	}
+	start := 0
+	if t.cursor > visible {
+		start = t.cursor - visible
+	}
+	end := start + visible
+	if end > len(t.line) {
+		end = len(t.line)
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K\x1b[0m%s%s", paneHeight+2, inputPrompt, string(t.line[start:end]))
+	fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[?25h", paneHeight+2, len(inputPrompt)+t.cursor-start+1)
+	t.out.Write(b.Bytes())
+}
+
+// readLine reads the keys until the user enters a line, the screen is
+// redrawn after every key
+func (t *tui) readLine() (string, error) {
+	for {
+		key, err := t.readKey()
+		if err != nil {
+			return "", err
+		}
+		t.mu.Lock()
+		line, entered, err := t.edit(key)
+		t.draw()
+		t.mu.Unlock()
+		if entered || err != nil {
+			return line, err
+		}
+	}
+}
+
+// readKey reads a character or one of the keys that send an escape
+// sequence
+func (t *tui) readKey() (rune, error) {
+	r, _, err := t.input.ReadRune()
+	if err != nil || r != 0x1b {
+		return r, err
+	}
+	if r, _, err = t.input.ReadRune(); err != nil {
+		return 0, err
+	} else if r != '[' && r != 'O' {
+		return keyUnknown, nil
+	}
+	// the parameters of the sequence up to its final byte
+	var params []rune
+	for {
+		if r, _, err = t.input.ReadRune(); err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params = append(params, r)
+	}
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		case "5":
+			return keyPageUp, nil
+		case "6":
+			return keyPageDown, nil
+		}
+	}
+	return keyUnknown, nil
+}
+
+// edit applies a key to the input line, entered is set once the user
+// entered the line. mu is held
+func (t *tui) edit(key rune) (line string, entered bool, err error) {
+	switch key {
+	case '\r', '\n':
+		line = string(t.line)
+		if strings.TrimSpace(line) != "" &&
+			(len(t.history) == 0 || t.history[len(t.history)-1] != line) {
+			t.history = append(t.history, line)
+		}
+		t.line, t.cursor, t.draft, t.scroll = nil, 0, nil, 0
+		t.recall = len(t.history)
+		return line, true, nil
+	case 0x03: // Ctrl-C
+		return "", false, errQuit
+	case 0x04: // Ctrl-D
+		if len(t.line) == 0 {
+			return "", false, errQuit
+		}
+		t.deleteAt(t.cursor)
+	case 0x7f, 0x08: // Backspace
+		if t.cursor > 0 {
+			t.cursor--
+			t.deleteAt(t.cursor)
+		}
+	case keyDelete:
+		t.deleteAt(t.cursor)
+	case keyLeft, 0x02: // Ctrl-B
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case keyRight, 0x06: // Ctrl-F
+		if t.cursor < len(t.line) {
+			t.cursor++
+		}
+	case keyHome, 0x01: // Ctrl-A
+		t.cursor = 0
+	case keyEnd, 0x05: // Ctrl-E
+		t.cursor = len(t.line)
+	case 0x0b: // Ctrl-K
+		t.line = t.line[:t.cursor]
+	case 0x15: // Ctrl-U
+		t.line, t.cursor = t.line[t.cursor:], 0
+	case 0x17: // Ctrl-W
+		start := t.cursor
+		for start > 0 && t.line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && t.line[start-1] != ' ' {
+			start--
+		}
+		t.line = append(t.line[:start], t.line[t.cursor:]...)
+		t.cursor = start
+	case keyUp, 0x10: // Ctrl-P
+		t.recallHistory(-1)
+	case keyDown, 0x0e: // Ctrl-N
+		t.recallHistory(1)
+	case keyPageUp:
+		t.scroll += t.height / 2
+	case keyPageDown:
+		if t.scroll -= t.height / 2; t.scroll < 0 {
+			t.scroll = 0
+		}
+	case '\t':
+		t.complete()
+	case 0x0c: // Ctrl-L
+		t.width, t.height = t.size()
+	default:
+		if key >= ' ' && unicode.IsPrint(key) {
+			t.line = append(t.line[:t.cursor], append([]rune{key}, t.line[t.cursor:]...)...)
+			t.cursor++
+		}
+	}
+	return "", false, nil
+}
+
+func (t *tui) deleteAt(i int) {
+	if i < len(t.line) {
+		t.line = append(t.line[:i], t.line[i+1:]...)
+	}
+}
+
+// recallHistory shows the previous or the next line of the history, the
+// line being typed is kept as the newest one
+func (t *tui) recallHistory(step int) {
+	next := t.recall + step
+	if next < 0 || next > len(t.history) {
+		return
+	}
+	if t.recall == len(t.history) {
+		t.draft = t.line
+	}
+	t.recall = next
+	if next == len(t.history) {
+		t.line = t.draft
+	} else {
+		t.line = []rune(t.history[next])
+	}
+	t.cursor = len(t.line)
+}
+
+// complete completes the word before the cursor: the names of the
+// commands at the start of the line, the usernames of the room elsewhere.
+// The candidates are listed once they have nothing more in common
+func (t *tui) complete() {
+	start := t.cursor
+	for start > 0 && t.line[start-1] != ' ' {
+		start--
+	}
+	word := string(t.line[start:t.cursor])
+	var candidates []string
+	switch {
+	case start == 0 && strings.HasPrefix(word, command.Prefix):
+		candidates = command.Names()
+	case strings.HasPrefix(word, command.Prefix):
+		// a mention
+		for _, name := range t.usernames() {
+			candidates = append(candidates, command.Prefix+name)
+		}
+	default:
+		candidates = t.usernames()
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	completion := matches[0] + " "
+	if len(matches) > 1 {
+		if completion = commonPrefix(matches); completion == word {
+			t.add(strings.Join(matches, "  "))
+			return
+		}
+	}
+	line := append([]rune(nil), t.line[:start]...)
+	line = append(line, []rune(completion)...)
+	t.line = append(line, t.line[t.cursor:]...)
+	t.cursor = start + len([]rune(completion))
+}
+
+// usernames returns the names of the members of the room
+func (t *tui) usernames() []string {
+	var names []string
+	for _, member := range t.members {
+		if fields := strings.Fields(color.Strip(member)); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+// commonPrefix returns the longest prefix of the words
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// wrap breaks a line of text into rows of width columns. The color
+// escape codes take no room, every row ends with a reset and the next row
+// starts with the colors that were in effect. The other escape sequences
+// and control characters are dropped
+func wrap(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var (
+		rows   []string
+		row    bytes.Buffer
+		column int
+		active string
+	)
+	flush := func() {
+		row.WriteString(color.Reset.String())
+		rows = append(rows, row.String())
+		row.Reset()
+		row.WriteString(active)
+		column = 0
+	}
+	put := func(r rune) {
+		if column == width {
+			flush()
+		}
+		row.WriteRune(r)
+		column++
+	}
+	for i := 0; i < len(text); {
+		if code, n := escapeAt(text, i); n > 0 {
+			if strings.HasSuffix(code, "m") {
+				row.WriteString(code)
+				active = sgrAfter(active, code)
+			}
+			i += n
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(text[i:])
+		i += n
+		switch {
+		case r == '\n':
+			flush()
+		case r == '\t':
+			for put(' '); column%tabStop != 0; {
+				put(' ')
+			}
+		case unicode.IsPrint(r):
+			put(r)
+		}
+	}
+	flush()
+	return rows
+}
+
+// escapeAt returns the escape sequence that starts at i and its length
+func escapeAt(text string, i int) (string, int) {
+	if text[i] != 0x1b || i+1 >= len(text) || text[i+1] != '[' {
+		return "", 0
+	}
+	for j := i + 2; j < len(text); j++ {
+		if text[j] >= 0x40 && text[j] <= 0x7e {
+			return text[i : j+1], j + 1 - i
+		}
+	}
+	return text[i:], len(text) - i
+}
+
+// sgrAfter returns the color codes in effect once the text is shown after
+// the active ones. A code that starts with a reset replaces the others
+func sgrAfter(active, text string) string {
+	for i := 0; i < len(text); i++ {
+		code, n := escapeAt(text, i)
+		if n == 0 || !strings.HasSuffix(code, "m") {
+			continue
+		}
+		if params := code[2 : len(code)-1]; params == "" || params == "0" || strings.HasPrefix(params, "0;") {
+			active = code
+		} else {
+			active += code
+		}
+		i += n - 1
+	}
+	return active
+}
+
+// pad pads or cuts a text without colors to width columns
+func pad(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
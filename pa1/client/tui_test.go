@@ -0,0 +1,102 @@
+package client
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+)
+
+// TestWrap tests whether the lines are broken at the width of the pane
+// without counting the colors and whether the colors go on the next row
+func TestWrap(t *testing.T) {
+	red := "\x1b[0;31;40m"
+	rows := wrap(red+"hello world\tok", 5)
+	var plain []string
+	for _, row := range rows {
+		plain = append(plain, color.Strip(row))
+	}
+	if !reflect.DeepEqual(plain, []string{"hello", " worl", "d   o", "k"}) {
+		t.Errorf("unexpected rows %q", plain)
+	}
+	if rows[1][:len(red)] != red {
+		t.Errorf("the color was not carried on the next row: %q", rows[1])
+	}
+	if rows := wrap("a\x1b[2Jb", 10); color.Strip(rows[0]) != "ab" || len(rows) != 1 {
+		t.Errorf("the escape sequences that are not colors were kept: %q", rows)
+	}
+}
+
+// TestParseWho tests whether the members of the room are read out of the
+// result of @who
+func TestParseWho(t *testing.T) {
+	who := "\n" + color.Reset.String() + "Public #lobby:\n\talice (guest)\n\tbob (away)\n" +
+		"Private:\n\t...no one is talking behind your back.\n"
+	room, members, ok := parseWho(who)
+	if !ok || room != "lobby" || !reflect.DeepEqual(members, []string{"alice (guest)", "bob (away)"}) {
+		t.Errorf("unexpected room %q and members %q", room, members)
+	}
+	if _, _, ok := parseWho("You are now in #dev"); ok {
+		t.Error("a result that is not @who was parsed")
+	}
+}
+
+// TestEdit tests the editing keys and the history of the input line
+func TestEdit(t *testing.T) {
+	ui := &tui{out: ioutil.Discard, width: 80, height: 24}
+	enter := func(keys ...rune) string {
+		for _, key := range keys {
+			if line, entered, err := ui.edit(key); err != nil {
+				t.Fatal(err)
+			} else if entered {
+				return line
+			}
+		}
+		t.Fatal("the line was not entered")
+		return ""
+	}
+	if line := enter('h', 'e', 'l', 'o', keyLeft, 'l', keyEnd, '!', '\r'); line != "hello!" {
+		t.Errorf("expected hello!, got %q", line)
+	}
+	if line := enter('b', 'y', 'e', 0x17, 'a', 'b', keyHome, 0x0b, '\r'); line != "" {
+		t.Errorf("expected the line to be cleared, got %q", line)
+	}
+	enter('s', 'e', 'c', 'o', 'n', 'd', '\r')
+	if line := enter('x', keyUp, keyUp, keyDown, keyDown, '\r'); line != "x" {
+		t.Errorf("expected the draft to be recalled, got %q", line)
+	}
+	if line := enter(keyUp, keyUp, keyUp, 0x7f, '\r'); line != "hello" {
+		t.Errorf("expected the history to be recalled, got %q", line)
+	}
+	if _, _, err := ui.edit(0x03); err != errQuit {
+		t.Errorf("expected Ctrl-C to quit, got %v", err)
+	}
+}
+
+// TestComplete tests the completion of the commands, the mentions and
+// the usernames
+func TestComplete(t *testing.T) {
+	ui := &tui{out: ioutil.Discard, width: 80, height: 24,
+		members: []string{"\x1b[1;32;40malice\x1b[0;0;0m (guest)", "alfred", "bob (away)"}}
+	for _, test := range []struct {
+		typed, completed string
+	}{
+		{"@wh", "@wh"},
+		{"@whi", "@whisper "},
+		{"@who", "@who "},
+		{"hi @b", "hi @bob "},
+		{"@msg al", "@msg al"},
+		{"@msg ali", "@msg alice "},
+		{"@slow", "@slowmode "},
+	} {
+		ui.line, ui.cursor = []rune(test.typed), len([]rune(test.typed))
+		ui.edit('\t')
+		if string(ui.line) != test.completed {
+			t.Errorf("%q: expected %q, got %q", test.typed, test.completed, string(ui.line))
+		}
+	}
+	if last := ui.lines[len(ui.lines)-1]; last != "alice  alfred" {
+		t.Errorf("expected the candidates to be listed, got %q", last)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/server"
+)
+
+const usage = `Usage: %s [-socket path] command [arguments]
+
+Commands:
+  users                 list the users with their address and room
+  sessions              list the private sessions and their host
+  rooms                 list the rooms and their members
+  state                 dump the state of the server as JSON
+  broadcast text...     send a server notice to every user
+  kick user [reason...] sign a user out
+  limit n               change the number of users a room holds
+
+Flags:
+`
+
+var socket = flag.String("socket", "chat.sock", "The Unix socket the server was started with -admin")
+
+// admin talks to the admin interface of a running server
+type admin struct {
+	client *http.Client
+}
+
+func newAdmin(path string) *admin {
+	return &admin{client: &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+}
+
+// do sends the request body to the path, the answer is decoded into v
+func (a *admin) do(method, path string, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://admin"+path, reader)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reach the server: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&failure); err != nil || failure.Error == "" {
+			return fmt.Errorf("the server answered %s", res.Status)
+		}
+		return fmt.Errorf("%s", failure.Error)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// run runs the command and prints its result to out
+func run(a *admin, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given")
+	}
+	var done struct{}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	switch name, args := args[0], args[1:]; name {
+	case "users":
+		var users []server.UserState
+		if err := a.do(http.MethodGet, "/users", nil, &users); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "NAME\tADDRESS\tROOM\tSESSIONS\tSTATUS")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t#%s\t%s\t%s\n", u.Name, orDash(u.Address), u.Room,
+				orDash(strings.Join(u.Sessions, ",")), u.Status)
+		}
+	case "sessions":
+		var sessions []server.SessionState
+		if err := a.do(http.MethodGet, "/sessions", nil, &sessions); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "ROOM\tID\tHOST\tMEMBERS")
+		for _, s := range sessions {
+			fmt.Fprintf(w, "#%s\t%s\t%s\t%s\n", s.Room, s.ID, s.Host, strings.Join(s.Members, ","))
+		}
+	case "rooms":
+		var rooms []server.RoomState
+		if err := a.do(http.MethodGet, "/rooms", nil, &rooms); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "ROOM\tSEATS\tSLOW MODE\tSESSIONS\tMEMBERS")
+		for _, r := range rooms {
+			fmt.Fprintf(w, "#%s\t%d\t%s\t%d\t%s\n", r.Name, r.Seats, r.SlowMode, len(r.Sessions),
+				strings.Join(r.Members, ","))
+		}
+	case "state":
+		var state json.RawMessage
+		if err := a.do(http.MethodGet, "/state", nil, &state); err != nil {
+			return err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, state, "", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, indented.String())
+	case "broadcast":
+		if len(args) == 0 {
+			return fmt.Errorf("broadcast: please provide the text")
+		}
+		return a.do(http.MethodPost, "/broadcast", server.Broadcast{Text: strings.Join(args, " ")}, &done)
+	case "kick":
+		if len(args) == 0 {
+			return fmt.Errorf("kick: please provide a username")
+		}
+		return a.do(http.MethodPost, "/kick", server.Kick{User: args[0], Reason: strings.Join(args[1:], " ")}, &done)
+	case "limit":
+		if len(args) != 1 {
+			return fmt.Errorf("limit: please provide exactly one number")
+		}
+		limit, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("limit: %q is not a number", args[0])
+		}
+		return a.do(http.MethodPost, "/limit", server.Limit{Limit: limit}, &done)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func main() {
+	programName := os.Args[0]
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, programName)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(newAdmin(*socket), flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", programName, err)
+		os.Exit(1)
+	}
+}
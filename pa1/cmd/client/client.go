@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -9,10 +11,19 @@ import (
 	"time"
 
 	"github.com/iocat/rutgers-cs352/pa1/client"
+	"github.com/iocat/rutgers-cs352/pa1/codec"
 )
 
 var programName string
 
+var useJSON = flag.Bool("json", false, "Speak the JSON lines protocol instead of gob")
+var useTLS = flag.Bool("tls", false, "Connect to the server over TLS")
+var caFile = flag.String("ca", "", "The CA bundle that verifies the server, the system roots are used if empty")
+var certFile = flag.String("cert", "", "The client certificate, its common name is used as the username")
+var keyFile = flag.String("key", "", "The key of the client certificate")
+var insecure = flag.Bool("insecure", false, "Skip the verification of the server certificate, for testing only")
+var useTUI = flag.Bool("tui", true, "Run the full-screen interface, the plain line mode is used when stdout is not a terminal")
+
 func parseArgs(args []string) (programName, address string, port int,
 	username string, err error) {
 	var (
@@ -31,9 +42,17 @@ func parseArgs(args []string) (programName, address string, port int,
 	return
 }
 
-func connectThroughTCP(host string, port int) (net.Conn, error) {
-	address := fmt.Sprintf("%s:%d", host, port)
-	connection, err := net.Dial("tcp", address)
+func connectThroughTCP(host string, port int, config *tls.Config) (net.Conn, error) {
+	var (
+		address    = net.JoinHostPort(host, strconv.Itoa(port))
+		connection net.Conn
+		err        error
+	)
+	if config != nil {
+		connection, err = tls.Dial("tcp", address, config)
+	} else {
+		connection, err = net.Dial("tcp", address)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get connection: %v", err)
 	}
@@ -51,25 +70,49 @@ func main() {
 		err         error
 	)
 	// parse program parameters
-	programName, host, port, username, err = parseArgs(os.Args)
+	flag.Parse()
+	programName, host, port, username, err = parseArgs(append([]string{os.Args[0]}, flag.Args()...))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: parse error: %v\n", programName, err)
 		os.Exit(1)
 	}
+	var tlsConfig *tls.Config
+	if *useTLS || *caFile != "" || *certFile != "" || *insecure {
+		if tlsConfig, err = client.TLSConfig(*caFile, *certFile, *keyFile, *insecure); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", programName, err)
+			os.Exit(1)
+		}
+	}
 	// Set up TCP connection and connect to the server at the same time
-	conn, err = connectThroughTCP(host, port)
+	var backoff time.Duration
+	conn, err = connectThroughTCP(host, port, tlsConfig)
 	for err != nil {
+		backoff = client.NextBackoff(backoff)
 		fmt.Fprintf(os.Stderr, "%s: connect to server: %v\n", programName, err)
-		fmt.Fprintf(os.Stderr, "Reconnecting...\n")
-		<-time.NewTimer(3 * time.Second).C
-		conn, err = connectThroughTCP(host, port)
+		fmt.Fprintf(os.Stderr, "Reconnecting in %s...\n", backoff)
+		<-time.NewTimer(backoff).C
+		conn, err = connectThroughTCP(host, port, tlsConfig)
 	}
 
-	cli, err := client.New(conn, username)
+	format := codec.Gob
+	if *useJSON {
+		format = codec.JSON
+	}
+	cli, err := client.New(conn, codec.New(format, conn), username)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "create user on server: %s\n", err)
 		os.Exit(1)
 	}
+	cli.ReconnectWith(func() (net.Conn, codec.Codec, error) {
+		conn, err := connectThroughTCP(host, port, tlsConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, codec.New(format, conn), nil
+	})
+	if *useTUI {
+		cli.UseTUI()
+	}
 	cli.Start()
 
 }
@@ -1,32 +1,235 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/iocat/rutgers-cs352/pa1/model/account"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin/dicebot"
 	"github.com/iocat/rutgers-cs352/pa1/server"
 )
 
-func parseArgs(args []string) (programName, port string, err error) {
-	programName = args[0]
-	if len(args) < 2 {
-		err = errors.New("not enough argument: need a port number")
-		return
+// listFlag is a comma separated list of names
+type listFlag struct {
+	names *[]string
+}
+
+func (l listFlag) String() string {
+	if l.names == nil {
+		return ""
+	}
+	return strings.Join(*l.names, ",")
+}
+
+func (l listFlag) Set(value string) error {
+	*l.names = nil
+	if value != "" {
+		*l.names = strings.Split(value, ",")
+	}
+	return nil
+}
+
+// bindFlags makes every flag write its setting in cfg, the defaults are
+// the settings of cfg
+func bindFlags(fs *flag.FlagSet, cfg *server.Config) {
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "The address that serves the terminal clients")
+	fs.StringVar(&cfg.Web, "web", cfg.Web, "The address that serves the browser clients, e.g. localhost:8080")
+	fs.StringVar(&cfg.Admin, "admin", cfg.Admin, "The Unix socket of the admin interface chatctl uses, e.g. chat.sock")
+	fs.IntVar(&cfg.UserLimit, "user-limit", cfg.UserLimit, "The number of users a room holds")
+	fs.IntVar(&cfg.MaxUsername, "max-username", cfg.MaxUsername, "The longest username in bytes, 0 is no limit")
+	fs.IntVar(&cfg.MaxMessage, "max-message", cfg.MaxMessage, "The longest chat message in bytes, 0 is no limit")
+	fs.StringVar(&cfg.MOTD, "motd", cfg.MOTD, "The message of the day sent to the users once they picked a name")
+	fs.DurationVar(&cfg.IdleAfter.Duration, "idle-after", cfg.IdleAfter.Duration, "How long a user waits without sending a command before being away, 0 disables it")
+	fs.DurationVar(&cfg.ResumeGrace.Duration, "resume-grace", cfg.ResumeGrace.Duration, "How long the seat of a disconnected user is held for the client to resume, 0 signs the user out right away")
+	fs.DurationVar(&cfg.InviteExpiry.Duration, "invite-expiry", cfg.InviteExpiry.Duration, "How long an invite to a private session waits for an answer")
+	fs.DurationVar(&cfg.Countdown.Duration, "shutdown-countdown", cfg.Countdown.Duration, "How long the users are warned before the server shuts down on SIGINT or SIGTERM")
+	fs.Float64Var(&cfg.Flood.MessageRate, "message-rate", cfg.Flood.MessageRate, "The number of chat messages a user sends per second on average, 0 is no limit")
+	fs.IntVar(&cfg.Flood.MessageBurst, "message-burst", cfg.Flood.MessageBurst, "The number of chat messages a user sends at once")
+	fs.Float64Var(&cfg.Flood.CommandRate, "command-rate", cfg.Flood.CommandRate, "The number of commands a user sends per second on average, 0 is no limit")
+	fs.IntVar(&cfg.Flood.CommandBurst, "command-burst", cfg.Flood.CommandBurst, "The number of commands a user sends at once")
+	fs.IntVar(&cfg.Flood.Strikes, "flood-strikes", cfg.Flood.Strikes, "The number of refused commands within a minute that punishes a flooder, 0 never punishes")
+	fs.StringVar(&cfg.Flood.Action, "flood-action", cfg.Flood.Action, "What to do with a flooder: mute or disconnect")
+	fs.DurationVar(&cfg.Flood.MuteFor.Duration, "flood-mute", cfg.Flood.MuteFor.Duration, "How long a flooder is muted, 0 mutes until unmuted")
+	fs.StringVar(&cfg.History.Dir, "history", cfg.History.Dir, "The folder that keeps the room history, the history is kept in memory if empty")
+	fs.IntVar(&cfg.History.Size, "history-size", cfg.History.Size, "The number of messages kept per room")
+	fs.DurationVar(&cfg.History.Age.Duration, "history-age", cfg.History.Age.Duration, "How long messages are kept, 0 keeps them until the room is full")
+	fs.IntVar(&cfg.History.Replay, "replay", cfg.History.Replay, "The number of recent messages a new user receives")
+	fs.IntVar(&cfg.Queue.Size, "queue-size", cfg.Queue.Size, "The number of results queued for each client")
+	fs.StringVar(&cfg.Queue.Policy, "slow-policy", cfg.Queue.Policy, "What to do with a client whose queue is full: drop or disconnect")
+	fs.StringVar(&cfg.Accounts, "accounts", cfg.Accounts, "The file that keeps the registered users, the accounts are kept in memory if empty")
+	fs.StringVar(&cfg.Bans, "bans", cfg.Bans, "The file that keeps the bans, the bans are kept in memory if empty")
+	fs.StringVar(&cfg.Mailbox.File, "mailbox", cfg.Mailbox.File, "The file that keeps the messages of the offline registered users, they are kept in memory if empty")
+	fs.IntVar(&cfg.Mailbox.Size, "mailbox-size", cfg.Mailbox.Size, "The number of messages a mailbox holds")
+	fs.DurationVar(&cfg.Mailbox.Age.Duration, "mailbox-age", cfg.Mailbox.Age.Duration, "How long the messages wait in a mailbox, 0 keeps them until delivered")
+	fs.StringVar(&cfg.Owner, "owner", cfg.Owner, "The registered user that owns the server")
+	fs.Var(listFlag{&cfg.Moderators}, "moderators", "The comma separated registered users that moderate the server")
+	fs.Var(listFlag{&cfg.Bots}, "bots", "The comma separated bots the server runs, e.g. dicebot")
+	fs.StringVar(&cfg.TLS.Cert, "cert", cfg.TLS.Cert, "The server certificate, the server accepts TLS connections only if given")
+	fs.StringVar(&cfg.TLS.Key, "key", cfg.TLS.Key, "The key of the server certificate")
+	fs.StringVar(&cfg.TLS.ClientCA, "client-ca", cfg.TLS.ClientCA, "The CA bundle that verifies the client certificates")
+	fs.BoolVar(&cfg.TLS.RequireClientCert, "require-client-cert", cfg.TLS.RequireClientCert, "Refuse the clients without a valid certificate")
+}
+
+// configure reads the config file named by -config and the flags, the
+// flags given on the command line win over the file. A port given as the
+// only argument serves the terminal clients on localhost
+func configure(args []string) (server.Config, error) {
+	cfg := server.DefaultConfig()
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	path := fs.String("config", "", "The JSON config file, the flags win over it. SIGHUP reloads it")
+	bindFlags(fs, &cfg)
+	if err := fs.Parse(args[1:]); err != nil {
+		return cfg, err
+	}
+	if *path != "" {
+		cfg = server.DefaultConfig()
+		if err := server.LoadConfig(*path, &cfg); err != nil {
+			return cfg, err
+		}
+		// the flags are bound to cfg, parsing them again overrides the file
+		if err := fs.Parse(args[1:]); err != nil {
+			return cfg, err
+		}
+	}
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		cfg.Listen = fmt.Sprintf("localhost:%s", fs.Arg(0))
+	default:
+		return cfg, fmt.Errorf("too many arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return cfg, cfg.Validate()
+}
+
+// plugins creates the named bots
+func plugins(names []string) ([]plugin.Plugin, error) {
+	bots := []plugin.Plugin{}
+	for _, name := range names {
+		switch name {
+		case dicebot.Name:
+			bots = append(bots, dicebot.New(rand.NewSource(time.Now().UnixNano())))
+		default:
+			return nil, fmt.Errorf("unknown bot %q, the bots are %s", name, dicebot.Name)
+		}
+	}
+	return bots, nil
+}
+
+// reload applies the settings that can change while the server runs on
+// every SIGHUP, the others are logged and kept until the server restarts
+func reload(serv *server.Chat, cfg server.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := configure(os.Args)
+		if err != nil {
+			log.Printf("reload config: %s, the settings are unchanged", err)
+			continue
+		}
+		serv.Apply(next)
+		if changed := cfg.NeedsRestart(next); len(changed) > 0 {
+			log.Printf("reload config: restart the server to change %s", strings.Join(changed, ", "))
+		}
+		log.Printf("Config reloaded")
+	}
+}
+
+// shutdown shuts the server down on SIGINT or SIGTERM, a second signal
+// stops the server right away. stopped is closed once the users are gone
+func shutdown(serv *server.Chat, stopped chan<- struct{}) {
+	defer close(stopped)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	signal.Stop(stop)
+	log.Printf("Shutting down, press Ctrl-C again to stop right away")
+	ctx, cancel := context.WithTimeout(context.Background(), serv.Countdown()+server.DrainTimeout)
+	defer cancel()
+	if err := serv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %s", err)
 	}
-	port = args[1]
-	return
 }
 
 func main() {
-	program, port, err := parseArgs(os.Args)
+	program := os.Args[0]
+	cfg, err := configure(os.Args)
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		os.Exit(2)
+	}
+	queue, err := cfg.QueueConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
 		return
 	}
-	var serv = server.New("tcp", fmt.Sprintf("localhost:%s", port))
-	if err := serv.Start(); err != nil {
+	if cfg.History.Dir != "" {
+		if err := os.MkdirAll(cfg.History.Dir, 0700); err != nil {
+			log.Fatalf("create history folder: %s", err)
+		}
+	}
+	accounts, err := account.Open(cfg.Accounts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		return
+	}
+	box, err := mailbox.Open(cfg.Mailbox.File, cfg.MailboxLimits())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		return
+	}
+	mod, err := server.OpenModeration(cfg.Bans, cfg.Owner, cfg.Moderators)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		return
+	}
+	bots, err := plugins(cfg.Bots)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		return
+	}
+	var serv = server.New("tcp", cfg.Listen, cfg.HistoryConfig(), queue, accounts, mod, bots...)
+	serv.UseMailbox(box)
+	serv.Apply(cfg)
+	config, err := cfg.TLS.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", program, err)
+		return
+	} else if config != nil {
+		serv.UseTLS(config)
+	}
+	go reload(serv, cfg)
+	stopped := make(chan struct{})
+	go shutdown(serv, stopped)
+	if cfg.Web != "" {
+		go func() {
+			if err := serv.StartWeb(cfg.Web); err != nil && err != server.ErrServerClosed {
+				log.Println(err)
+			}
+		}()
+	}
+	if cfg.Admin != "" {
+		go func() {
+			if err := serv.StartAdmin(cfg.Admin); err != nil && err != server.ErrServerClosed {
+				log.Println(err)
+			}
+		}()
+	}
+	if err := serv.Start(); err != server.ErrServerClosed {
 		log.Println(err)
+		return
 	}
+	<-stopped
+	log.Printf("Server stopped")
 }
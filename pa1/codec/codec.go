@@ -0,0 +1,97 @@
+// Package codec encodes and decodes the commands and the results that
+// travel between the chat clients and the server. Two wire formats are
+// supported: encoding/gob and JSON lines. Both carry the same
+// command.Command and result.Result values, see doc/protocol.md
+package codec
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Version is the version of the protocol described in doc/protocol.md
+const Version = 1
+
+const (
+	// Gob is the name of the encoding/gob codec
+	Gob = "gob"
+	// JSON is the name of the JSON lines codec
+	JSON = "json"
+)
+
+// Codec reads and writes values of a connection
+type Codec interface {
+	Encode(v interface{}) error
+	Decode(v interface{}) error
+	// Name returns the name of the wire format
+	Name() string
+}
+
+type encoder interface {
+	Encode(v interface{}) error
+}
+
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+type codec struct {
+	encoder
+	decoder
+	name string
+}
+
+func (c *codec) Name() string {
+	return c.name
+}
+
+// NewGob creates a codec that speaks encoding/gob
+func NewGob(rw io.ReadWriter) Codec {
+	return newGob(rw, rw)
+}
+
+func newGob(r io.Reader, w io.Writer) Codec {
+	return &codec{
+		encoder: gob.NewEncoder(w),
+		decoder: gob.NewDecoder(r),
+		name:    Gob,
+	}
+}
+
+// NewJSON creates a codec that speaks JSON, one value per line
+func NewJSON(rw io.ReadWriter) Codec {
+	return newJSON(rw, rw)
+}
+
+func newJSON(r io.Reader, w io.Writer) Codec {
+	return &codec{
+		encoder: json.NewEncoder(w),
+		decoder: json.NewDecoder(r),
+		name:    JSON,
+	}
+}
+
+// New creates a codec by its name, gob is used for an unknown name
+func New(name string, rw io.ReadWriter) Codec {
+	if name == JSON {
+		return NewJSON(rw)
+	}
+	return NewGob(rw)
+}
+
+// Detect picks the codec the client speaks by peeking at the first byte
+// it sends: a JSON client starts with '{' whereas a gob stream starts
+// with the length of the command type definition
+func Detect(rw io.ReadWriter) (Codec, error) {
+	reader := bufio.NewReader(rw)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == '{' {
+		return newJSON(reader, rw), nil
+	}
+	return newGob(reader, rw), nil
+}
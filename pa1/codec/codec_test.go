@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// TestRoundTrip tests whether both codecs decode the commands and the
+// results they encoded
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{Gob, JSON} {
+		var buf bytes.Buffer
+		cod := New(name, &buf)
+		if cod.Name() != name {
+			t.Errorf("New(%q) created a %s codec", name, cod.Name())
+		}
+		com := command.New(command.Msg, []string{"bob", "hello there"})
+		res := result.New(result.Message, "alice: hi")
+		if err := cod.Encode(com); err != nil {
+			t.Fatalf("%s: encode the command: %s", name, err)
+		}
+		if err := cod.Encode(res); err != nil {
+			t.Fatalf("%s: encode the result: %s", name, err)
+		}
+		var gotCom command.Command
+		var gotRes result.Result
+		if err := cod.Decode(&gotCom); err != nil {
+			t.Fatalf("%s: decode the command: %s", name, err)
+		} else if !reflect.DeepEqual(&gotCom, com) {
+			t.Errorf("%s: decoded %+v, want %+v", name, gotCom, com)
+		}
+		if err := cod.Decode(&gotRes); err != nil {
+			t.Fatalf("%s: decode the result: %s", name, err)
+		} else if gotRes.Rtype != res.Rtype || gotRes.Message != res.Message {
+			t.Errorf("%s: decoded %+v, want %+v", name, gotRes, res)
+		}
+	}
+}
+
+// TestDetect tests whether the codec the client speaks is picked by its
+// first byte
+func TestDetect(t *testing.T) {
+	for _, name := range []string{Gob, JSON} {
+		var buf bytes.Buffer
+		com := command.New(command.Create, []string{"alice"})
+		if err := New(name, &buf).Encode(com); err != nil {
+			t.Fatal(err)
+		}
+		cod, err := Detect(&buf)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		} else if cod.Name() != name {
+			t.Errorf("detected %s for a %s client", cod.Name(), name)
+		}
+		var got command.Command
+		if err := cod.Decode(&got); err != nil {
+			t.Fatalf("%s: decode after the detection: %s", name, err)
+		} else if !reflect.DeepEqual(&got, com) {
+			t.Errorf("%s: decoded %+v, want %+v", name, got, com)
+		}
+	}
+	if _, err := Detect(&bytes.Buffer{}); err == nil {
+		t.Error("a connection closed before its first byte was detected")
+	}
+}
@@ -13,6 +13,58 @@ const (
 	Exit
 	// Create creates a new user
 	Create
+	// Join moves the user to a named room
+	Join
+	// Leave leaves the current room for the lobby
+	Leave
+	// Rooms lists the open rooms
+	Rooms
+	// Msg sends a direct message to one user
+	Msg
+	// History pages through older messages of the room
+	History
+	// Register creates an account and signs in with it
+	Register
+	// Login signs in with an account
+	Login
+	// Kick forces a user out of the server
+	Kick
+	// Ban bans a username or an IP address
+	Ban
+	// Unban lifts a ban
+	Unban
+	// Mute keeps a user from sending messages
+	Mute
+	// Unmute lets a muted user speak again
+	Unmute
+	// Accept accepts an invite to a private session
+	Accept
+	// Decline declines an invite to a private session
+	Decline
+	// Switch changes the conversation the user talks in
+	Switch
+	// Edit replaces the text of a message
+	Edit
+	// Delete deletes a message
+	Delete
+	// Reply answers a message
+	Reply
+	// Away marks the user away
+	Away
+	// Busy marks the user busy
+	Busy
+	// Back marks the user online again
+	Back
+	// Mentions lists the recent messages that mentioned the user
+	Mentions
+	// Resume resumes a session over a new connection
+	Resume
+	// SlowMode limits how often the users talk in the room
+	SlowMode
+	// Help explains the commands
+	Help
+	// Export sends the history of the room as a file
+	Export
 )
 
 const (
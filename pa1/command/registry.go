@@ -0,0 +1,260 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefix starts the commands the users type, a line that starts with it
+// twice is sent as chat without one of them
+const Prefix = "@"
+
+// Args tells how the text that follows the name of a command is split
+// into its arguments
+type Args int
+
+const (
+	// NoArgs ignores the text
+	NoArgs Args = iota
+	// Words splits the text at the spaces
+	Words
+	// Text keeps the text as a single argument, it is left out if empty
+	Text
+	// WordAndText takes the first word and keeps the rest of the text as a
+	// single argument
+	WordAndText
+)
+
+func (args Args) String() string {
+	switch args {
+	case Words:
+		return "words"
+	case Text:
+		return "text"
+	case WordAndText:
+		return "word and text"
+	}
+	return "none"
+}
+
+// split splits the text into arguments
+func (args Args) split(text string) []string {
+	text = strings.TrimSpace(text)
+	switch {
+	case args == NoArgs:
+		return nil
+	case args == Words:
+		return strings.Fields(text)
+	case len(text) == 0:
+		return []string{}
+	case args == Text:
+		return []string{text}
+	}
+	parts := strings.SplitN(text, " ", 2)
+	if len(parts) == 2 {
+		parts[1] = strings.TrimLeft(parts[1], " ")
+	}
+	return parts
+}
+
+// Spec declares a command the users type
+type Spec struct {
+	Ctype int
+	// Name is typed after the prefix, the aliases are typed alike
+	Name    string
+	Aliases []string
+	Args    Args
+	// MinArgs and MaxArgs bound the number of arguments, MaxArgs is Many
+	// when the command takes any number of them
+	MinArgs, MaxArgs int
+	// Usage names the arguments in the help, the optional ones are in
+	// brackets
+	Usage string
+	Help  string
+}
+
+// Many is the MaxArgs of the commands that take any number of arguments
+const Many = -1
+
+// Check tells whether the arguments of a command received from a client
+// fit its declaration
+func (spec Spec) Check(args []string) error {
+	if len(args) < spec.MinArgs || (spec.MaxArgs != Many && len(args) > spec.MaxArgs) {
+		return fmt.Errorf("%s: usage %s", spec.Name, spec.Syntax())
+	}
+	return nil
+}
+
+// Syntax returns the way the command is typed
+func (spec Spec) Syntax() string {
+	if spec.Usage == "" {
+		return Prefix + spec.Name
+	}
+	return Prefix + spec.Name + " " + spec.Usage
+}
+
+// specs are the commands the users type, in the order @help lists them.
+// Send is any other line and Resume is only sent by the clients
+var specs = []Spec{
+	{Ctype: Create, Name: "name", Aliases: []string{"nick"}, Args: Words, MaxArgs: 1, Usage: "name",
+		Help: "Picks a guest username and enters the lobby."},
+	{Ctype: Register, Name: "register", Args: Words, MinArgs: 2, MaxArgs: 2, Usage: "name password",
+		Help: "Creates an account, signs in with it and enters the lobby."},
+	{Ctype: Login, Name: "login", Args: Words, MinArgs: 2, MaxArgs: 2, Usage: "name password",
+		Help: "Signs in with an account and enters the lobby."},
+	{Ctype: Who, Name: "who", Args: NoArgs,
+		Help: "Lists the users of the room, your private sessions and your invites."},
+	{Ctype: Rooms, Name: "rooms", Args: NoArgs,
+		Help: "Lists the open rooms."},
+	{Ctype: Join, Name: "join", Args: Words, MinArgs: 1, MaxArgs: 1, Usage: "room",
+		Help: "Moves to a room, the room is created if needed."},
+	{Ctype: Leave, Name: "leave", Args: Words, MaxArgs: 1, Usage: "[room]",
+		Help: "Leaves the current room for the lobby."},
+	{Ctype: Msg, Name: "msg", Aliases: []string{"dm", "whisper"}, Args: WordAndText, MinArgs: 2, MaxArgs: 2, Usage: "name text",
+		Help: "Sends a direct message to one user."},
+	{Ctype: History, Name: "history", Args: Words, MaxArgs: 1, Usage: "[n]",
+		Help: "Pages through the older messages of the room."},
+	{Ctype: Mentions, Name: "mentions", Args: NoArgs,
+		Help: "Lists the recent messages that mentioned you."},
+	{Ctype: Export, Name: "export", Args: Words, MaxArgs: 1, Usage: "[text|jsonl|html]",
+		Help: "Saves the history of the room to a file, in plain text by default."},
+	{Ctype: Edit, Name: "edit", Args: WordAndText, MinArgs: 2, MaxArgs: 2, Usage: "id text",
+		Help: "Replaces the text of your message."},
+	{Ctype: Delete, Name: "delete", Args: Words, MinArgs: 1, MaxArgs: 1, Usage: "id",
+		Help: "Deletes your message."},
+	{Ctype: Reply, Name: "reply", Args: WordAndText, MinArgs: 2, MaxArgs: 2, Usage: "id text",
+		Help: "Answers a message, quoting it."},
+	{Ctype: Private, Name: "private", Args: Words, MinArgs: 1, MaxArgs: Many, Usage: "name...",
+		Help: "Invites the users to your private session, creating one if needed."},
+	{Ctype: Accept, Name: "accept", Args: Words, MaxArgs: 1, Usage: "[id|host]",
+		Help: "Accepts an invite to a private session."},
+	{Ctype: Decline, Name: "decline", Args: Words, MaxArgs: 1, Usage: "[id|host]",
+		Help: "Declines an invite to a private session."},
+	{Ctype: Switch, Name: "switch", Args: Words, MaxArgs: 1, Usage: "[id]",
+		Help: "Talks in a private session, or in the room without an ID."},
+	{Ctype: End, Name: "end", Args: Words, MaxArgs: Many, Usage: "[name...]",
+		Help: "Removes users from the private session, or leaves it without names."},
+	{Ctype: Away, Name: "away", Args: Text, MaxArgs: 1, Usage: "[reason]",
+		Help: "Marks you away."},
+	{Ctype: Busy, Name: "busy", Args: Text, MaxArgs: 1, Usage: "[reason]",
+		Help: "Marks you busy."},
+	{Ctype: Back, Name: "back", Args: NoArgs,
+		Help: "Marks you online again."},
+	{Ctype: Kick, Name: "kick", Args: WordAndText, MinArgs: 1, MaxArgs: 2, Usage: "name [reason]",
+		Help: "Forces a user out of the server, moderators only."},
+	{Ctype: Ban, Name: "ban", Args: Words, MinArgs: 1, MaxArgs: 2, Usage: "name|ip [duration]",
+		Help: "Bans a username or an IP address, moderators only."},
+	{Ctype: Unban, Name: "unban", Args: Words, MinArgs: 1, MaxArgs: 1, Usage: "name|ip",
+		Help: "Lifts a ban, moderators only."},
+	{Ctype: Mute, Name: "mute", Args: Words, MinArgs: 1, MaxArgs: 2, Usage: "name [duration]",
+		Help: "Keeps a user from sending messages, moderators only."},
+	{Ctype: Unmute, Name: "unmute", Args: Words, MinArgs: 1, MaxArgs: 1, Usage: "name",
+		Help: "Lets a muted user speak again, moderators only."},
+	{Ctype: SlowMode, Name: "slowmode", Args: Words, MaxArgs: 1, Usage: "[seconds|off]",
+		Help: "Shows the slow mode of the room, moderators change it."},
+	{Ctype: Help, Name: "help", Args: Words, MaxArgs: 1, Usage: "[command]",
+		Help: "Explains the commands."},
+	{Ctype: Exit, Name: "exit", Aliases: []string{"quit"}, Args: NoArgs,
+		Help: "Signs out."},
+}
+
+// send is the declaration of the lines that are not commands, the text
+// itself is checked by the server so that the user is told why the
+// message was not sent
+var send = Spec{Ctype: Send, Name: "send", Args: Text, MaxArgs: 1}
+
+// byName maps the names and the aliases to the commands, byType maps the
+// Ctype of every command the clients send but Resume to its declaration
+var (
+	byName = map[string]Spec{}
+	byType = map[int]Spec{Send: send}
+)
+
+func init() {
+	for _, spec := range specs {
+		byType[spec.Ctype] = spec
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			if _, ok := byName[name]; ok {
+				panic(fmt.Sprintf("command: %s%s is declared twice", Prefix, name))
+			}
+			byName[name] = spec
+		}
+	}
+}
+
+// Specs returns the commands the users type
+func Specs() []Spec {
+	return append([]Spec(nil), specs...)
+}
+
+// Lookup finds a command by its name or one of its aliases, with or
+// without the prefix
+func Lookup(name string) (Spec, bool) {
+	spec, ok := byName[strings.TrimPrefix(name, Prefix)]
+	return spec, ok
+}
+
+// Validate checks a command received from a client against its
+// declaration
+func Validate(com *Command) error {
+	spec, ok := byType[com.Ctype]
+	if !ok {
+		return fmt.Errorf("unknown command %d", com.Ctype)
+	}
+	return spec.Check(com.Args)
+}
+
+// Names returns the names and the aliases of the commands with their
+// prefix, sorted
+func Names() []string {
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, Prefix+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse turns a line the user typed into a command. A line that does not
+// start with the prefix is chat, an unknown command is refused rather
+// than sent as chat
+func Parse(line string) (*Command, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, Prefix) {
+		return New(Send, []string{line}), nil
+	} else if strings.HasPrefix(line, Prefix+Prefix) {
+		return New(Send, []string{strings.TrimPrefix(line, Prefix)}), nil
+	}
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], line[i+1:]
+	}
+	spec, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown command %s: see %shelp, or start the line with %s%s to send it as chat",
+			name, Prefix, Prefix, Prefix)
+	}
+	return New(spec.Ctype, spec.Args.split(rest)), nil
+}
+
+// Explain returns the help of a command, or the list of the commands if
+// name is empty
+func Explain(name string) (string, error) {
+	if name == "" {
+		var help []string
+		for _, spec := range specs {
+			help = append(help, fmt.Sprintf("\t%-28s %s", spec.Syntax(), spec.Help))
+		}
+		return fmt.Sprintf("Commands, %shelp command explains one:\n%s", Prefix, strings.Join(help, "\n")), nil
+	}
+	spec, ok := Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("help: unknown command %s%s", Prefix, strings.TrimPrefix(name, Prefix))
+	}
+	help := fmt.Sprintf("%s\n\t%s", spec.Syntax(), spec.Help)
+	if len(spec.Aliases) > 0 {
+		help += fmt.Sprintf("\n\tAlso typed %s%s.", Prefix, strings.Join(spec.Aliases, ", "+Prefix))
+	}
+	return help, nil
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParse tests whether the lines are split into the arguments their
+// command declares and whether the unknown commands are refused
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		line  string
+		ctype int
+		args  []string
+	}{
+		{"hello there", Send, []string{"hello there"}},
+		{"@@alice hi", Send, []string{"@alice hi"}},
+		// TrimLeft used to eat the leading m, s and g of the name
+		{"@msg mgs  see you   soon", Msg, []string{"mgs", "see you   soon"}},
+		{"@dm bob hi", Msg, []string{"bob", "hi"}},
+		{"@history  hh 2", History, []string{"hh", "2"}},
+		{"@away out for lunch", Away, []string{"out for lunch"}},
+		{"@busy", Busy, []string{}},
+		{"@kick bob", Kick, []string{"bob"}},
+		{"@who everyone", Who, nil},
+		{"@quit", Exit, nil},
+		{"@help msg", Help, []string{"msg"}},
+	} {
+		com, err := Parse(test.line)
+		if err != nil {
+			t.Errorf("%q: %s", test.line, err)
+			continue
+		}
+		if com.Ctype != test.ctype || !reflect.DeepEqual(com.Args, test.args) {
+			t.Errorf("%q: expected %d %q, got %d %q", test.line, test.ctype, test.args, com.Ctype, com.Args)
+		}
+	}
+	for _, line := range []string{"@alice hi", "@whoever", "@backup"} {
+		if _, err := Parse(line); err == nil || !strings.Contains(err.Error(), "unknown command") {
+			t.Errorf("%q: expected an unknown command, got %v", line, err)
+		}
+	}
+}
+
+// TestExplain tests the help of the commands
+func TestExplain(t *testing.T) {
+	help, err := Explain("")
+	if err != nil || !strings.Contains(help, "@msg name text") || !strings.Contains(help, "@help [command]") {
+		t.Errorf("unexpected list of the commands %q, %v", help, err)
+	}
+	if help, err := Explain("@whisper"); err != nil || !strings.HasPrefix(help, "@msg name text") ||
+		!strings.Contains(help, "Also typed @dm, @whisper.") {
+		t.Errorf("unexpected help of @msg %q, %v", help, err)
+	}
+	if _, err := Explain("nothing"); err == nil {
+		t.Error("expected the help of an unknown command to fail")
+	}
+}
+
+// TestValidate tests whether the arguments of the commands the clients
+// send are checked against their declaration
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		com   *Command
+		usage string
+	}{
+		{New(Send, []string{"hi"}), ""},
+		{New(Send, []string{"hi", "there"}), "send: usage @send"},
+		{New(Join, nil), "join: usage @join room"},
+		{New(Join, []string{"dev", "ops"}), "join: usage @join room"},
+		{New(Leave, nil), ""},
+		{New(Msg, []string{"bob"}), "msg: usage @msg name text"},
+		{New(Private, []string{"bob", "carol", "dave"}), ""},
+		{New(Who, []string{"everyone"}), "who: usage @who"},
+	} {
+		err := Validate(test.com)
+		if test.usage == "" && err != nil {
+			t.Errorf("%d %q: %s", test.com.Ctype, test.com.Args, err)
+		} else if test.usage != "" && (err == nil || err.Error() != test.usage) {
+			t.Errorf("%d %q: expected %q, got %v", test.com.Ctype, test.com.Args, test.usage, err)
+		}
+	}
+	if err := Validate(New(Resume, []string{"token"})); err == nil {
+		t.Error("expected Resume to be refused after the handshake")
+	}
+}
@@ -0,0 +1,198 @@
+// Package account keeps the registered users of the chat server. The
+// passwords are never stored, only their salted PBKDF2 hashes are kept
+// in an append-only file of JSON lines
+package account
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MinPasswordLength is the length of the shortest password accepted
+	MinPasswordLength = 6
+	iterations        = 100000
+	saltLength        = 16
+	hashLength        = 32
+)
+
+var (
+	// ErrRegistered is returned when the name belongs to another account
+	ErrRegistered = errors.New("the name is already registered")
+	// ErrBadLogin is returned when the name or the password is wrong
+	ErrBadLogin = errors.New("wrong username or password")
+	// ErrShortPassword is returned when the password is too short
+	ErrShortPassword = fmt.Errorf("the password needs at least %d characters", MinPasswordLength)
+)
+
+// Account is a registered user as kept in the file
+type Account struct {
+	Name       string
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+	Created    time.Time
+}
+
+// verify checks the password against the hash in constant time
+func (acc *Account) verify(password string) bool {
+	hash, err := pbkdf2.Key(sha256.New, password, acc.Salt, acc.Iterations, len(acc.Hash))
+	return err == nil && subtle.ConstantTimeCompare(hash, acc.Hash) == 1
+}
+
+// Store is the registry of the accounts, it is safe for concurrent use.
+// The hashes are computed by the callers so that a login never holds up
+// the others
+type Store struct {
+	accounts map[string]*Account
+	file     *os.File
+	encoder  *json.Encoder
+
+	registerChan chan *operation
+	lookupChan   chan *operation
+	close        chan struct{}
+	closeOnce    sync.Once
+}
+
+type operation struct {
+	sync.WaitGroup
+	name    string
+	account *Account
+	err     error
+}
+
+// Open loads the accounts kept at path and appends the new ones to it,
+// the accounts are only kept in memory if path is empty
+func Open(path string) (*Store, error) {
+	store := &Store{
+		accounts:     make(map[string]*Account),
+		registerChan: make(chan *operation),
+		lookupChan:   make(chan *operation),
+		close:        make(chan struct{}),
+	}
+	if path != "" {
+		if err := store.load(path); err != nil {
+			return nil, fmt.Errorf("open accounts: %s", err)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("open accounts: %s", err)
+		}
+		store.file = file
+		store.encoder = json.NewEncoder(file)
+	}
+	go store.listen()
+	return store, nil
+}
+
+// load reads every account of the file
+func (store *Store) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		var acc Account
+		if err := decoder.Decode(&acc); err != nil {
+			// either the end of file or a partially written line
+			break
+		}
+		store.accounts[acc.Name] = &acc
+	}
+	return nil
+}
+
+// Register creates an account for the name
+func (store *Store) Register(name, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrShortPassword
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, iterations, hashLength)
+	if err != nil {
+		return err
+	}
+	op := operation{
+		name: name,
+		account: &Account{
+			Name:       name,
+			Salt:       salt,
+			Hash:       hash,
+			Iterations: iterations,
+			Created:    time.Now(),
+		},
+	}
+	op.Add(1)
+	store.registerChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Verify checks the password of the named account
+func (store *Store) Verify(name, password string) error {
+	acc := store.lookup(name)
+	if acc == nil || !acc.verify(password) {
+		return ErrBadLogin
+	}
+	return nil
+}
+
+// Registered checks whether the name belongs to an account
+func (store *Store) Registered(name string) bool {
+	return store.lookup(name) != nil
+}
+
+func (store *Store) lookup(name string) *Account {
+	op := operation{name: name}
+	op.Add(1)
+	store.lookupChan <- &op
+	op.Wait()
+	return op.account
+}
+
+// Close closes the file, the store cannot be used afterwards
+func (store *Store) Close() {
+	store.closeOnce.Do(func() {
+		close(store.close)
+	})
+}
+
+// listen synchronizes every operations that access the accounts
+func (store *Store) listen() {
+	for {
+		select {
+		case op := <-store.registerChan:
+			if _, ok := store.accounts[op.name]; ok {
+				op.err = ErrRegistered
+			} else if store.encoder != nil && store.encoder.Encode(op.account) != nil {
+				op.err = errors.New("the account could not be saved")
+			} else {
+				store.accounts[op.name] = op.account
+			}
+			op.Done()
+		case op := <-store.lookupChan:
+			op.account = store.accounts[op.name]
+			op.Done()
+		case <-store.close:
+			if store.file != nil {
+				store.file.Close()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package account
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFileStore tests whether the accounts survive a restart and the
+// passwords are checked against the kept hashes
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Register("alice", "abc"); err != ErrShortPassword {
+		t.Fatalf("register: expected %q, received %v", ErrShortPassword, err)
+	}
+	if err := store.Register("alice", "secret"); err != nil {
+		t.Fatalf("register: %s", err)
+	}
+	if err := store.Register("alice", "another"); err != ErrRegistered {
+		t.Fatalf("register twice: expected %q, received %v", ErrRegistered, err)
+	}
+	store.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if len(data) == 0 {
+		t.Fatal("the account was not saved")
+	} else if bytes.Contains(data, []byte("secret")) {
+		t.Fatal("the password was saved in plain text")
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if !store.Registered("alice") || store.Registered("bob") {
+		t.Fatal("registered: the accounts were not loaded")
+	}
+	if err := store.Verify("alice", "secret"); err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	if err := store.Verify("alice", "Secret"); err != ErrBadLogin {
+		t.Fatalf("verify a wrong password: expected %q, received %v", ErrBadLogin, err)
+	}
+	if err := store.Verify("bob", "secret"); err != ErrBadLogin {
+		t.Fatalf("verify an unknown name: expected %q, received %v", ErrBadLogin, err)
+	}
+}
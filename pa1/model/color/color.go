@@ -3,6 +3,7 @@ package color
 import (
 	"fmt"
 	"math/rand"
+	"regexp"
 	"time"
 )
 
@@ -130,3 +131,11 @@ func (color *Color) fgMatchesBg() bool {
 func (color *Color) String() string {
 	return fmt.Sprintf("\x1b[%d;%d;%dm", color.display, color.fg, color.bg)
 }
+
+// escapeCodes matches the escape codes that set the color of a text
+var escapeCodes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Strip removes every color escape code of a text
+func Strip(text string) string {
+	return escapeCodes.ReplaceAllString(text, "")
+}
@@ -0,0 +1,155 @@
+package color
+
+import (
+	"bytes"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// foregrounds and backgrounds are the CSS colors of the FgBlack to FgWhite
+// and BgBlack to BgWhite codes. The black text is grey so that it shows on
+// the black background every color has
+var (
+	foregrounds = [8]string{"#888", "#e66", "#6c6", "#cc6", "#69f", "#c6c", "#6cc", "#eee"}
+	backgrounds = [8]string{"#000", "#a22", "#282", "#882", "#22a", "#828", "#288", "#ccc"}
+)
+
+// style is the state of a terminal while it reads the escape codes
+type style struct {
+	bold, faint, italic, underline, blink, inverted, hidden bool
+	// fg and bg are zero for the default colors
+	fg, bg int
+}
+
+// apply applies the parameters of an escape code
+func (s *style) apply(params string) {
+	for _, param := range strings.Split(params, ";") {
+		code, err := strconv.Atoi(param)
+		if param == "" {
+			code, err = 0, nil
+		}
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == DisplayNormal:
+			*s = style{}
+		case code == DisplayBold:
+			s.bold = true
+		case code == DisplayFaint:
+			s.faint = true
+		case code == DisplayStandout:
+			s.italic = true
+		case code == DisplayUnderline:
+			s.underline = true
+		case code == DisplayBlink:
+			s.blink = true
+		case code == DisplayInverted:
+			s.inverted = true
+		case code == DisplayHidden:
+			s.hidden = true
+		case code == DisplayNormal2:
+			s.bold, s.faint = false, false
+		case code == DisplayNoStandout:
+			s.italic = false
+		case code == DisplayNoUnderline:
+			s.underline = false
+		case code == DisplayNoBlink:
+			s.blink = false
+		case code == DisplayNoReverse:
+			s.inverted = false
+		case code >= FgBlack && code <= FgWhite, code >= BgBlack && code <= BgWhite:
+			if code < BgBlack {
+				s.fg = code
+			} else {
+				s.bg = code
+			}
+		case code == FgDefault:
+			s.fg = 0
+		case code == BgDefault:
+			s.bg = 0
+		}
+	}
+}
+
+// css returns the CSS declarations of the style, empty for the default one
+func (s style) css() string {
+	var decls []string
+	fg, bg := s.fg, s.bg
+	if s.inverted {
+		fg, bg = bg-10, fg+10
+		if s.bg == 0 {
+			fg = FgBlack
+		}
+		if s.fg == 0 {
+			bg = BgWhite
+		}
+	}
+	if fg != 0 {
+		decls = append(decls, "color:"+foregrounds[fg-FgBlack])
+	}
+	if bg != 0 {
+		decls = append(decls, "background:"+backgrounds[bg-BgBlack])
+	}
+	if s.bold {
+		decls = append(decls, "font-weight:bold")
+	}
+	if s.faint {
+		decls = append(decls, "opacity:0.6")
+	}
+	if s.italic {
+		decls = append(decls, "font-style:italic")
+	}
+	if s.underline || s.blink {
+		decls = append(decls, "text-decoration:underline")
+	}
+	if s.hidden {
+		decls = append(decls, "visibility:hidden")
+	}
+	return strings.Join(decls, ";")
+}
+
+// CSS returns the CSS declarations that show a text in the color
+func (color *Color) CSS() string {
+	var s style
+	s.apply(strconv.Itoa(color.display) + ";" + strconv.Itoa(color.fg) + ";" + strconv.Itoa(color.bg))
+	return s.css()
+}
+
+// HTML turns a text colored with escape codes into HTML, the colors
+// become spans styled with CSS and the text is escaped
+func HTML(text string) string {
+	var (
+		b       bytes.Buffer
+		current style
+		open    bool
+	)
+	for len(text) > 0 {
+		loc := escapeCodes.FindStringIndex(text)
+		plain := text
+		if loc != nil {
+			plain = text[:loc[0]]
+		}
+		if plain != "" {
+			if css := current.css(); css != "" && !open {
+				b.WriteString(`<span style="` + css + `">`)
+				open = true
+			}
+			b.WriteString(html.EscapeString(plain))
+		}
+		if loc == nil {
+			break
+		}
+		if open {
+			b.WriteString("</span>")
+			open = false
+		}
+		current.apply(text[loc[0]+2 : loc[1]-1])
+		text = text[loc[1]:]
+	}
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
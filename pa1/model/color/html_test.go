@@ -0,0 +1,17 @@
+package color
+
+import "testing"
+
+// TestHTML tests whether the escape codes become styled spans and whether
+// the text is escaped
+func TestHTML(t *testing.T) {
+	bold := New(DisplayBold, FgGreen, BgBlack)
+	text := bold.String() + "<bob>" + Reset.String() + ": hi & bye"
+	expected := `<span style="color:#6c6;background:#000;font-weight:bold">&lt;bob&gt;</span>: hi &amp; bye`
+	if html := HTML(text); html != expected {
+		t.Errorf("expected %s, got %s", expected, html)
+	}
+	if css := New(DisplayInverted, FgRed, BgBlack).CSS(); css != "color:#888;background:#a22" {
+		t.Errorf("the inverted colors were not swapped: %s", css)
+	}
+}
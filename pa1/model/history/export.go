@@ -0,0 +1,147 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+)
+
+// Format is a format the transcripts are exported in
+type Format string
+
+const (
+	// JSONLines writes a JSON object per message
+	JSONLines Format = "jsonl"
+	// PlainText writes a line per message without the colors
+	PlainText Format = "text"
+	// HTML writes a page that keeps the colors and needs no other file
+	HTML Format = "html"
+)
+
+// ParseFormat finds a format by its name or its file name extension
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "jsonl", "json":
+		return JSONLines, nil
+	case "text", "txt", "plain":
+		return PlainText, nil
+	case "html", "htm":
+		return HTML, nil
+	}
+	return "", fmt.Errorf("unknown format %q, pick jsonl, text or html", name)
+}
+
+// Extension returns the file name extension of the format
+func (format Format) Extension() string {
+	switch format {
+	case JSONLines:
+		return ".jsonl"
+	case HTML:
+		return ".html"
+	}
+	return ".txt"
+}
+
+// timeLayout is the layout of the times in the text and the HTML
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// Transcript is the history of a room being exported
+type Transcript struct {
+	Room     string
+	Exported time.Time
+	// Entries are the messages, oldest first
+	Entries []*Entry
+}
+
+// line is a message of a transcript in JSON Lines
+type line struct {
+	Room    string    `json:"room"`
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author,omitempty"`
+	ReplyTo uint64    `json:"reply_to,omitempty"`
+	Text    string    `json:"text"`
+	Edited  bool      `json:"edited,omitempty"`
+}
+
+// text returns what the author wrote, or the text of a notification
+// without its colors
+func text(e *Entry) string {
+	if e.Author != "" && e.Body != "" {
+		return e.Body
+	}
+	return color.Strip(e.Text)
+}
+
+// Write writes the transcript in the format
+func (t Transcript) Write(w io.Writer, format Format) error {
+	buf := bufio.NewWriter(w)
+	switch format {
+	case JSONLines:
+		enc := json.NewEncoder(buf)
+		for _, e := range t.Entries {
+			if err := enc.Encode(line{
+				Room: t.Room, ID: e.ID, Time: e.Time, Author: e.Author,
+				ReplyTo: e.ReplyTo, Text: text(e), Edited: e.Edited,
+			}); err != nil {
+				return err
+			}
+		}
+	case PlainText:
+		fmt.Fprintf(buf, "Transcript of #%s, %d messages, exported %s\n\n",
+			t.Room, len(t.Entries), t.Exported.Format(timeLayout))
+		for _, e := range t.Entries {
+			fmt.Fprintf(buf, "[%s] #%d %s%s\n", e.Time.Format(timeLayout), e.ID, color.Strip(e.Text), edited(e))
+		}
+	case HTML:
+		t.writeHTML(buf)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return buf.Flush()
+}
+
+func edited(e *Entry) string {
+	if e.Edited {
+		return " (edited)"
+	}
+	return ""
+}
+
+func (t Transcript) writeHTML(w io.Writer) {
+	room := html.EscapeString(t.Room)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>#%s</title>
+<style>
+body { font-family: monospace; background: #111; color: #ddd; margin: 1em; }
+h1 { font-size: 1.2em; }
+.meta, time, .id, .edited { color: #888; }
+p { margin: 0.2em 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>#%s</h1>
+<div class="meta">%d messages, exported %s</div>
+`, room, room, len(t.Entries), t.Exported.Format(timeLayout))
+	for _, e := range t.Entries {
+		fmt.Fprintf(w, `<p id="m%d"><time datetime="%s">%s</time> <span class="id">#%d</span> %s`,
+			e.ID, e.Time.Format(time.RFC3339), e.Time.Format(timeLayout), e.ID, color.HTML(e.Text))
+		if e.ReplyTo != 0 {
+			fmt.Fprintf(w, ` <a class="id" href="#m%d">in reply to #%d</a>`, e.ReplyTo, e.ReplyTo)
+		}
+		if e.Edited {
+			io.WriteString(w, ` <span class="edited">(edited)</span>`)
+		}
+		io.WriteString(w, "</p>\n")
+	}
+	io.WriteString(w, "</body>\n</html>\n")
+}
@@ -0,0 +1,75 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExport tests the transcripts in every format
+func TestExport(t *testing.T) {
+	at := time.Date(2016, 7, 1, 12, 30, 0, 0, time.UTC)
+	transcript := Transcript{
+		Room:     "lobby",
+		Exported: at.Add(time.Hour),
+		Entries: []*Entry{
+			{ID: 1, Time: at, Text: "\x1b[3;32;40mSERVER: bob is online\x1b[0;0;0m"},
+			{ID: 2, Time: at, Author: "bob", Body: "<hi>", Edited: true,
+				Text: "\x1b[4;35;40mbob\x1b[0;0;0m\x1b[0;37;40m: <hi>\x1b[0;0;0m"},
+		},
+	}
+	write := func(format Format) string {
+		var b bytes.Buffer
+		if err := transcript.Write(&b, format); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	lines := strings.Split(strings.TrimSpace(write(JSONLines)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per message, got %q", lines)
+	}
+	var decoded line
+	if err := json.Unmarshal([]byte(lines[1]), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != (line{Room: "lobby", ID: 2, Time: at, Author: "bob", Text: "<hi>", Edited: true}) {
+		t.Errorf("unexpected JSON line %+v", decoded)
+	}
+
+	text := write(PlainText)
+	for _, expected := range []string{
+		"Transcript of #lobby, 2 messages, exported 2016-07-01 13:30:00 UTC",
+		"[2016-07-01 12:30:00 UTC] #1 SERVER: bob is online\n",
+		"#2 bob: <hi> (edited)\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in the text:\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, "\x1b") {
+		t.Error("the escape codes were kept in the text")
+	}
+
+	page := write(HTML)
+	for _, expected := range []string{
+		"<title>#lobby</title>",
+		`<span style="color:#c6c;background:#000;text-decoration:underline">bob</span>`,
+		"&lt;hi&gt;",
+		`<time datetime="2016-07-01T12:30:00Z">`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected %q in the page:\n%s", expected, page)
+		}
+	}
+
+	if format, err := ParseFormat("TXT"); err != nil || format != PlainText {
+		t.Errorf("expected txt to be the plain text, got %q, %v", format, err)
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("expected pdf to be refused")
+	}
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CompactSize is the size the file may reach before it is compacted, a
+// file that holds more retained messages may grow to twice their size
+const CompactSize = 1 << 20
+
+// File keeps the history in an append-only file of JSON lines. The
+// retained messages are also kept in memory to answer the queries.
+// The file is compacted to the retained messages when it is opened, when
+// it outgrows its limit and when it holds more dropped or replaced lines
+// than retained ones
+type File struct {
+	*Memory
+	path    string
+	file    *os.File
+	encoder *json.Encoder
+	// written is the size of the file, limit the size it is compacted at
+	written int64
+	limit   int64
+	// stale counts the lines of the file that are no longer retained
+	stale int
+}
+
+// OpenFile opens or creates the history file at path
+func OpenFile(path string, retention Retention) (*File, error) {
+	f := &File{Memory: NewMemory(retention), path: path}
+	if err := load(path, f.Memory); err != nil {
+		return nil, fmt.Errorf("open history: %s", err)
+	}
+	if err := f.compact(); err != nil {
+		return nil, fmt.Errorf("open history: %s", err)
+	}
+	return f, nil
+}
+
+// counter counts the bytes written to w
+type counter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c counter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
+
+// load reads every entry of the file into the memory store
+func load(path string, mem *Memory) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		var e Entry
+		if err := decoder.Decode(&e); err != nil {
+			// either the end of file or a partially written line
+			// ends the history
+			break
+		}
+		// an updated message is written again with the same sequence
+		// number
+		if !mem.replace(&e) {
+			mem.push(&e)
+		}
+	}
+	mem.expire()
+	return nil
+}
+
+// compact rewrites the file with the retained entries and opens it again
+// for appending
+func (f *File) compact() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+	}
+	if err := compact(f.path, f.Memory); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.encoder = file, json.NewEncoder(counter{w: file, n: &f.written})
+	f.written, f.stale, f.Memory.pruned = info.Size(), 0, 0
+	f.limit = 2 * f.written
+	if f.limit < CompactSize {
+		f.limit = CompactSize
+	}
+	return nil
+}
+
+// compactIfNeeded compacts the file once it outgrew its limit or once it
+// holds more stale lines than retained messages
+func (f *File) compactIfNeeded() error {
+	f.stale += f.Memory.pruned
+	f.Memory.pruned = 0
+	if f.written <= f.limit && f.stale <= f.Memory.size {
+		return nil
+	}
+	return f.compact()
+}
+
+// compact rewrites the file with the retained entries only, the deleted
+// ones are kept so that their sequence numbers are not reused
+func compact(path string, mem *Memory) error {
+	mem.expire()
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for i := 0; i < mem.size; i++ {
+		if err := encoder.Encode(mem.at(i)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Append implements the Store interface
+func (f *File) Append(entry Entry) (*Entry, error) {
+	e, _ := f.Memory.Append(entry)
+	if err := f.encoder.Encode(e); err != nil {
+		return e, fmt.Errorf("append history: %s", err)
+	}
+	if err := f.compactIfNeeded(); err != nil {
+		return e, fmt.Errorf("append history: %s", err)
+	}
+	return e, nil
+}
+
+// Update implements the Store interface, the updated message is appended
+// to the file and replaces the original when the file is loaded again
+func (f *File) Update(e Entry) error {
+	if err := f.Memory.Update(e); err != nil {
+		return err
+	}
+	if err := f.encoder.Encode(&e); err != nil {
+		return fmt.Errorf("update history: %s", err)
+	}
+	// the line of the original message is stale
+	f.stale++
+	if err := f.compactIfNeeded(); err != nil {
+		return fmt.Errorf("update history: %s", err)
+	}
+	return nil
+}
+
+// Close implements the Store interface
+func (f *File) Close() error {
+	return f.file.Close()
+}
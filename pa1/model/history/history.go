@@ -0,0 +1,79 @@
+// Package history keeps the chat history of a room. A Store is bounded by
+// a Retention: the oldest messages are dropped once the store holds more
+// than MaxCount messages or once they are older than MaxAge.
+// Stores are not safe for concurrent use, the room that owns a store
+// serializes every access to it
+package history
+
+import (
+	"math"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+)
+
+const (
+	// DefaultCount is the number of messages a store keeps when the
+	// retention does not limit it
+	DefaultCount = 500
+	// Latest can be passed to Before to page from the newest message
+	Latest = math.MaxUint64
+)
+
+// Entry is a message kept in the history. Entry implements the
+// message.Message interface so it can be replayed to the users
+type Entry struct {
+	// Seq is assigned by the store, it increases with every message
+	Seq uint64
+	// ID, Time, Author, ReplyTo and Mentions are the stamp of the
+	// message
+	ID       uint64
+	Time     time.Time
+	Author   string
+	ReplyTo  uint64   `json:",omitempty"`
+	Mentions []string `json:",omitempty"`
+	Text     string
+	// Body is the text the author wrote, Text decorates it
+	Body    string `json:",omitempty"`
+	Edited  bool   `json:",omitempty"`
+	Deleted bool   `json:",omitempty"`
+}
+
+// String implements the message.Message interface
+func (e *Entry) String() string {
+	return e.Text
+}
+
+// Stamp implements the message.Stamper interface
+func (e *Entry) Stamp() message.Stamp {
+	return message.Stamp{ID: e.ID, Time: e.Time, Author: e.Author, ReplyTo: e.ReplyTo, Mentions: e.Mentions}
+}
+
+// Retention limits how many and how old messages are kept
+type Retention struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// expired checks whether the entry is too old to be kept
+func (ret Retention) expired(e *Entry, now time.Time) bool {
+	return ret.MaxAge > 0 && now.Sub(e.Time) > ret.MaxAge
+}
+
+// Store keeps the history of a room
+type Store interface {
+	// Append adds a message to the history and assigns its sequence
+	// number, the time of the message is now if it is zero
+	Append(e Entry) (*Entry, error)
+	// Recent returns at most n of the newest messages, oldest first
+	Recent(n int) ([]*Entry, error)
+	// Before returns at most n messages that are older than seq,
+	// oldest first. The deleted messages are skipped
+	Before(seq uint64, n int) ([]*Entry, error)
+	// Find returns the message that has the server ID
+	Find(id uint64) (*Entry, bool)
+	// Update replaces the message that has the sequence number of e
+	Update(e Entry) error
+	// Close releases the resources held by the store
+	Close() error
+}
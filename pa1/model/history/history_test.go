@@ -0,0 +1,224 @@
+package history
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func texts(entries []*Entry) []string {
+	res := []string{}
+	for _, e := range entries {
+		res = append(res, e.Text)
+	}
+	return res
+}
+
+func fill(s Store, n int) {
+	for i := 1; i <= n; i++ {
+		s.Append(Entry{Text: fmt.Sprintf("m%d", i)})
+	}
+}
+
+// TestMemoryRetention tests whether the ring buffer keeps the newest
+// messages only
+func TestMemoryRetention(t *testing.T) {
+	mem := NewMemory(Retention{MaxCount: 3})
+	fill(mem, 5)
+	entries, _ := mem.Recent(10)
+	if got := fmt.Sprint(texts(entries)); got != "[m3 m4 m5]" {
+		t.Fatalf("recent: expected [m3 m4 m5], received %s", got)
+	}
+	entries, _ = mem.Recent(2)
+	if got := fmt.Sprint(texts(entries)); got != "[m4 m5]" {
+		t.Fatalf("recent: expected [m4 m5], received %s", got)
+	}
+}
+
+// TestMemoryGrowth tests whether the ring grows with the history and
+// stops at the retention
+func TestMemoryGrowth(t *testing.T) {
+	mem := NewMemory(Retention{MaxCount: 40})
+	if len(mem.ring) != 0 {
+		t.Fatalf("new: expected an empty ring, received %d entries", len(mem.ring))
+	}
+	fill(mem, 20)
+	if len(mem.ring) != 32 {
+		t.Fatalf("grow: expected a ring of 32 entries, received %d", len(mem.ring))
+	}
+	fill(mem, 30)
+	if len(mem.ring) != 40 {
+		t.Fatalf("grow: expected a ring of 40 entries, received %d", len(mem.ring))
+	}
+	entries, _ := mem.Recent(2)
+	if got := fmt.Sprint(texts(entries)); got != "[m29 m30]" {
+		t.Fatalf("recent: expected [m29 m30], received %s", got)
+	}
+	if entries, _ = mem.Recent(100); len(entries) != 40 || entries[0].Seq != 11 {
+		t.Fatalf("recent: expected the messages 11 to 50, received %d from %d", len(entries), entries[0].Seq)
+	}
+}
+
+// TestMemoryPaging tests whether Before pages through older messages
+func TestMemoryPaging(t *testing.T) {
+	mem := NewMemory(Retention{MaxCount: 10})
+	fill(mem, 7)
+	cases := []struct {
+		before uint64
+		n      int
+		res    string
+	}{
+		{Latest, 2, "[m6 m7]"},
+		{6, 2, "[m4 m5]"},
+		{4, 5, "[m1 m2 m3]"},
+		{1, 5, "[]"},
+	}
+	for _, c := range cases {
+		entries, _ := mem.Before(c.before, c.n)
+		if got := fmt.Sprint(texts(entries)); got != c.res {
+			t.Fatalf("before %d: expected %s, received %s", c.before, c.res, got)
+		}
+	}
+}
+
+// TestMemoryExpiry tests whether old messages are dropped
+func TestMemoryExpiry(t *testing.T) {
+	mem := NewMemory(Retention{MaxCount: 10, MaxAge: time.Minute})
+	fill(mem, 3)
+	mem.at(0).Time = time.Now().Add(-2 * time.Minute)
+	entries, _ := mem.Recent(10)
+	if got := fmt.Sprint(texts(entries)); got != "[m2 m3]" {
+		t.Fatalf("expiry: expected [m2 m3], received %s", got)
+	}
+}
+
+// TestFileReopen tests whether the file store keeps the history and the
+// sequence numbers after being reopened
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lobby.log")
+
+	f, err := OpenFile(path, Retention{MaxCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(f, 4)
+	f.Close()
+
+	if f, err = OpenFile(path, Retention{MaxCount: 3}); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, _ := f.Recent(10)
+	if got := fmt.Sprint(texts(entries)); got != "[m2 m3 m4]" {
+		t.Fatalf("reopen: expected [m2 m3 m4], received %s", got)
+	}
+	e, _ := f.Append(Entry{Text: "m5"})
+	if e.Seq != 5 {
+		t.Fatalf("reopen: expected sequence 5, received %d", e.Seq)
+	}
+}
+
+// TestFileUpdate tests whether the edited and the deleted messages are
+// kept after the file is reopened
+func TestFileUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lobby.log")
+
+	f, err := OpenFile(path, Retention{MaxCount: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		f.Append(Entry{ID: uint64(10 + i), Text: fmt.Sprintf("m%d", i)})
+	}
+	e, ok := f.Find(12)
+	if !ok {
+		t.Fatal("find: message 12 not found")
+	}
+	edited := *e
+	edited.Text, edited.Edited = "m2 edited", true
+	if err := f.Update(edited); err != nil {
+		t.Fatal(err)
+	}
+	e, _ = f.Find(13)
+	deleted := *e
+	deleted.Deleted = true
+	if err := f.Update(deleted); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if f, err = OpenFile(path, Retention{MaxCount: 5}); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, _ := f.Recent(10)
+	if got := fmt.Sprint(texts(entries)); got != "[m1 m2 edited]" {
+		t.Fatalf("reopen: expected [m1 m2 edited], received %s", got)
+	}
+	if _, ok := f.Find(13); ok {
+		t.Fatal("find: the deleted message 13 was found")
+	}
+}
+
+// lines counts the lines of the file
+func lines(t *testing.T, path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// TestFileCompaction tests whether the file is compacted while it is open,
+// once it holds more dropped lines than retained ones or once it outgrew
+// its limit
+func TestFileCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lobby.log")
+
+	f, err := OpenFile(path, Retention{MaxCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fill(f, 100)
+	if n := lines(t, path); n > 7 {
+		t.Fatalf("prune: expected at most 7 lines, the file holds %d", n)
+	}
+	f.limit = 0
+	f.Append(Entry{Text: "m101"})
+	if n := lines(t, path); n != 3 {
+		t.Fatalf("size: expected 3 lines, the file holds %d", n)
+	}
+	newest, _ := f.Recent(1)
+	edited := *newest[0]
+	for i := 0; i < 4; i++ {
+		edited.Text = fmt.Sprintf("m101 edit %d", i)
+		f.Update(edited)
+	}
+	if n := lines(t, path); n > 7 {
+		t.Fatalf("update: expected at most 7 lines, the file holds %d", n)
+	}
+	entries, _ := f.Recent(10)
+	if got := fmt.Sprint(texts(entries)); got != "[m99 m100 m101 edit 3]" {
+		t.Fatalf("recent: expected [m99 m100 m101 edit 3], received %s", got)
+	}
+}
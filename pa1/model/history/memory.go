@@ -0,0 +1,148 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// minRing is the length of the ring of a store once it holds a message
+const minRing = 16
+
+// Memory is a ring buffer that keeps the history in memory only, the
+// ring grows with the history up to MaxCount entries
+type Memory struct {
+	retention Retention
+	ring      []*Entry
+	// head is the index of the oldest entry
+	head int
+	size int
+	seq  uint64
+	// pruned counts the entries dropped by the retention
+	pruned int
+}
+
+// NewMemory creates an in-memory store
+func NewMemory(retention Retention) *Memory {
+	if retention.MaxCount <= 0 {
+		retention.MaxCount = DefaultCount
+	}
+	return &Memory{retention: retention}
+}
+
+// Append implements the Store interface
+func (m *Memory) Append(e Entry) (*Entry, error) {
+	m.seq++
+	e.Seq = m.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	m.push(&e)
+	return &e, nil
+}
+
+// push adds an entry that already has a sequence number
+func (m *Memory) push(e *Entry) {
+	if e.Seq > m.seq {
+		m.seq = e.Seq
+	}
+	if m.size == len(m.ring) && len(m.ring) < m.retention.MaxCount {
+		m.grow()
+	}
+	if m.size == len(m.ring) {
+		// overwrite the oldest one
+		m.ring[m.head] = e
+		m.head = (m.head + 1) % len(m.ring)
+		m.pruned++
+		return
+	}
+	m.ring[(m.head+m.size)%len(m.ring)] = e
+	m.size++
+}
+
+// grow doubles the length of the ring, the entries are moved to the
+// front of the new ring
+func (m *Memory) grow() {
+	length := 2 * len(m.ring)
+	if length < minRing {
+		length = minRing
+	}
+	if length > m.retention.MaxCount {
+		length = m.retention.MaxCount
+	}
+	ring := make([]*Entry, length)
+	for i := 0; i < m.size; i++ {
+		ring[i] = m.at(i)
+	}
+	m.ring, m.head = ring, 0
+}
+
+// expire drops the entries that are too old
+func (m *Memory) expire() {
+	now := time.Now()
+	for m.size > 0 && m.retention.expired(m.ring[m.head], now) {
+		m.ring[m.head] = nil
+		m.head = (m.head + 1) % len(m.ring)
+		m.size--
+		m.pruned++
+	}
+}
+
+func (m *Memory) at(i int) *Entry {
+	return m.ring[(m.head+i)%len(m.ring)]
+}
+
+// Recent implements the Store interface
+func (m *Memory) Recent(n int) ([]*Entry, error) {
+	return m.Before(Latest, n)
+}
+
+// Before implements the Store interface
+func (m *Memory) Before(seq uint64, n int) ([]*Entry, error) {
+	m.expire()
+	// walk back from the newest entry that is older than seq
+	entries := []*Entry{}
+	for i := m.size - 1; i >= 0 && len(entries) < n; i-- {
+		if e := m.at(i); e.Seq < seq && !e.Deleted {
+			entries = append(entries, e)
+		}
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Find implements the Store interface
+func (m *Memory) Find(id uint64) (*Entry, bool) {
+	for i := m.size - 1; i >= 0; i-- {
+		if e := m.at(i); e.ID == id && !e.Deleted {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Update implements the Store interface
+func (m *Memory) Update(e Entry) error {
+	if !m.replace(&e) {
+		return fmt.Errorf("update history: message %d is not kept", e.Seq)
+	}
+	return nil
+}
+
+// replace replaces the entry that has the same sequence number, it
+// reports whether the entry was found
+func (m *Memory) replace(e *Entry) bool {
+	for i := m.size - 1; i >= 0; i-- {
+		if m.at(i).Seq == e.Seq {
+			m.ring[(m.head+i)%len(m.ring)] = e
+			return true
+		}
+	}
+	return false
+}
+
+// Close implements the Store interface
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,239 @@
+// Package mailbox keeps the messages sent to registered users while they
+// are offline. The mailboxes are kept in memory or in an append-only file
+// of JSON lines
+package mailbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCount is the number of letters a mailbox holds by default
+	DefaultCount = 50
+	// DefaultAge is how long the letters are kept by default
+	DefaultAge = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrFull is returned when the mailbox holds as many letters as it can
+	ErrFull = errors.New("the mailbox is full")
+	// ErrNoMailbox is returned when the name has no mailbox, only the
+	// registered names have one
+	ErrNoMailbox = errors.New("the name has no mailbox")
+)
+
+// Letter is a message waiting for an offline user
+type Letter struct {
+	To   string
+	From string
+	// ID and Time are the stamp of the message
+	ID   uint64
+	Time time.Time
+	Text string
+	// Mention is set when the user was mentioned rather than messaged
+	Mention bool `json:",omitempty"`
+}
+
+// record is a line of the file, a taken record empties the mailbox of
+// the user
+type record struct {
+	Letter
+	Taken bool `json:",omitempty"`
+}
+
+// Limits bound the mailboxes, a zero MaxCount or MaxAge is no limit
+type Limits struct {
+	// MaxCount is the number of letters a mailbox holds
+	MaxCount int
+	// MaxAge is how long the letters are kept
+	MaxAge time.Duration
+}
+
+// expired checks whether the letter is too old to be delivered
+func (l Limits) expired(letter Letter, now time.Time) bool {
+	return l.MaxAge > 0 && now.Sub(letter.Time) > l.MaxAge
+}
+
+// Store keeps the mailboxes, it is safe for concurrent use
+type Store struct {
+	limits  Limits
+	boxes   map[string][]Letter
+	file    *os.File
+	encoder *json.Encoder
+
+	postChan  chan *operation
+	takeChan  chan *operation
+	close     chan struct{}
+	closeOnce sync.Once
+}
+
+type operation struct {
+	sync.WaitGroup
+	letter  Letter
+	name    string
+	letters []Letter
+	err     error
+}
+
+// Open loads the mailboxes kept at path and appends the new letters to
+// it, the mailboxes are only kept in memory if path is empty. The file is
+// rewritten with the letters that are still waiting
+func Open(path string, limits Limits) (*Store, error) {
+	store := &Store{
+		limits:   limits,
+		boxes:    make(map[string][]Letter),
+		postChan: make(chan *operation),
+		takeChan: make(chan *operation),
+		close:    make(chan struct{}),
+	}
+	if path != "" {
+		if err := store.load(path); err != nil {
+			return nil, fmt.Errorf("open mailboxes: %s", err)
+		}
+		if err := store.compact(path); err != nil {
+			return nil, fmt.Errorf("open mailboxes: %s", err)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("open mailboxes: %s", err)
+		}
+		store.file = file
+		store.encoder = json.NewEncoder(file)
+	}
+	go store.listen()
+	return store, nil
+}
+
+// load replays the records of the file
+func (store *Store) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	now := time.Now()
+	for {
+		var rec record
+		if err := decoder.Decode(&rec); err != nil {
+			// either the end of file or a partially written line
+			break
+		}
+		if rec.Taken {
+			delete(store.boxes, rec.To)
+		} else if !store.limits.expired(rec.Letter, now) {
+			store.boxes[rec.To] = append(store.boxes[rec.To], rec.Letter)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the file with the waiting letters only
+func (store *Store) compact(path string) error {
+	tmp, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(store.boxes))
+	for name := range store.boxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	encoder := json.NewEncoder(tmp)
+	for _, name := range names {
+		for _, letter := range store.boxes[name] {
+			if err := encoder.Encode(record{Letter: letter}); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Post puts a letter in the mailbox of its recipient
+func (store *Store) Post(letter Letter) error {
+	op := operation{letter: letter}
+	op.Add(1)
+	store.postChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Take empties the mailbox of the user and returns the letters that did
+// not expire, the oldest first
+func (store *Store) Take(name string) []Letter {
+	op := operation{name: name}
+	op.Add(1)
+	store.takeChan <- &op
+	op.Wait()
+	return op.letters
+}
+
+// Close closes the file, the store cannot be used afterwards
+func (store *Store) Close() {
+	store.closeOnce.Do(func() {
+		close(store.close)
+	})
+}
+
+// listen synchronizes every operations that access the mailboxes
+func (store *Store) listen() {
+	for {
+		select {
+		case op := <-store.postChan:
+			box := store.unexpired(op.letter.To)
+			if store.limits.MaxCount > 0 && len(box) >= store.limits.MaxCount {
+				op.err = ErrFull
+			} else if store.encoder != nil && store.encoder.Encode(record{Letter: op.letter}) != nil {
+				op.err = errors.New("the letter could not be saved")
+			} else {
+				store.boxes[op.letter.To] = append(box, op.letter)
+			}
+			op.Done()
+		case op := <-store.takeChan:
+			op.letters = store.unexpired(op.name)
+			if _, ok := store.boxes[op.name]; ok {
+				delete(store.boxes, op.name)
+				if store.encoder != nil {
+					store.encoder.Encode(record{Letter: Letter{To: op.name}, Taken: true})
+				}
+			}
+			op.Done()
+		case <-store.close:
+			if store.file != nil {
+				store.file.Close()
+			}
+			return
+		}
+	}
+}
+
+// unexpired drops the expired letters of the mailbox and returns the
+// others
+func (store *Store) unexpired(name string) []Letter {
+	now := time.Now()
+	box := store.boxes[name][:0]
+	for _, letter := range store.boxes[name] {
+		if !store.limits.expired(letter, now) {
+			box = append(box, letter)
+		}
+	}
+	if len(box) == 0 {
+		delete(store.boxes, name)
+		return nil
+	}
+	store.boxes[name] = box
+	return box
+}
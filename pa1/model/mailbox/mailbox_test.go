@@ -0,0 +1,61 @@
+package mailbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFileStore tests whether the letters survive a restart, whether the
+// mailboxes are bounded and whether old letters expire
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mailbox")
+	limits := Limits{MaxCount: 2, MaxAge: time.Hour}
+
+	store, err := Open(path, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	letters := []Letter{
+		{To: "bob", From: "alice", ID: 1, Time: now.Add(-2 * time.Hour), Text: "too old"},
+		{To: "bob", From: "alice", ID: 2, Time: now, Text: "first"},
+		{To: "bob", From: "carol", ID: 3, Time: now, Text: "second"},
+		{To: "carol", From: "alice", ID: 4, Time: now, Text: "for carol"},
+	}
+	for _, letter := range letters {
+		if err := store.Post(letter); err != nil {
+			t.Fatalf("post %q: %s", letter.Text, err)
+		}
+	}
+	if err := store.Post(Letter{To: "bob", Time: now, Text: "third"}); err != ErrFull {
+		t.Fatalf("post to a full mailbox: expected %q, received %v", ErrFull, err)
+	}
+	if taken := store.Take("carol"); len(taken) != 1 || taken[0].Text != "for carol" {
+		t.Fatalf("take: expected the letter for carol, received %v", taken)
+	}
+	store.Close()
+
+	store, err = Open(path, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if taken := store.Take("carol"); len(taken) != 0 {
+		t.Fatalf("take after a restart: the letters of carol came back, received %v", taken)
+	}
+	taken := store.Take("bob")
+	if len(taken) != 2 || taken[0].Text != "first" || taken[1].Text != "second" {
+		t.Fatalf("take after a restart: expected first and second, received %v", taken)
+	}
+	if taken := store.Take("bob"); len(taken) != 0 {
+		t.Fatalf("take twice: expected an empty mailbox, received %v", taken)
+	}
+}
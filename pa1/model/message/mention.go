@@ -0,0 +1,35 @@
+package message
+
+import "strings"
+
+// mentionTrail is the punctuation that may follow a mention
+const mentionTrail = ".,:;!?)'\""
+
+// Mentions finds the @username mentions of a text, every username is
+// returned once in the order it was first mentioned
+func Mentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		name := strings.TrimRight(word[1:], mentionTrail)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Mentioned checks whether the message mentions the user
+func (s Stamp) Mentioned(username string) bool {
+	for _, name := range s.Mentions {
+		if name == username {
+			return true
+		}
+	}
+	return false
+}
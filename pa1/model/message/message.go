@@ -34,3 +34,8 @@ func NewConcrete(col *color.Color, msg string) *ConcreteMessage {
 func (mes *ConcreteMessage) String() string {
 	return fmt.Sprintf("%s%s", mes.Color.String(), mes.string)
 }
+
+// Text returns the message without color
+func (mes *ConcreteMessage) Text() string {
+	return mes.string
+}
@@ -0,0 +1,86 @@
+package message
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// lastID is the ID of the newest stamped message of the server
+var lastID uint64
+
+// Stamp describes a message once a room received it
+type Stamp struct {
+	// ID is assigned by the server, it increases with every message
+	ID     uint64
+	Time   time.Time
+	Author string
+	// ReplyTo is the ID of the message a reply answers
+	ReplyTo uint64
+	// Mentions are the users the text mentions with @username
+	Mentions []string
+}
+
+// Stamper is a message that carries its stamp
+type Stamper interface {
+	Message
+	Stamp() Stamp
+}
+
+// Stamped is a message stamped by a room
+type Stamped struct {
+	Message
+	stamp Stamp
+}
+
+// Stamp implements the Stamper interface
+func (s *Stamped) Stamp() Stamp {
+	return s.stamp
+}
+
+// NewStamped stamps a message with a new ID and the current time, the
+// author is the user who wrote the message if any and the mentions are
+// found in its text. A message that already carries a stamp is returned
+// as is
+func NewStamped(mes Message) Stamper {
+	if stamper, ok := mes.(Stamper); ok {
+		return stamper
+	}
+	stamp := Stamp{
+		ID:   atomic.AddUint64(&lastID, 1),
+		Time: time.Now().UTC(),
+	}
+	if author, ok := mes.(interface {
+		Username() string
+	}); ok {
+		stamp.Author = author.Username()
+	}
+	if reply, ok := mes.(interface {
+		ReplyTo() uint64
+	}); ok {
+		stamp.ReplyTo = reply.ReplyTo()
+	}
+	if text, ok := mes.(interface {
+		Text() string
+	}); ok && stamp.Author != "" {
+		stamp.Mentions = Mentions(text.Text())
+	}
+	return &Stamped{Message: mes, stamp: stamp}
+}
+
+// Observe makes sure the next IDs are greater than id, the rooms observe
+// the IDs of the messages they kept from a previous run
+func Observe(id uint64) {
+	for {
+		last := atomic.LoadUint64(&lastID)
+		if last >= id || atomic.CompareAndSwapUint64(&lastID, last, id) {
+			return
+		}
+	}
+}
+
+// Update tells the users that a message they received was edited or
+// deleted, it keeps the stamp of the original message
+type Update struct {
+	Stamper
+	Deleted bool
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/user"
+)
+
+var botColor = color.New(color.DisplayFaint, color.FgWhite, color.BgBlack)
+
+// Bot is the user a plugin talks as. Bot implements the
+// model/room/interf.User interface, the rooms do not list it unless it is
+// added to them like any other user
+type Bot struct {
+	*user.ConcreteUser
+	errs chan error
+
+	mu          sync.Mutex
+	broadcaster room.Broadcaster
+}
+
+// NewBot creates a bot, the errors the rooms send it are logged
+func NewBot(username string, col *color.Color) *Bot {
+	usr, _ := user.New(username, col, nil)
+	bot := &Bot{
+		ConcreteUser: usr,
+		errs:         make(chan error),
+	}
+	go func() {
+		for err := range bot.errs {
+			log.Printf("bot %s: %s", username, err)
+		}
+	}()
+	return bot
+}
+
+// Error implements the model/room/interf.User interface
+func (bot *Bot) Error() chan<- error {
+	return bot.errs
+}
+
+// Receive implements the model/room/interf.User interface, the bots
+// follow the conversations through the events
+func (bot *Bot) Receive(message.Message) {}
+
+// SetBroadcaster implements the model/room/interf.User interface
+func (bot *Bot) SetBroadcaster(broadcaster room.Broadcaster) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.broadcaster = broadcaster
+}
+
+// Say says the text in the room the bot was added to, it reports whether
+// the bot is in one
+func (bot *Bot) Say(text string) bool {
+	bot.mu.Lock()
+	broadcaster := bot.broadcaster
+	bot.mu.Unlock()
+	if broadcaster == nil {
+		return false
+	}
+	broadcaster.Broadcaster() <- bot.Message(text)
+	return true
+}
+
+// String prints the name of the bot followed by a faint marker
+func (bot *Bot) String() string {
+	return fmt.Sprintf("%s %s(bot)%s", bot.ConcreteUser.String(), botColor.String(), color.Reset.String())
+}
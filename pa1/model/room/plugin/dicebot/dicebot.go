@@ -0,0 +1,121 @@
+// Package dicebot is a sample plugin: it echoes the text of !echo, rolls
+// the dice of !roll and welcomes the users to the public rooms
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
+)
+
+const (
+	// Name is the username of the bot
+	Name = "dicebot"
+	// MaxDice and MaxSides bound a roll
+	MaxDice  = 100
+	MaxSides = 1000
+)
+
+var botColor = color.New(color.DisplayBold, color.FgYellow, color.BgBlack)
+
+// Bot implements plugin.CommandHandler and plugin.JoinHandler
+type Bot struct {
+	bot *plugin.Bot
+
+	// mu guards rnd, the rooms call the handlers at the same time
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New creates the bot, the dice are rolled with the source
+func New(src rand.Source) *Bot {
+	return &Bot{
+		bot: plugin.NewBot(Name, botColor),
+		rnd: rand.New(src),
+	}
+}
+
+// Bot implements the plugin.Plugin interface
+func (b *Bot) Bot() *plugin.Bot {
+	return b.bot
+}
+
+// Commands implements the plugin.CommandHandler interface
+func (b *Bot) Commands() []string {
+	return []string{"echo", "roll", "dice"}
+}
+
+// OnCommand implements the plugin.CommandHandler interface
+func (b *Bot) OnCommand(ev *plugin.Event) {
+	switch ev.Command {
+	case "echo":
+		if ev.Args != "" {
+			ev.Reply(ev.Args)
+		}
+	case "roll", "dice":
+		ev.Reply(b.roll(ev.User, ev.Args))
+	}
+}
+
+// OnJoin implements the plugin.JoinHandler interface, the members of a
+// private session are not welcomed again
+func (b *Bot) OnJoin(ev *plugin.Event) {
+	if ev.Session == "" {
+		ev.Reply(fmt.Sprintf("Welcome to #%s, %s! Roll the dice with !roll 2d6.", ev.Room, ev.User))
+	}
+}
+
+// roll rolls the dice for the user and tells the result
+func (b *Bot) roll(username, spec string) string {
+	dice, sides, err := Parse(spec)
+	if err != nil {
+		return fmt.Sprintf("%s: %s", username, err)
+	}
+	b.mu.Lock()
+	rolls := make([]string, dice)
+	total := 0
+	for i := range rolls {
+		n := b.rnd.Intn(sides) + 1
+		rolls[i] = strconv.Itoa(n)
+		total += n
+	}
+	b.mu.Unlock()
+	if dice == 1 {
+		return fmt.Sprintf("%s rolled %dd%d: %d", username, dice, sides, total)
+	}
+	return fmt.Sprintf("%s rolled %dd%d: %s = %d", username, dice, sides,
+		strings.Join(rolls, " + "), total)
+}
+
+// Parse reads dice written like 2d6, the number of dice may be left out
+// and an empty spec is a single d6
+func Parse(spec string) (dice, sides int, err error) {
+	if spec == "" {
+		return 1, 6, nil
+	}
+	parts := strings.SplitN(strings.ToLower(spec), "d", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("roll: write the dice like 2d6")
+	}
+	dice = 1
+	if parts[0] != "" {
+		if dice, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, 0, errors.New("roll: write the dice like 2d6")
+		}
+	}
+	if sides, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, errors.New("roll: write the dice like 2d6")
+	}
+	if dice < 1 || dice > MaxDice {
+		return 0, 0, fmt.Errorf("roll: roll between 1 and %d dice", MaxDice)
+	} else if sides < 2 || sides > MaxSides {
+		return 0, 0, fmt.Errorf("roll: a die has between 2 and %d sides", MaxSides)
+	}
+	return dice, sides, nil
+}
@@ -0,0 +1,58 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestParse tests whether the dice are read and whether the rolls out of
+// bounds are refused
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		spec         string
+		dice, sides  int
+		wantsFailure bool
+	}{
+		{"", 1, 6, false},
+		{"2d6", 2, 6, false},
+		{"d20", 1, 20, false},
+		{"3D8", 3, 8, false},
+		{"0d6", 0, 0, true},
+		{"2d1", 0, 0, true},
+		{"101d6", 0, 0, true},
+		{"2d", 0, 0, true},
+		{"six", 0, 0, true},
+	} {
+		dice, sides, err := Parse(tc.spec)
+		if (err != nil) != tc.wantsFailure {
+			t.Errorf("Parse(%q): unexpected error %v", tc.spec, err)
+		} else if dice != tc.dice || sides != tc.sides {
+			t.Errorf("Parse(%q) = %dd%d, want %dd%d", tc.spec, dice, sides, tc.dice, tc.sides)
+		}
+	}
+}
+
+// TestRoll tests whether the rolls add up and stay on the dice
+func TestRoll(t *testing.T) {
+	bot := New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		got := bot.roll("alice", "3d4")
+		var a, b, c, total int
+		if _, err := fmt.Sscanf(got, "alice rolled 3d4: %d + %d + %d = %d", &a, &b, &c, &total); err != nil {
+			t.Fatalf("unexpected roll %q: %s", got, err)
+		}
+		for _, n := range []int{a, b, c} {
+			if n < 1 || n > 4 {
+				t.Fatalf("%q: %d is not on a d4", got, n)
+			}
+		}
+		if a+b+c != total {
+			t.Fatalf("%q: the rolls do not add up", got)
+		}
+	}
+	if got := bot.roll("alice", "d1"); !strings.Contains(got, "alice: roll: a die has between 2") {
+		t.Errorf("unexpected answer to a d1: %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"log"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+)
+
+// queueSize is the number of events a conversation keeps while its
+// handlers are busy, the events are dropped once it is full
+const queueSize = 64
+
+// Hooks are the plugins of a public room, the private sessions of the
+// room share them. A nil Hooks has no plugins
+type Hooks struct {
+	room string
+	// closed is closed with the public room, the replies are dropped
+	// afterwards
+	closed  <-chan struct{}
+	plugins []Plugin
+	// bots are the usernames of the bots, the bots do not hear each other
+	bots map[string]bool
+}
+
+// New gathers the plugins of the named room, closed is closed with the
+// room. It returns nil if there are no plugins
+func New(name string, closed <-chan struct{}, plugins []Plugin) *Hooks {
+	if len(plugins) == 0 {
+		return nil
+	}
+	hooks := &Hooks{room: name, closed: closed, plugins: plugins, bots: make(map[string]bool)}
+	for _, plugin := range plugins {
+		hooks.bots[plugin.Bot().Username()] = true
+	}
+	return hooks
+}
+
+// Dispatcher calls the handlers of the plugins for the events of one
+// conversation. A nil Dispatcher drops every event
+type Dispatcher struct {
+	*Hooks
+	session string
+	public  room.Broadcaster
+	events  chan *dispatch
+	done    <-chan struct{}
+}
+
+// Attach starts calling the handlers for the events of a conversation,
+// session is empty for the public room. The handlers reply to the public
+// room, which routes the replies to the session, and stop being called
+// once done is closed
+func (h *Hooks) Attach(session string, public room.Broadcaster, done <-chan struct{}) *Dispatcher {
+	if h == nil {
+		return nil
+	}
+	d := &Dispatcher{
+		Hooks:   h,
+		session: session,
+		public:  public,
+		events:  make(chan *dispatch, queueSize),
+		done:    done,
+	}
+	go d.listen()
+	return d
+}
+
+// Joined tells the plugins that the user joined the conversation
+func (d *Dispatcher) Joined(username string) {
+	if d == nil || d.bots[username] {
+		return
+	}
+	d.fire(&Event{User: username}, func(plugin Plugin, ev *Event) {
+		if handler, ok := plugin.(JoinHandler); ok {
+			handler.OnJoin(ev)
+		}
+	})
+}
+
+// Left tells the plugins that the user left the conversation
+func (d *Dispatcher) Left(username string) {
+	if d == nil || d.bots[username] {
+		return
+	}
+	d.fire(&Event{User: username}, func(plugin Plugin, ev *Event) {
+		if handler, ok := plugin.(LeaveHandler); ok {
+			handler.OnLeave(ev)
+		}
+	})
+}
+
+// Said tells the plugins about a message broadcast in the conversation,
+// the notices and the messages of the bots are left out
+func (d *Dispatcher) Said(mes message.Stamper) {
+	if d == nil {
+		return
+	}
+	author, text, ok := chat(mes)
+	if !ok || d.bots[author] {
+		return
+	}
+	ev := &Event{User: author, ID: mes.Stamp().ID, Text: text}
+	ev.Command, ev.Args, _ = parseCommand(text)
+	d.fire(ev, func(plugin Plugin, ev *Event) {
+		if handler, ok := plugin.(MessageHandler); ok {
+			handler.OnMessage(ev)
+		}
+		if handler, ok := plugin.(CommandHandler); ok && ev.Command != "" {
+			for _, name := range handler.Commands() {
+				if name == ev.Command {
+					handler.OnCommand(ev)
+					break
+				}
+			}
+		}
+	})
+}
+
+// dispatch is an event and the handlers it is given to
+type dispatch struct {
+	*Event
+	call func(Plugin, *Event)
+}
+
+// fire queues the event without waiting for the handlers, the room that
+// fires it is never held up by them
+func (d *Dispatcher) fire(ev *Event, call func(Plugin, *Event)) {
+	ev.Room, ev.Session = d.room, d.session
+	ev.public, ev.done, ev.closed = d.public, d.done, d.closed
+	select {
+	case d.events <- &dispatch{Event: ev, call: call}:
+	default:
+		log.Printf("room #%s: the plugins are busy, an event was dropped", d.room)
+	}
+}
+
+// listen calls the handlers one event at a time until the conversation is
+// closed, every plugin receives its own copy of the event
+func (d *Dispatcher) listen() {
+	for {
+		select {
+		case ev := <-d.events:
+			for _, plugin := range d.plugins {
+				copied := *ev.Event
+				copied.bot = plugin.Bot()
+				ev.call(plugin, &copied)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package plugin lets Go code follow what happens in the rooms and answer
+// as a bot. A Plugin implements the handlers of the events it cares about:
+// MessageHandler, JoinHandler, LeaveHandler and CommandHandler.
+// The handlers of a conversation, a public room or one of its private
+// sessions, are called one at a time in the order the events happened.
+// The handlers of different conversations run at the same time
+package plugin
+
+import (
+	"strings"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+)
+
+// CommandPrefix starts the chat messages that are commands to the bots
+const CommandPrefix = "!"
+
+// Plugin is registered with the server, it answers as its bot
+type Plugin interface {
+	Bot() *Bot
+}
+
+// MessageHandler is told about every chat message, the commands to the
+// bots included
+type MessageHandler interface {
+	OnMessage(*Event)
+}
+
+// JoinHandler is told about the users that join a conversation
+type JoinHandler interface {
+	OnJoin(*Event)
+}
+
+// LeaveHandler is told about the users that leave a conversation
+type LeaveHandler interface {
+	OnLeave(*Event)
+}
+
+// CommandHandler is told about the chat messages that start with
+// !command where command is one of its Commands
+type CommandHandler interface {
+	Commands() []string
+	OnCommand(*Event)
+}
+
+// Event is something that happened in a conversation
+type Event struct {
+	// Room is the public room, Session is the ID of the private session
+	// or empty if the event happened in the room
+	Room    string
+	Session string
+	// User is the username of the user that talked, joined or left
+	User string
+	// ID, Text, Command and Args describe a message. Text is what the
+	// user wrote, Command is the name of a command without its prefix
+	// and Args the rest of the text
+	ID      uint64
+	Text    string
+	Command string
+	Args    string
+
+	bot    *Bot
+	public room.Broadcaster
+	done   <-chan struct{}
+	closed <-chan struct{}
+}
+
+// SessionMessage is what a bot says in a private session, the public room
+// routes it to the session and logs it like the messages of the members
+type SessionMessage struct {
+	message.Message
+	Session string
+}
+
+// Reply says the text as the bot of the plugin in the conversation the
+// event happened in. Nothing is said once the conversation or its public
+// room is closed
+func (ev *Event) Reply(text string) {
+	var mes message.Message = ev.bot.Message(text)
+	if ev.Session != "" {
+		mes = &SessionMessage{Message: mes, Session: ev.Session}
+	}
+	select {
+	case ev.public.Broadcaster() <- mes:
+	case <-ev.done:
+	case <-ev.closed:
+	}
+}
+
+// parseCommand splits a command to the bots into its name and its
+// arguments, ok is not set if the text is not a command
+func parseCommand(text string) (name, args string, ok bool) {
+	if !strings.HasPrefix(text, CommandPrefix) {
+		return "", "", false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(text, CommandPrefix), " ", 2)
+	if fields[0] == "" {
+		return "", "", false
+	}
+	if len(fields) == 2 {
+		args = strings.TrimSpace(fields[1])
+	}
+	return fields[0], args, true
+}
+
+// chat finds the author and the text of a chat message, ok is not set for
+// the notices and the updates
+func chat(mes message.Stamper) (author, text string, ok bool) {
+	if _, update := mes.(*message.Update); update {
+		return "", "", false
+	}
+	author = mes.Stamp().Author
+	var inner message.Message = mes
+	if stamped, ok := mes.(*message.Stamped); ok {
+		inner = stamped.Message
+	}
+	body, ok := inner.(interface {
+		Text() string
+	})
+	if !ok || author == "" {
+		return "", "", false
+	}
+	return author, body.Text(), true
+}
@@ -2,32 +2,55 @@ package private
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
 	"github.com/iocat/rutgers-cs352/pa1/model/message"
 	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
 )
 
+var tagColor = color.New(color.DisplayBold, color.FgCyan, color.BgBlack)
+
+// Room is a private session hosted by its owner. The members stay in the
+// public room while they talk in the session, the public room decides
+// which of them joins or leaves
 type Room struct {
+	id           string
 	adder        chan room.User
-	remover      chan *UserRemoveOperation
 	releaser     chan *sync.WaitGroup
 	broadcaster  chan message.Message
 	owner        room.User
 	guessWhoChan chan *whoOperation
 
-	removerWg sync.WaitGroup
-	toRemove  chan string
+	toRemove  chan *removeOperation
 	countChan chan *countOperation
 
 	close chan struct{}
 
 	users map[string]room.User
+
+	plugins *plugin.Dispatcher
+}
+
+// Message is a message broadcast in a private session, it is tagged with
+// the ID of the session
+type Message struct {
+	message.Stamper
+	Conversation string
+}
+
+// String implements the message.Message interface
+func (m *Message) String() string {
+	return fmt.Sprintf("%s[%s]%s %s", tagColor.String(), m.Conversation,
+		color.Reset.String(), m.Stamper.String())
 }
 
-type UserRemoveOperation struct {
+type removeOperation struct {
 	sync.WaitGroup
-	room.User
+	username string
+	found    bool
 }
 
 type countOperation struct {
@@ -49,7 +72,8 @@ func (r *Room) WhosThere() []room.User {
 	return wo.people
 }
 
-// Release removes every users
+// Release removes every users and closes the room, it cannot be used
+// afterwards
 func (r *Room) Release() {
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -62,18 +86,14 @@ func (r *Room) Adder() chan<- room.User {
 	return r.adder
 }
 
-// Remover returns a remover channel that removes users
-func (r *Room) Remover() <-chan *UserRemoveOperation {
-	return r.remover
-}
-
-// Remove removes a user with username
-// a call to remove have to wait until a user
-// had completely removed from room
-func (r *Room) Remove(username string) {
-	r.removerWg.Add(1)
-	r.toRemove <- username
-	r.removerWg.Wait()
+// Remove removes a user with username, it reports whether the user was
+// in the room
+func (r *Room) Remove(username string) bool {
+	op := removeOperation{username: username}
+	op.Add(1)
+	r.toRemove <- &op
+	op.Wait()
+	return op.found
 }
 
 // Broadcaster asks to receive new message
@@ -86,20 +106,27 @@ func (r *Room) Owner() room.User {
 	return r.owner
 }
 
-// New returns a new room
-func New(user room.User) *Room {
+// ID returns the ID of the session, it is unique in the public room
+func (r *Room) ID() string {
+	return r.id
+}
+
+// New returns a new room, the plugins of the public room are told what
+// happens in it and reply through the public room. hooks may be nil
+func New(id string, user room.User, hooks *plugin.Hooks, public room.Broadcaster) *Room {
 	r := &Room{
+		id:           id,
 		owner:        user,
 		guessWhoChan: make(chan *whoOperation),
 		adder:        make(chan room.User),
-		toRemove:     make(chan string),
+		toRemove:     make(chan *removeOperation),
 		broadcaster:  make(chan message.Message),
 		close:        make(chan struct{}),
-		remover:      make(chan *UserRemoveOperation),
 		users:        make(map[string]room.User),
 		releaser:     make(chan *sync.WaitGroup),
 		countChan:    make(chan *countOperation),
 	}
+	r.plugins = hooks.Attach(id, public, r.close)
 	go r.listen()
 	return r
 }
@@ -113,21 +140,9 @@ func (r *Room) Count() int {
 	return op.count
 }
 
-func (r *Room) removeUser(user room.User) {
-	op := UserRemoveOperation{
-		User: user,
-	}
-	op.Add(1)
-	r.remover <- &op
-	op.Wait()
-}
-
 // listen listens to incoming request and sends user out of the room
 func (r *Room) listen() {
-	defer close(r.adder)
-	defer close(r.toRemove)
-	defer close(r.broadcaster)
-loop:
+	defer close(r.close)
 	for {
 		select {
 		case op := <-r.countChan:
@@ -143,30 +158,35 @@ loop:
 				sendError(user.Error(), errors.New("add user: username existed"))
 			} else {
 				r.users[user.Username()] = user
+				r.plugins.Joined(user.Username())
 			}
-		case username := <-r.toRemove:
-			var (
-				user room.User
-				ok   bool
-			)
-			if user, ok = r.users[username]; ok {
-				delete(r.users, username)
-				r.removeUser(user)
+		case op := <-r.toRemove:
+			_, op.found = r.users[op.username]
+			delete(r.users, op.username)
+			if op.found {
+				r.plugins.Left(op.username)
 			}
-			r.removerWg.Done()
+			op.Done()
 		case mes := <-r.broadcaster:
+			// the updates refer to the message by its ID
+			var tagged message.Message = mes
+			var stamped message.Stamper
+			if _, ok := mes.(*message.Update); !ok {
+				stamped = message.NewStamped(mes)
+				tagged = &Message{Stamper: stamped, Conversation: r.id}
+			}
 			for _, usr := range r.users {
-				usr.Receive(mes)
+				usr.Receive(tagged)
+			}
+			if stamped != nil {
+				r.plugins.Said(stamped)
 			}
 		case wg := <-r.releaser:
-			for username, user := range r.users {
+			for username := range r.users {
 				delete(r.users, username)
-				r.removeUser(user)
 			}
 			wg.Done()
-		case <-r.close:
-			// Release all users
-			break loop
+			return
 		}
 	}
 }
@@ -178,7 +198,7 @@ func sendError(errChan chan<- error, err error) {
 	}()
 }
 
-// Done signifies the room  when it needs to be closed and removes everyone
-func (r *Room) Done() chan struct{} {
+// Done is closed once the room is released
+func (r *Room) Done() <-chan struct{} {
 	return r.close
 }
@@ -0,0 +1,153 @@
+package public
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+)
+
+var editedMark = fmt.Sprintf("%s (edited)%s",
+	color.New(color.DisplayFaint, color.FgWhite, color.BgBlack).String(), color.Reset.String())
+
+type editOperation struct {
+	sync.WaitGroup
+	editor    room.User
+	username  string
+	moderator bool
+	id        uint64
+	text      string
+	deleted   bool
+	entry     history.Entry
+	err       error
+}
+
+// Edit replaces the text of a message, only its author or a moderator
+// may edit it. Everyone in the conversation of the message is told
+func (r *Room) Edit(editor room.User, moderator bool, id uint64, text string) error {
+	op := editOperation{editor: editor, moderator: moderator, id: id, text: text}
+	op.Add(1)
+	r.editChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Delete deletes a message, only its author or a moderator may delete it.
+// Everyone in the conversation of the message is told
+func (r *Room) Delete(editor room.User, moderator bool, id uint64) error {
+	op := editOperation{editor: editor, moderator: moderator, id: id, deleted: true}
+	op.Add(1)
+	r.editChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Find returns a message the user can see, either in the room or in one
+// of the private sessions of the user
+func (r *Room) Find(username string, id uint64) (history.Entry, error) {
+	op := editOperation{username: username, id: id}
+	op.Add(1)
+	r.findChan <- &op
+	op.Wait()
+	return op.entry, op.err
+}
+
+// entry turns a stamped message into a history entry, the body of the
+// messages written by users is kept so that they can be edited
+func entry(mes message.Stamper) history.Entry {
+	stamp := mes.Stamp()
+	e := history.Entry{
+		ID:       stamp.ID,
+		Time:     stamp.Time,
+		Author:   stamp.Author,
+		ReplyTo:  stamp.ReplyTo,
+		Mentions: stamp.Mentions,
+		Text:     mes.String(),
+	}
+	var inner message.Message = mes
+	if stamped, ok := mes.(*message.Stamped); ok {
+		inner = stamped.Message
+	}
+	if body, ok := inner.(interface {
+		Text() string
+	}); ok && stamp.Author != "" {
+		e.Body = body.Text()
+	}
+	return e
+}
+
+// conversation finds the store that keeps the message and a function
+// that delivers to its conversation. The private sessions are searched
+// only if the user is one of their members
+func (r *Room) conversation(username string, id uint64) (history.Store, func(message.Message), *history.Entry, bool) {
+	if e, ok := r.history.Find(id); ok {
+		return r.history, r.broadcast, e, true
+	}
+	for sid, store := range r.sessionLogs {
+		if e, ok := store.Find(id); ok && r.inSession(sid, username) {
+			session := r.privates[sid]
+			return store, func(mes message.Message) {
+				session.Broadcaster() <- mes
+			}, e, true
+		}
+	}
+	return nil, nil, nil, false
+}
+
+// sessionOf finds the private session that keeps the message, it is
+// empty if the room keeps it
+func (r *Room) sessionOf(id uint64) string {
+	for sid, store := range r.sessionLogs {
+		if _, ok := store.Find(id); ok {
+			return sid
+		}
+	}
+	return ""
+}
+
+func (r *Room) find(username string, id uint64) (history.Entry, error) {
+	_, _, e, ok := r.conversation(username, id)
+	if !ok {
+		return history.Entry{}, fmt.Errorf("there is no message #%d", id)
+	}
+	return *e, nil
+}
+
+func (r *Room) edit(op *editOperation) error {
+	store, deliver, e, ok := r.conversation(op.editor.Username(), op.id)
+	if !ok {
+		return fmt.Errorf("there is no message #%d", op.id)
+	} else if e.Author == "" {
+		return fmt.Errorf("message #%d was not written by a user", op.id)
+	} else if e.Author != op.editor.Username() && !op.moderator {
+		return fmt.Errorf("only the author or a moderator can change message #%d", op.id)
+	}
+	updated := *e
+	if op.deleted {
+		updated.Text, updated.Body, updated.Deleted = "", "", true
+	} else {
+		updated.Text, updated.Body, updated.Edited = rewrite(e, op.text), op.text, true
+	}
+	if err := store.Update(updated); err != nil {
+		log.Printf("room #%s: %s", r.name, err)
+		return err
+	}
+	deliver(&message.Update{Stamper: &updated, Deleted: op.deleted})
+	return nil
+}
+
+// rewrite replaces the body of the message in its decorated text and
+// marks it as edited
+func rewrite(e *history.Entry, body string) string {
+	text := strings.TrimSuffix(e.Text, editedMark)
+	i := strings.LastIndex(text, e.Body)
+	if e.Body == "" || i < 0 {
+		return text + editedMark
+	}
+	return text[:i] + body + text[i+len(e.Body):] + editedMark
+}
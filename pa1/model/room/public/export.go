@@ -1,53 +1,44 @@
 package public
 
 import (
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
 	"github.com/iocat/rutgers-cs352/pa1/model/message"
 	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
 )
 
+// Name returns the name of the room
+func (r *Room) Name() string {
+	return r.name
+}
+
 // Remover returns a user channel that the client code waits
 func (r *Room) Remover() <-chan room.User {
 	return r.userRemover
 }
 
 // WhoIsOnline gets 2 lists :
-// the ones that are in public room and the ones that are not
+// everyone in the public room and the ones that are also in a private
+// session. Both lists are empty once the room is closed
 func (r *Room) WhoIsOnline() (public []room.User, private []room.User) {
 	wo := whoOperation{}
 	wo.WaitGroup.Add(1)
 	// Send the operation then wait
-	r.whoChan <- &wo
-	wo.WaitGroup.Wait()
-	return wo.whoOnline.public, wo.whoOnline.private
-}
-
-func (r *Room) PrivateAdder() chan<- RoomWithOwner {
-	return r.adder
-}
-
-func (r *Room) PrivateRemove(host room.User) {
-	r.toRemove <- host
-}
-
-type MigrationOperation struct {
-	host     room.User
-	username string
-}
-
-func (r *Room) ToPrivate(host room.User, username string) {
-	op := MigrationOperation{
-		host:     host,
-		username: username,
+	select {
+	case r.whoChan <- &wo:
+		wo.WaitGroup.Wait()
+	case <-r.close:
 	}
-	r.toPrivate <- &op
+	return wo.whoOnline.public, wo.whoOnline.private
 }
 
-func (r *Room) ToPublic(host room.User, username string) {
-	op := MigrationOperation{
-		host:     host,
-		username: username,
-	}
-	r.toPublic <- &op
+// History returns at most n messages older than the message numbered
+// before. A zero before pages from the oldest message a new user received
+func (r *Room) History(before uint64, n int) ([]*history.Entry, error) {
+	op := historyOperation{before: before, n: n}
+	op.Add(1)
+	r.historyChan <- &op
+	op.Wait()
+	return op.entries, op.err
 }
 
 // Adder returns a masked channel adder
@@ -75,7 +66,22 @@ func (r *Room) Close() {
 	close(r.close)
 }
 
+// SetLimit changes the number of users the room holds, the users already
+// in the room stay
+func (r *Room) SetLimit(limit int) {
+	select {
+	case r.limitChan <- limit:
+	case <-r.close:
+	}
+}
+
 // Done notifies the client code that the room is closed
 func (r *Room) Done() <-chan struct{} {
 	return r.close
 }
+
+// Notification creates a server notification like the ones the room
+// broadcasts itself
+func Notification(mes string) message.Message {
+	return createNotification(mes)
+}
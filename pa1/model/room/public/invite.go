@@ -0,0 +1,228 @@
+package public
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+)
+
+// DefaultInviteExpiry is how long an invite to a private session waits
+// for an answer unless the room is told otherwise
+const DefaultInviteExpiry = 2 * time.Minute
+
+// Invite is an invitation to a private session of the host
+type Invite struct {
+	Session string
+	Host    string
+	Guest   string
+	Expires time.Time
+}
+
+type pendingInvite struct {
+	Invite
+	host room.User
+}
+
+type inviteOperation struct {
+	sync.WaitGroup
+	host     room.User
+	guest    room.User
+	id       string
+	username string
+	err      error
+	invites  []Invite
+}
+
+// Invite invites a user of the room to the private session with the ID,
+// the session must be hosted by the host. The user joins the session
+// once the invite is accepted
+func (r *Room) Invite(host room.User, id, username string) error {
+	op := inviteOperation{host: host, id: id, username: username}
+	op.Add(1)
+	r.inviteChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Accept accepts an invite and adds the guest to the private session, the
+// guest talks in the session afterwards. The invite is named by session
+// ID or by host, it may be empty if only one invite is pending
+func (r *Room) Accept(guest room.User, name string) error {
+	op := inviteOperation{guest: guest, username: name}
+	op.Add(1)
+	r.acceptChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Decline declines an invite named by session ID or by host. The name may
+// be empty if only one invite is pending
+func (r *Room) Decline(guest room.User, name string) error {
+	op := inviteOperation{guest: guest, username: name}
+	op.Add(1)
+	r.declineChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Invites lists the pending invites sent or received by the user
+func (r *Room) Invites(username string) []Invite {
+	op := inviteOperation{username: username}
+	op.Add(1)
+	r.invitesChan <- &op
+	op.Wait()
+	return op.invites
+}
+
+// SetInviteExpiry changes how long the new invites wait for an answer
+func (r *Room) SetInviteExpiry(expiry time.Duration) {
+	select {
+	case r.expiryChan <- expiry:
+	case <-r.close:
+	}
+}
+
+func (r *Room) invite(host room.User, id, username string) error {
+	r.expireInvites()
+	if session, ok := r.privates[id]; !ok || session.Owner().Username() != host.Username() {
+		return fmt.Errorf("invite: you do not host private session %s", id)
+	} else if username == host.Username() {
+		return errors.New("invite: you are already in your private session")
+	}
+	guest, ok := r.users[username]
+	if !ok {
+		return fmt.Errorf("invite: %s is not in #%s", username, r.name)
+	} else if r.inSession(id, username) {
+		return fmt.Errorf("invite: %s is already in private session %s", username, id)
+	}
+	if r.invites[username] == nil {
+		r.invites[username] = make(map[string]*pendingInvite)
+	}
+	r.invites[username][id] = &pendingInvite{
+		Invite: Invite{
+			Session: id,
+			Host:    host.Username(),
+			Guest:   username,
+			Expires: time.Now().Add(r.inviteExpiry),
+		},
+		host: host,
+	}
+	guest.Receive(createNotification(fmt.Sprintf(
+		"%s invites you to a private session (%s). Answer with @accept %s or @decline %s within %s",
+		host.Username(), id, id, id, r.inviteExpiry)))
+	return nil
+}
+
+// pendingFor finds the invite the guest answers, by session ID or by host
+func (r *Room) pendingFor(guest, name string) (*pendingInvite, error) {
+	r.expireInvites()
+	received := r.invites[guest]
+	if len(received) == 0 {
+		return nil, errors.New("you have no pending invite")
+	}
+	if name == "" {
+		if len(received) > 1 {
+			return nil, errors.New("you have several invites, please name the session")
+		}
+		for _, inv := range received {
+			return inv, nil
+		}
+	}
+	if inv, ok := received[name]; ok {
+		return inv, nil
+	}
+	var found *pendingInvite
+	for _, inv := range received {
+		if inv.Host != name {
+			continue
+		} else if found != nil {
+			return nil, fmt.Errorf("%s invited you to several sessions, please name the session", name)
+		}
+		found = inv
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s did not invite you", name)
+	}
+	return found, nil
+}
+
+func (r *Room) removeInvite(guest, id string) {
+	delete(r.invites[guest], id)
+	if len(r.invites[guest]) == 0 {
+		delete(r.invites, guest)
+	}
+}
+
+func (r *Room) accept(guest room.User, name string) error {
+	inv, err := r.pendingFor(guest.Username(), name)
+	if err != nil {
+		return fmt.Errorf("accept: %s", err)
+	}
+	r.removeInvite(inv.Guest, inv.Session)
+	session, ok := r.privates[inv.Session]
+	if !ok {
+		return fmt.Errorf("accept: %s closed the private session", inv.Host)
+	} else if _, ok := r.users[inv.Guest]; !ok {
+		return fmt.Errorf("accept: you are not in #%s", r.name)
+	}
+	session.Adder() <- guest
+	r.active[inv.Guest] = inv.Session
+	session.Broadcaster() <- createNotification(fmt.Sprintf("%s joined the private session.", inv.Guest))
+	return nil
+}
+
+func (r *Room) decline(guest room.User, name string) error {
+	inv, err := r.pendingFor(guest.Username(), name)
+	if err != nil {
+		return fmt.Errorf("decline: %s", err)
+	}
+	r.removeInvite(inv.Guest, inv.Session)
+	inv.host.Receive(createNotification(fmt.Sprintf("%s declined your invite.", inv.Guest)))
+	return nil
+}
+
+func (r *Room) listInvites(username string) []Invite {
+	r.expireInvites()
+	invites := []Invite{}
+	for guest, received := range r.invites {
+		for _, inv := range received {
+			if guest == username || inv.Host == username {
+				invites = append(invites, inv.Invite)
+			}
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].Expires.Before(invites[j].Expires)
+	})
+	return invites
+}
+
+// expireInvites drops the invites that were not answered in time, the
+// hosts are told about it
+func (r *Room) expireInvites() {
+	now := time.Now()
+	for guest, received := range r.invites {
+		for id, inv := range received {
+			if now.After(inv.Expires) {
+				r.removeInvite(guest, id)
+				inv.host.Receive(createNotification(fmt.Sprintf("Your invite to %s expired.", guest)))
+			}
+		}
+	}
+}
+
+// dropInvites drops every invite sent or received by the user
+func (r *Room) dropInvites(username string) {
+	delete(r.invites, username)
+	for guest, received := range r.invites {
+		for id, inv := range received {
+			if inv.Host == username {
+				r.removeInvite(guest, id)
+			}
+		}
+	}
+}
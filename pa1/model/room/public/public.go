@@ -3,13 +3,15 @@ package public
 import (
 	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
 	"github.com/iocat/rutgers-cs352/pa1/model/message"
 	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
-	"github.com/iocat/rutgers-cs352/pa1/model/room/private"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
 )
 
 var (
@@ -24,16 +26,13 @@ var (
 )
 
 type IRoom interface {
+	ID() string
 	Adder() chan<- room.User
-	Remover() <-chan *private.UserRemoveOperation
-	Remove(string)
+	Remove(string) bool
 	Count() int
 	WhosThere() []room.User
 
-	// Done lets the public room knows:
-	// + when the private room is closed
-	// + how to close the private room
-	Done() chan struct{}
+	// Release removes everyone and closes the private room
 	Release()
 	room.Broadcaster
 }
@@ -45,10 +44,13 @@ type RoomWithOwner interface {
 
 // Room represents a public room and control access to the privates
 type Room struct {
-	count int
+	name  string
 	limit int
 
-	messageQueue []message.Message
+	// history keeps the messages broadcast in the room, the newest
+	// replay messages are sent to every new user
+	history history.Store
+	replay  int
 
 	close chan struct{}
 	// 2 channels that mask the underlying adder and remover channel
@@ -58,19 +60,47 @@ type Room struct {
 	broadcaster  chan message.Message
 	userToRemove chan *publicRemoveOperation
 
-	toPrivate chan *MigrationOperation
-	toPublic  chan *MigrationOperation
-
-	whoChan chan *whoOperation
-
-	// errorChan sends error when the public channel encounter such
-	adder    chan RoomWithOwner
-	remover  chan RoomWithOwner
-	counter  chan struct{}
-	toRemove chan room.User
-
-	privates map[string]RoomWithOwner
-	users    map[string]room.User
+	whoChan     chan *whoOperation
+	historyChan chan *historyOperation
+
+	// invites maps a guest to the pending invites it received, keyed by
+	// private session ID
+	invites      map[string]map[string]*pendingInvite
+	inviteExpiry time.Duration
+	inviteChan   chan *inviteOperation
+	acceptChan   chan *inviteOperation
+	declineChan  chan *inviteOperation
+	invitesChan  chan *inviteOperation
+	expiryChan   chan time.Duration
+	limitChan    chan int
+
+	// slowMode is how long the users wait between two messages, zero
+	// lets them talk freely
+	slowMode     time.Duration
+	slowModeChan chan *slowModeOperation
+
+	hostChan     chan *sessionOperation
+	switchChan   chan *sessionOperation
+	endChan      chan *sessionOperation
+	sessionsChan chan *sessionOperation
+
+	editChan chan *editOperation
+	findChan chan *editOperation
+
+	// privates maps the private sessions by ID, every member of a
+	// private session is still a user of the room. active maps a user to
+	// the ID of the session the user talks in, the messages of the users
+	// that are not in the map are broadcast in the room
+	privates    map[string]RoomWithOwner
+	sessionLogs map[string]history.Store
+	nextPrivate int
+	active      map[string]string
+	users       map[string]room.User
+
+	// hooks are shared with the private sessions, plugins calls the
+	// handlers for the events of the room
+	hooks   *plugin.Hooks
+	plugins *plugin.Dispatcher
 }
 
 type publicRemoveOperation struct {
@@ -78,6 +108,14 @@ type publicRemoveOperation struct {
 	username string
 }
 
+type historyOperation struct {
+	sync.WaitGroup
+	before  uint64
+	n       int
+	entries []*history.Entry
+	err     error
+}
+
 type whoOperation struct {
 	sync.WaitGroup
 	whoOnline struct {
@@ -86,156 +124,84 @@ type whoOperation struct {
 	}
 }
 
-func New(limit int) *Room {
+// New creates a public room with a name and starts listening to its
+// operations. The room owns the history store and closes it, the plugins
+// are told what happens in the room and its private sessions
+func New(name string, limit int, store history.Store, replay int, plugins ...plugin.Plugin) *Room {
+	closed := make(chan struct{})
 	r := &Room{
-		privates: make(map[string]RoomWithOwner),
-		adder:    make(chan RoomWithOwner),
-		remover:  make(chan RoomWithOwner),
-		toRemove: make(chan room.User),
+		name:        name,
+		history:     store,
+		replay:      replay,
+		privates:    make(map[string]RoomWithOwner),
+		sessionLogs: make(map[string]history.Store),
+		active:      make(map[string]string),
 
 		users:        make(map[string]room.User),
 		userAdder:    make(chan room.User),
 		userRemover:  make(chan room.User),
 		userToRemove: make(chan *publicRemoveOperation),
-		toPublic:     make(chan *MigrationOperation),
-		toPrivate:    make(chan *MigrationOperation),
 
-		close: make(chan struct{}),
+		close: closed,
 
-		counter: make(chan struct{}),
-		limit:   limit,
+		limit: limit,
 
 		broadcaster: make(chan message.Message),
 
-		whoChan: make(chan *whoOperation),
+		whoChan:     make(chan *whoOperation),
+		historyChan: make(chan *historyOperation),
+
+		invites:      make(map[string]map[string]*pendingInvite),
+		inviteExpiry: DefaultInviteExpiry,
+		inviteChan:   make(chan *inviteOperation),
+		acceptChan:   make(chan *inviteOperation),
+		declineChan:  make(chan *inviteOperation),
+		invitesChan:  make(chan *inviteOperation),
+		expiryChan:   make(chan time.Duration),
+		limitChan:    make(chan int),
+		slowModeChan: make(chan *slowModeOperation),
+
+		hostChan:     make(chan *sessionOperation),
+		switchChan:   make(chan *sessionOperation),
+		endChan:      make(chan *sessionOperation),
+		sessionsChan: make(chan *sessionOperation),
+
+		editChan: make(chan *editOperation),
+		findChan: make(chan *editOperation),
+
+		hooks: plugin.New(name, closed, plugins),
+	}
+	r.plugins = r.hooks.Attach("", r, r.close)
+	// the IDs keep increasing after the room kept messages of a previous
+	// run
+	if recent, err := store.Recent(1); err == nil && len(recent) == 1 {
+		message.Observe(recent[0].ID)
 	}
 	go r.listen()
 	return r
 }
 
-func (r *Room) autoRoomMigration(priv RoomWithOwner) {
-loop:
-	for {
-		select {
-		// Private room close
-		case <-priv.Done():
-			break loop
-			// User moves from private room back to public
-		case op := <-priv.Remover():
-			/*	go func(username string, br room.Broadcaster) {
-				// Notify everyone in the private room this user had left
-				br.Broadcaster() <- createNotification(
-					fmt.Sprintf("%s left", username))
-			}(usr.String(), priv)*/
-			r.users[op.User.Username()] = op.User
-			op.User.SetBroadcaster(r)
-			op.Done()
-		}
-	}
-}
-
 func (r *Room) activeUsers() ([]room.User, []room.User) {
 	pub := []room.User{}
 	pri := []room.User{}
+	seen := make(map[string]bool)
 	for _, usr := range r.users {
 		pub = append(pub, usr)
 	}
 	for _, private := range r.privates {
-		pri = append(pri, private.WhosThere()...)
-	}
-
-	return pub, pri
-}
-
-func (r *Room) waitToAddUserToPrivate(host room.User, user string) {
-	<-time.NewTimer(2 * time.Second).C
-	r.ToPrivate(host, user)
-}
-
-func (r *Room) fromPublicToPrivate(host room.User, username string) {
-	if private, ok := r.privates[host.Username()]; !ok {
-		sendError(host.Error(), errors.New("move user to private: you do not host a private session"))
-		return
-	} else if user, ok := r.users[username]; !ok {
-		// The specified user is not in the public room
-		if r.isInPrivate(username) {
-			go r.waitToAddUserToPrivate(host, username)
-			sendError(host.Error(), fmt.Errorf("...wait until the user comes back to public mode"))
-			return
-		}
-		sendError(host.Error(), fmt.Errorf("move user to private: user %s is not in the public room", username))
-		return
-
-	} else {
-		user.SetBroadcaster(private)
-		delete(r.users, username)
-		private.Adder() <- user
-		if user.Username() != host.Username() {
-			user.Receive(
-				createNotification(
-					fmt.Sprintf("You are added to a private session hosted by %s", host.String())))
-		}
-	}
-}
-
-func (r *Room) fromPrivateToPublic(host room.User, username string) {
-	var (
-		ok      bool
-		private RoomWithOwner
-	)
-	if private, ok = r.privates[host.Username()]; !ok {
-		sendError(host.Error(), errors.New("move user to public: you do not host a private session"))
-		return
-	} else if !r.isInPrivate(username) {
-		sendError(host.Error(), fmt.Errorf("%s is not in a private session", username))
-		return
-	}
-	private.Broadcaster() <- createNotification(fmt.Sprintf("%s is removed from the private session.", username))
-	// remove a user hence this user automatically goes back to public
-	private.Remove(username)
-}
-
-func (r *Room) addPrivate(newR RoomWithOwner) {
-	if _, ok := r.privates[newR.Owner().Username()]; ok {
-		sendError(newR.Owner().Error(), fmt.Errorf("no private session created: %s already owned a private session", newR.Owner().Username()))
-		return
-	}
-	// Check every single room to see whether this user is in private session or not
-	r.privates[newR.Owner().Username()] = newR
-	go r.autoRoomMigration(newR)
-
-}
-
-func (r *Room) removePrivate(host string) error {
-	// if this user is hosting a private session
-	if found, ok := r.privates[host]; ok {
-		found.Broadcaster() <- createNotification("Private session closed. Releasing")
-		found.Release()
-		delete(r.privates, host)
-	} else {
-		return errors.New("you are not hosting any private session")
-	}
-	return nil
-}
-
-func (r *Room) isInPrivate(username string) bool {
-	for _, priv := range r.privates {
-		names := priv.WhosThere()
-		for _, name := range names {
-			if name.Username() == username {
-				return true
+		for _, usr := range private.WhosThere() {
+			if !seen[usr.Username()] {
+				seen[usr.Username()] = true
+				pri = append(pri, usr)
 			}
 		}
 	}
-	return false
+
+	return pub, pri
 }
 
 func (r *Room) addUser(user room.User) {
-	r.count = len(r.users)
-	for _, private := range r.privates {
-		r.count += private.Count()
-	}
-	if r.count == r.limit {
+	if len(r.users) >= r.limit {
 		sendError(user.Error(), errors.New("add user: number of user exceeded limit"))
 		return
 	}
@@ -244,10 +210,6 @@ func (r *Room) addUser(user room.User) {
 		sendError(user.Error(), ErrDuplicateUsername)
 		return
 	}
-	if r.isInPrivate(user.Username()) {
-		sendError(user.Error(), ErrDuplicateUsername)
-		return
-	}
 	r.users[user.Username()] = user
 	// The user now send message to this room
 	user.SetBroadcaster(r)
@@ -255,40 +217,57 @@ func (r *Room) addUser(user room.User) {
 	r.broadcast(message.NewConcrete(
 		&color.Reset, fmt.Sprintf("%s is online", user.String())))
 	r.sendLoggedMessages(user)
+	r.plugins.Joined(user.Username())
 }
 
 func (r *Room) sendLoggedMessages(user room.User) {
-	for _, mes := range r.messageQueue {
-		user.Receive(mes)
+	entries, err := r.history.Recent(r.replay)
+	if err != nil {
+		log.Printf("room #%s: %s", r.name, err)
+	}
+	for _, entry := range entries {
+		user.Receive(entry)
+	}
+}
+
+// pageHistory finds at most n messages older than before, a zero before
+// pages from the oldest message a new user received
+func (r *Room) pageHistory(before uint64, n int) ([]*history.Entry, error) {
+	if before == 0 {
+		before = history.Latest
+		if r.replay > 0 {
+			recent, err := r.history.Recent(r.replay)
+			if err != nil || len(recent) == 0 {
+				return nil, err
+			}
+			before = recent[0].Seq
+		}
 	}
+	return r.history.Before(before, n)
 }
 
 func (r *Room) removeUser(username string) {
-	// If the user is not in the public room
-	// then ATTEMPT to get rid of him in every public room
-	if _, ok := r.users[username]; !ok {
-		// If user hosts a private room
-		if private, ok := r.privates[username]; ok {
-			// Host left send message
+	r.dropInvites(username)
+	userToDelete, ok := r.users[username]
+	delete(r.active, username)
+	delete(r.users, username)
+	// close the sessions the user hosts and leave the others
+	for id, private := range r.privates {
+		if private.Owner().Username() == username {
+			r.closePrivate(id, fmt.Sprintf("Host %s left. Closing private session %s.", username, id))
+		} else if private.Remove(username) {
 			private.Broadcaster() <- createNotification(
-				fmt.Sprintf("Host %s left. Closing private session", username))
-			r.removePrivate(username)
-		} else {
-			// If not, go to every single private room and
-			// attempt to remove this user
-			for _, private := range r.privates {
-				private.Remove(username)
-			}
+				fmt.Sprintf("%s left the private session.", username))
 		}
 	}
-	// Then check again, and delete this one from the public room
-	if userToDelete, ok := r.users[username]; ok {
-		delete(r.users, username)
+	if ok {
+		r.plugins.Left(username)
 		r.userRemover <- userToDelete
 	}
 }
 
 func (r *Room) broadcast(mes message.Message) {
+	mes = message.NewStamped(mes)
 	for _, user := range r.users {
 		user.Receive(mes)
 	}
@@ -303,20 +282,45 @@ loop:
 		case wo := <-r.whoChan:
 			wo.whoOnline.public, wo.whoOnline.private = r.activeUsers()
 			wo.WaitGroup.Done()
-		// sends user to private room
-		case op := <-r.toPrivate:
-			r.fromPublicToPrivate(op.host, op.username)
-		// remove user from private room
-		case op := <-r.toPublic:
-			r.fromPrivateToPublic(op.host, op.username)
-		// add new private room
-		case newR := <-r.adder:
-			r.addPrivate(newR)
-		// remove a private room
-		case host := <-r.toRemove:
-			if err := r.removePrivate(host.Username()); err != nil {
-				sendError(host.Error(), err)
+		// host, switch to, end and list the private sessions
+		case op := <-r.hostChan:
+			op.id, op.created, op.err = r.hostPrivate(op.user)
+			op.Done()
+		case op := <-r.switchChan:
+			op.err = r.switchTo(op.user.Username(), op.id)
+			op.Done()
+		case op := <-r.endChan:
+			op.err = r.end(op.user, op.username)
+			op.Done()
+		case op := <-r.sessionsChan:
+			op.sessions, op.id = r.listSessions(op.username)
+			op.Done()
+		// invite a user to a private session and answer the invites
+		case op := <-r.inviteChan:
+			op.err = r.invite(op.host, op.id, op.username)
+			op.Done()
+		case op := <-r.acceptChan:
+			op.err = r.accept(op.guest, op.username)
+			op.Done()
+		case op := <-r.declineChan:
+			op.err = r.decline(op.guest, op.username)
+			op.Done()
+		case op := <-r.invitesChan:
+			op.invites = r.listInvites(op.username)
+			op.Done()
+		case expiry := <-r.expiryChan:
+			r.inviteExpiry = expiry
+		case limit := <-r.limitChan:
+			r.limit = limit
+		case op := <-r.slowModeChan:
+			if op.set {
+				r.slowMode = op.delay
+			}
+			op.delay = r.slowMode
+			if _, inSession := r.conversationOf(op.author, op.replyTo); inSession {
+				op.delay = 0
 			}
+			op.Done()
 		// add new user to the public room
 		case user := <-r.userAdder:
 			r.addUser(user)
@@ -324,19 +328,34 @@ loop:
 		case op := <-r.userToRemove:
 			r.removeUser(op.username)
 			op.Done()
+		// edit, delete and find the messages
+		case op := <-r.editChan:
+			op.err = r.edit(op)
+			op.Done()
+		case op := <-r.findChan:
+			op.entry, op.err = r.find(op.username, op.id)
+			op.Done()
+		// page through the history
+		case op := <-r.historyChan:
+			op.entries, op.err = r.pageHistory(op.before, op.n)
+			op.Done()
 		// broadcast a message
 		case mes := <-r.broadcaster:
-			r.log(mes)
-			r.broadcast(mes)
+			r.route(mes)
 		// room closed stop doing everything
 		case <-r.close:
+			if err := r.history.Close(); err != nil {
+				log.Printf("room #%s: close history: %s", r.name, err)
+			}
 			break loop
 		}
 	}
 }
 
-func (r *Room) log(mes message.Message) {
-	r.messageQueue = append(r.messageQueue, mes)
+func (r *Room) log(store history.Store, mes message.Stamper) {
+	if _, err := store.Append(entry(mes)); err != nil {
+		log.Printf("room #%s: %s", r.name, err)
+	}
 }
 
 func createNotification(mes string) message.Message {
@@ -347,10 +366,6 @@ func createNotification(mes string) message.Message {
 			color.Green.String(), "SERVER: ", mes, color.Reset.String()))
 }
 
-func closePrivate(r RoomWithOwner) {
-	r.Done() <- struct{}{}
-}
-
 func sendError(errChan chan<- error, err error) {
 	// non-blocking error receiving
 	go func() {
@@ -0,0 +1,256 @@
+package public
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/private"
+)
+
+// Session describes a private session of the room
+type Session struct {
+	ID      string
+	Host    string
+	Members []string
+}
+
+type sessionOperation struct {
+	sync.WaitGroup
+	user     room.User
+	username string
+	id       string
+	created  bool
+	err      error
+	sessions []Session
+}
+
+// HostPrivate returns the ID of the private session the host talks in,
+// a new session is created if the host does not talk in a session of its
+// own. The host talks in the session afterwards
+func (r *Room) HostPrivate(host room.User) (id string, created bool, err error) {
+	op := sessionOperation{user: host}
+	op.Add(1)
+	r.hostChan <- &op
+	op.Wait()
+	return op.id, op.created, op.err
+}
+
+// Switch makes the user talk in the private session with the ID, an empty
+// ID or the name of the room makes the user talk in the room again
+func (r *Room) Switch(usr room.User, id string) error {
+	op := sessionOperation{user: usr, id: id}
+	op.Add(1)
+	r.switchChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// End removes a user from the private session the host talks in. An
+// empty username closes the session if the user hosts it or leaves it
+// otherwise
+func (r *Room) End(usr room.User, username string) error {
+	op := sessionOperation{user: usr, username: username}
+	op.Add(1)
+	r.endChan <- &op
+	op.Wait()
+	return op.err
+}
+
+// Sessions lists the private sessions of the room and the ID of the
+// session the user talks in, the ID is empty if the user talks in the
+// room. A closed room has no sessions
+func (r *Room) Sessions(username string) (sessions []Session, active string) {
+	op := sessionOperation{username: username}
+	op.Add(1)
+	select {
+	case r.sessionsChan <- &op:
+		op.Wait()
+	case <-r.close:
+	}
+	return op.sessions, op.id
+}
+
+// route stamps the message and sends it to the conversation its author
+// talks in, a reply goes to the conversation of the message it answers and
+// a bot says its session messages in their session. The other messages
+// are broadcast in the room
+func (r *Room) route(mes message.Message) {
+	said, bot := mes.(*plugin.SessionMessage)
+	if bot {
+		mes = said.Message
+	}
+	stamped := message.NewStamped(mes)
+	stamp := stamped.Stamp()
+	id, ok := r.conversationOf(stamp.Author, stamp.ReplyTo)
+	if bot {
+		// the session may be closed since the bot was told
+		id = said.Session
+		if _, ok = r.privates[id]; !ok {
+			return
+		}
+	}
+	if ok {
+		r.log(r.sessionLogs[id], stamped)
+		r.privates[id].Broadcaster() <- stamped
+		return
+	}
+	r.log(r.history, stamped)
+	r.broadcast(stamped)
+	r.plugins.Said(stamped)
+}
+
+// conversationOf returns the private session a message of the author goes
+// to, the session of the message a reply answers or the one the author
+// talks in. ok is false for the messages of the room
+func (r *Room) conversationOf(author string, replyTo uint64) (id string, ok bool) {
+	if replyTo != 0 {
+		id = r.sessionOf(replyTo)
+		return id, id != ""
+	}
+	id, ok = r.active[author]
+	return id, ok
+}
+
+func (r *Room) hostPrivate(host room.User) (string, bool, error) {
+	if _, ok := r.users[host.Username()]; !ok {
+		return "", false, fmt.Errorf("private session not created: you are not in #%s", r.name)
+	}
+	if id, ok := r.active[host.Username()]; ok && r.privates[id].Owner().Username() == host.Username() {
+		return id, false, nil
+	}
+	r.nextPrivate++
+	id := fmt.Sprintf("p%d", r.nextPrivate)
+	session := private.New(id, host, r.hooks, r)
+	r.privates[id] = session
+	r.sessionLogs[id] = history.NewMemory(history.Retention{})
+	session.Adder() <- host
+	r.active[host.Username()] = id
+	return id, true, nil
+}
+
+func (r *Room) switchTo(username, id string) error {
+	if id == "" || id == r.name {
+		delete(r.active, username)
+		return nil
+	}
+	if _, ok := r.privates[id]; !ok {
+		return fmt.Errorf("switch: there is no private session %s", id)
+	} else if !r.inSession(id, username) {
+		return fmt.Errorf("switch: you are not in private session %s", id)
+	}
+	r.active[username] = id
+	return nil
+}
+
+func (r *Room) end(usr room.User, username string) error {
+	id, ok := r.active[usr.Username()]
+	if !ok {
+		return errors.New("end: you are not talking in a private session, @switch to one first")
+	}
+	session := r.privates[id]
+	host := session.Owner().Username() == usr.Username()
+	switch {
+	case username == "" && host:
+		r.closePrivate(id, fmt.Sprintf("Private session %s closed.", id))
+	case username == "":
+		r.leavePrivate(id, usr.Username())
+		session.Broadcaster() <- createNotification(
+			fmt.Sprintf("%s left the private session.", usr.Username()))
+	case !host:
+		return errors.New("end: only the host removes users from a private session")
+	case username == usr.Username():
+		return errors.New("end: use @end alone to close your private session")
+	case !r.leavePrivate(id, username):
+		return fmt.Errorf("end: %s is not in private session %s", username, id)
+	default:
+		session.Broadcaster() <- createNotification(
+			fmt.Sprintf("%s is removed from the private session.", username))
+		if removed, ok := r.users[username]; ok {
+			removed.Receive(createNotification(
+				fmt.Sprintf("You are removed from private session %s.", id)))
+		}
+	}
+	return nil
+}
+
+func (r *Room) listSessions(username string) ([]Session, string) {
+	sessions := []Session{}
+	for id, session := range r.privates {
+		s := Session{ID: id, Host: session.Owner().Username()}
+		for _, usr := range session.WhosThere() {
+			s.Members = append(s.Members, usr.Username())
+		}
+		sort.Strings(s.Members)
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessionNumber(sessions[i].ID) < sessionNumber(sessions[j].ID)
+	})
+	return sessions, r.active[username]
+}
+
+// sessionNumber orders the sessions the way they were created
+func sessionNumber(id string) int {
+	var n int
+	fmt.Sscanf(id, "p%d", &n)
+	return n
+}
+
+// closePrivate releases the session, its members talk in the room again
+func (r *Room) closePrivate(id, reason string) {
+	session := r.privates[id]
+	session.Broadcaster() <- createNotification(reason)
+	for _, usr := range session.WhosThere() {
+		r.leaveActive(usr.Username(), id)
+	}
+	session.Release()
+	delete(r.privates, id)
+	delete(r.sessionLogs, id)
+	for guest, received := range r.invites {
+		if _, ok := received[id]; ok {
+			r.removeInvite(guest, id)
+		}
+	}
+}
+
+// leavePrivate removes the user from the session, it reports whether the
+// user was in the session
+func (r *Room) leavePrivate(id, username string) bool {
+	if !r.privates[id].Remove(username) {
+		return false
+	}
+	r.leaveActive(username, id)
+	return true
+}
+
+// leaveActive makes the user talk in the room again if the user talked
+// in the session
+func (r *Room) leaveActive(username, id string) {
+	if r.active[username] != id {
+		return
+	}
+	delete(r.active, username)
+	if usr, ok := r.users[username]; ok {
+		usr.Receive(createNotification(fmt.Sprintf("You are talking in #%s again.", r.name)))
+	}
+}
+
+// inSession checks whether the user is in the private session
+func (r *Room) inSession(id, username string) bool {
+	session, ok := r.privates[id]
+	if !ok {
+		return false
+	}
+	for _, usr := range session.WhosThere() {
+		if usr.Username() == username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package public
+
+import (
+	"sync"
+	"time"
+)
+
+type slowModeOperation struct {
+	sync.WaitGroup
+	set   bool
+	delay time.Duration
+	// author and replyTo name the message the delay is asked for
+	author  string
+	replyTo uint64
+}
+
+// SetSlowMode makes the users wait between two messages in the room, zero
+// turns the slow mode off
+func (r *Room) SetSlowMode(delay time.Duration) {
+	r.slowModeOperation(&slowModeOperation{set: true, delay: delay})
+}
+
+// SlowMode returns how long the users wait between two messages, zero if
+// the slow mode is off
+func (r *Room) SlowMode() time.Duration {
+	op := &slowModeOperation{}
+	r.slowModeOperation(op)
+	return op.delay
+}
+
+// SlowModeOf returns how long the author of a message waits before
+// saying it, replyTo is the ID of the message it answers or zero. The
+// messages said in a private session are not slowed down
+func (r *Room) SlowModeOf(author string, replyTo uint64) time.Duration {
+	op := &slowModeOperation{author: author, replyTo: replyTo}
+	r.slowModeOperation(op)
+	return op.delay
+}
+
+func (r *Room) slowModeOperation(op *slowModeOperation) {
+	op.Add(1)
+	select {
+	case r.slowModeChan <- op:
+		op.Wait()
+	case <-r.close:
+	}
+}
@@ -11,7 +11,6 @@
 package user
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/iocat/rutgers-cs352/pa1/model/color"
@@ -24,6 +23,8 @@ type User interface {
 	Color() *color.Color
 	Username() string
 	Message(string) message.Message
+	Whisper(to, mes string) message.Message
+	Reply(to uint64, quote, mes string) message.Message
 	String() string
 }
 
@@ -31,6 +32,8 @@ type User interface {
 type ConcreteUser struct {
 	color    *color.Color
 	username string
+	// guest is set when the user did not log in to an account
+	guest bool
 }
 
 // Message is the user's Message type that decorates the ConcreteMessage
@@ -53,6 +56,11 @@ func (um *Message) String() string {
 		color.Reset.String())
 }
 
+// Username returns the username of the author
+func (um *Message) Username() string {
+	return um.username
+}
+
 // Message creates a chat message which included the username
 func (usr *ConcreteUser) Message(mes string) message.Message {
 	return &Message{
@@ -61,6 +69,85 @@ func (usr *ConcreteUser) Message(mes string) message.Message {
 	}
 }
 
+// Whisper is a direct message sent from one user to another, it decorates
+// the user's Message
+type Whisper struct {
+	Message
+	to string
+}
+
+var whisperColor = color.New(color.DisplayFaint, color.FgMagenta, color.BgBlack)
+
+// String prints the message like a user message, prefixed with the
+// receiver in a faint magenta
+func (wm *Whisper) String() string {
+	return fmt.Sprintf("%s(whisper to %s)%s %s",
+		whisperColor.String(),
+		wm.to,
+		color.Reset.String(),
+		wm.Message.String())
+}
+
+// To returns the username of the receiver
+func (wm *Whisper) To() string {
+	return wm.to
+}
+
+// Whisper creates a direct message to the user named to
+func (usr *ConcreteUser) Whisper(to, mes string) message.Message {
+	return &Whisper{
+		Message: Message{
+			ConcreteMessage: *message.NewConcrete(usr.color, mes),
+			username:        usr.username,
+		},
+		to: to,
+	}
+}
+
+// Reply is a message that answers an earlier message, it decorates the
+// user's Message with a quote of the earlier one
+type Reply struct {
+	Message
+	to    uint64
+	quote string
+}
+
+var quoteColor = color.New(color.DisplayFaint, color.FgWhite, color.BgBlack)
+
+// String prints the message like a user message, prefixed with the quote
+// in a faint white
+func (rm *Reply) String() string {
+	return fmt.Sprintf("%s(re #%d %s)%s %s",
+		quoteColor.String(),
+		rm.to,
+		rm.quote,
+		color.Reset.String(),
+		rm.Message.String())
+}
+
+// ReplyTo returns the ID of the message the reply answers
+func (rm *Reply) ReplyTo() uint64 {
+	return rm.to
+}
+
+// Quote returns the quote of the message the reply answers
+func (rm *Reply) Quote() string {
+	return rm.quote
+}
+
+// Reply creates a message that answers the message with the ID, the quote
+// reminds the readers of it
+func (usr *ConcreteUser) Reply(to uint64, quote, mes string) message.Message {
+	return &Reply{
+		Message: Message{
+			ConcreteMessage: *message.NewConcrete(usr.color, mes),
+			username:        usr.username,
+		},
+		to:    to,
+		quote: quote,
+	}
+}
+
 // MessageHandler represents a function that
 // receives a message and do something with it
 type MessageHandler func(message.Message)
@@ -74,9 +161,6 @@ func New(
 	col *color.Color,
 	messageHandler MessageHandler,
 ) (*ConcreteUser, error) {
-	if len(username) > 100 {
-		return nil, errors.New("username is longer than 100 characters")
-	}
 	usr := ConcreteUser{
 		username: username,
 		color:    col,
@@ -85,6 +169,26 @@ func New(
 	return &usr, nil
 }
 
+// NewGuest creates a user that did not log in to an account, the name
+// is printed with a guest marker
+func NewGuest(
+	username string,
+	col *color.Color,
+	messageHandler MessageHandler,
+) (*ConcreteUser, error) {
+	usr, err := New(username, col, messageHandler)
+	if err != nil {
+		return nil, err
+	}
+	usr.guest = true
+	return usr, nil
+}
+
+// Guest checks whether the user did not log in to an account
+func (usr *ConcreteUser) Guest() bool {
+	return usr.guest
+}
+
 // Username returns the username of the user
 func (usr *ConcreteUser) Username() string {
 	return usr.username
@@ -95,7 +199,14 @@ func (usr *ConcreteUser) Color() *color.Color {
 	return usr.color
 }
 
-// Print the username with the predefined color
+var guestColor = color.New(color.DisplayFaint, color.FgWhite, color.BgBlack)
+
+// Print the username with the predefined color, guests are followed by
+// a faint marker
 func (usr *ConcreteUser) String() string {
+	if usr.guest {
+		return fmt.Sprintf("%s%s%s %s(guest)%s", usr.color.String(), usr.username,
+			color.Reset.String(), guestColor.String(), color.Reset.String())
+	}
 	return fmt.Sprintf("%s%s%s", usr.color.String(), usr.username, color.Reset.String())
 }
@@ -2,8 +2,10 @@ package result
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
 )
 
 const (
@@ -18,6 +20,14 @@ const (
 	Exit
 	// Created confirms the user was created
 	Created
+	// Edited replaces the text of the message with the ID
+	Edited
+	// Deleted removes the message with the ID
+	Deleted
+	// Token carries the token that resumes the session of the user
+	Token
+	// File carries a file for the client to save, Name names it
+	File
 )
 
 const (
@@ -29,6 +39,17 @@ const (
 type Result struct {
 	Rtype   int
 	Message string
+	// ID, Time, Author and ReplyTo are the stamp of a chat message, they
+	// are zero for the other results and left out of JSON
+	ID      uint64    `json:",omitempty"`
+	Time    time.Time `json:",omitzero"`
+	Author  string    `json:",omitempty"`
+	ReplyTo uint64    `json:",omitempty"`
+	// Mentioned is set when the chat message mentions the user who
+	// receives it
+	Mentioned bool `json:",omitempty"`
+	// Name is the file name of a File result
+	Name string `json:",omitempty"`
 }
 
 // New creates a new result object
@@ -39,6 +60,23 @@ func New(rtype int, message string) *Result {
 	}
 }
 
+// FromMessage creates a Message result, the stamp of the message travels
+// with it. The updates of a message become Edited and Deleted results
+func FromMessage(mes message.Message) *Result {
+	res := New(Message, mes.String())
+	if update, ok := mes.(*message.Update); ok {
+		res.Rtype = Edited
+		if update.Deleted {
+			res.Rtype = Deleted
+		}
+	}
+	if stamper, ok := mes.(message.Stamper); ok {
+		stamp := stamper.Stamp()
+		res.ID, res.Time, res.Author, res.ReplyTo = stamp.ID, stamp.Time, stamp.Author, stamp.ReplyTo
+	}
+	return res
+}
+
 // Colorize returns a message that has color :))
 func (res *Result) Colorize(col *color.Color) string {
 	return fmt.Sprintf("%s%s%s", col.String(), res.Message, color.Reset.String())
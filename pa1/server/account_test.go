@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestRegisteredNameReserved tests whether a registered name is kept for
+// its owner while the owner is offline
+func TestRegisteredNameReserved(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	alice := handshake(t, reg, seruser.QueueConfig{})
+	aliceResults := alice.results()
+	alice.send(t, command.Register, "alice", "123")
+	waitFor(t, aliceResults, "at least")
+	alice.send(t, command.Register, "alice", "secret")
+	waitFor(t, aliceResults, "Signed in as alice")
+	alice.send(t, command.Exit)
+	waitFor(t, aliceResults, "Signed out")
+	alice.Close()
+
+	guest := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer guest.Close()
+	guestResults := guest.results()
+	waitFor(t, guestResults, "the name is registered")
+	guest.send(t, command.Login, "alice", "wrong!")
+	waitFor(t, guestResults, "wrong username or password")
+	guest.send(t, command.Create, "bob")
+	waitFor(t, guestResults, "Name registering")
+	guest.send(t, command.Who)
+	waitFor(t, guestResults, "(guest)")
+
+	owner := handshake(t, reg, seruser.QueueConfig{})
+	defer owner.Close()
+	ownerResults := owner.results()
+	owner.send(t, command.Login, "alice", "secret")
+	waitFor(t, ownerResults, "Signed in as alice")
+
+	again := handshake(t, reg, seruser.QueueConfig{})
+	defer again.Close()
+	againResults := again.results()
+	again.send(t, command.Login, "alice", "secret")
+	waitFor(t, againResults, "alice is already online")
+}
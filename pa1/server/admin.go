@@ -0,0 +1,335 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// kickReason is what a user kicked through the admin socket is told
+const kickReason = "kicked by the operator"
+
+// State is the state of the server the admin socket dumps
+type State struct {
+	Limit int         `json:"limit"`
+	Rooms []RoomState `json:"rooms"`
+	Users []UserState `json:"users"`
+}
+
+// RoomState describes an open room, Seats counts the users that took a
+// seat including the ones the room waits for to resume
+type RoomState struct {
+	Name     string         `json:"name"`
+	Seats    int            `json:"seats"`
+	Members  []string       `json:"members"`
+	SlowMode Duration       `json:"slow_mode"`
+	Sessions []SessionState `json:"sessions"`
+}
+
+// SessionState describes a private session of a room
+type SessionState struct {
+	Room    string   `json:"room"`
+	ID      string   `json:"id"`
+	Host    string   `json:"host"`
+	Members []string `json:"members"`
+}
+
+// UserState describes a user that picked a name, Sessions are the private
+// sessions the user is a member of
+type UserState struct {
+	Name     string   `json:"name"`
+	Address  string   `json:"address,omitempty"`
+	Room     string   `json:"room"`
+	Sessions []string `json:"sessions,omitempty"`
+	Status   string   `json:"status"`
+}
+
+// stateOperation takes a snapshot of the rooms and the users of the
+// registry, the rooms are queried once the registry let go of it
+type stateOperation struct {
+	sync.WaitGroup
+	limit int
+	rooms []roomSnapshot
+	users []UserState
+}
+
+type roomSnapshot struct {
+	name  string
+	seats int
+	room  *public.Room
+}
+
+// State dumps the rooms, their private sessions and the users
+func (reg *Registry) State() State {
+	op := stateOperation{}
+	op.Add(1)
+	reg.stateChan <- &op
+	op.Wait()
+	state := State{Limit: op.limit, Rooms: []RoomState{}, Users: op.users}
+	sessions := make(map[string][]string)
+	for _, snap := range op.rooms {
+		rs := RoomState{
+			Name:     snap.name,
+			Seats:    snap.seats,
+			Members:  []string{},
+			SlowMode: Duration{snap.room.SlowMode()},
+			Sessions: []SessionState{},
+		}
+		online, _ := snap.room.WhoIsOnline()
+		for _, usr := range online {
+			rs.Members = append(rs.Members, usr.Username())
+		}
+		sort.Strings(rs.Members)
+		all, _ := snap.room.Sessions("")
+		for _, s := range all {
+			rs.Sessions = append(rs.Sessions, SessionState{Room: snap.name, ID: s.ID, Host: s.Host, Members: s.Members})
+			for _, member := range s.Members {
+				sessions[member] = append(sessions[member], s.ID)
+			}
+		}
+		state.Rooms = append(state.Rooms, rs)
+	}
+	for i := range state.Users {
+		state.Users[i].Sessions = sessions[state.Users[i].Name]
+	}
+	sort.Slice(state.Rooms, func(i, j int) bool {
+		return state.Rooms[i].Name < state.Rooms[j].Name
+	})
+	sort.Slice(state.Users, func(i, j int) bool {
+		return state.Users[i].Name < state.Users[j].Name
+	})
+	return state
+}
+
+// snapshot copies the rooms and the users, it never waits for a room so
+// that the registry keeps serving the rooms while they are queried
+func (reg *Registry) snapshot(op *stateOperation) {
+	op.limit = reg.limit
+	for name, entry := range reg.rooms {
+		op.rooms = append(op.rooms, roomSnapshot{name: name, seats: entry.seats, room: entry.room})
+	}
+	op.users = []UserState{}
+	for username, c := range reg.claims {
+		op.users = append(op.users, UserState{
+			Name:    username,
+			Address: address(c.user),
+			Room:    c.room,
+			Status:  seruser.StatusOf(c.user).String(),
+		})
+	}
+}
+
+// address returns the address a user is connected from
+func address(usr room.User) string {
+	conn, ok := usr.(interface {
+		RemoteAddr() net.Addr
+	})
+	if !ok {
+		return ""
+	}
+	return conn.RemoteAddr().String()
+}
+
+// adminError is the body of a refused admin request
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// Broadcast is the body of POST /broadcast
+type Broadcast struct {
+	Text string `json:"text"`
+}
+
+// Kick is the body of POST /kick, the reason may be left out
+type Kick struct {
+	User   string `json:"user"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Limit is the body of POST /limit
+type Limit struct {
+	Limit int `json:"limit"`
+}
+
+// AdminHandler serves the admin interface: GET /state, /users, /rooms and
+// /sessions dump the state as JSON, POST /broadcast, /kick and /limit
+// change it
+func AdminHandler(reg *Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", get(func() interface{} {
+		return reg.State()
+	}))
+	mux.HandleFunc("/users", get(func() interface{} {
+		return reg.State().Users
+	}))
+	mux.HandleFunc("/rooms", get(func() interface{} {
+		return reg.State().Rooms
+	}))
+	mux.HandleFunc("/sessions", get(func() interface{} {
+		sessions := []SessionState{}
+		for _, rs := range reg.State().Rooms {
+			sessions = append(sessions, rs.Sessions...)
+		}
+		return sessions
+	}))
+	mux.HandleFunc("/broadcast", post(func(r *http.Request) error {
+		var b Broadcast
+		if err := decode(r, &b); err != nil {
+			return err
+		} else if b.Text == "" {
+			return errors.New("broadcast: the text is empty")
+		}
+		reg.Announce(b.Text)
+		log.Printf("admin: broadcast %q", b.Text)
+		return nil
+	}))
+	mux.HandleFunc("/kick", post(func(r *http.Request) error {
+		var k Kick
+		if err := decode(r, &k); err != nil {
+			return err
+		}
+		if k.Reason == "" {
+			k.Reason = kickReason
+		}
+		if !reg.Kick(k.User, k.Reason) {
+			return fmt.Errorf("kick: %s is not online", k.User)
+		}
+		log.Printf("admin: kicked %s: %s", k.User, k.Reason)
+		return nil
+	}))
+	mux.HandleFunc("/limit", post(func(r *http.Request) error {
+		var l Limit
+		if err := decode(r, &l); err != nil {
+			return err
+		} else if l.Limit <= 0 {
+			return fmt.Errorf("limit: the user limit must be positive, got %d", l.Limit)
+		}
+		reg.SetLimit(l.Limit)
+		log.Printf("admin: the user limit is %d", l.Limit)
+		return nil
+	}))
+	return mux
+}
+
+// get serves the value as JSON
+func get(value func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			reply(w, http.StatusMethodNotAllowed, adminError{"use GET"})
+			return
+		}
+		reply(w, http.StatusOK, value())
+	}
+}
+
+// post runs the action, an empty object is answered once it is done
+func post(action func(*http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			reply(w, http.StatusMethodNotAllowed, adminError{"use POST"})
+			return
+		}
+		if err := action(r); err != nil {
+			reply(w, http.StatusBadRequest, adminError{err.Error()})
+			return
+		}
+		reply(w, http.StatusOK, struct{}{})
+	}
+}
+
+// decode reads the JSON body of the request, the unknown fields are
+// refused
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("read the request: %s", err)
+	}
+	return nil
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("admin: %s", err)
+	}
+}
+
+// listenPrivate creates the Unix socket in a directory only the owner
+// may enter and moves it to path once its mode is 0600, so that no other
+// user may connect before its mode is set
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".admin")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	hidden := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", hidden)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is removed from path instead
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(hidden, 0600); err == nil {
+		err = os.Rename(hidden, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &privateListener{Listener: listener, path: path}, nil
+}
+
+// privateListener removes the socket it was moved to once it is closed
+type privateListener struct {
+	net.Listener
+	path string
+}
+
+func (l *privateListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// StartAdmin serves the admin interface on a Unix socket that only the
+// user running the server may use, a socket left by an earlier run is
+// replaced. It returns ErrServerClosed once the server is shut down
+func (chat *Chat) StartAdmin(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return fmt.Errorf("serve admin: %s", err)
+	}
+	srv := &http.Server{Handler: AdminHandler(chat.rooms)}
+	chat.mu.Lock()
+	select {
+	case <-chat.closing:
+		chat.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	default:
+	}
+	chat.admin = srv
+	chat.mu.Unlock()
+	if err := srv.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("serve admin: %s", err)
+	}
+	return ErrServerClosed
+}
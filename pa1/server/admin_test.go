@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// adminCall sends the request to the admin interface and decodes the
+// answer into v, it returns the status code
+func adminCall(t *testing.T, client *http.Client, url, method, path string, body, v interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, url+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("%s %s: %s", method, path, err)
+	}
+	return res.StatusCode
+}
+
+// TestAdmin tests whether the admin interface lists the users, the rooms
+// and the private sessions and whether it broadcasts, kicks and changes
+// the user limit
+func TestAdmin(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(AdminHandler(reg))
+	defer srv.Close()
+	client := srv.Client()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	alice.send(t, command.Private, "bob")
+	waitFor(t, bobResults, "alice invites you")
+	bob.send(t, command.Accept)
+	waitFor(t, aliceResults, "bob joined the private session.")
+	bob.send(t, command.Join, "dev")
+	waitFor(t, bobResults, "You are now in #dev")
+
+	var users []UserState
+	if status := adminCall(t, client, srv.URL, http.MethodGet, "/users", nil, &users); status != http.StatusOK {
+		t.Fatalf("users: unexpected status %d", status)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[0].Room != lobbyName ||
+		!reflect.DeepEqual(users[0].Sessions, []string{"p1"}) || users[1].Name != "bob" ||
+		users[1].Room != "dev" || users[0].Address == "" || users[0].Status != "online" {
+		t.Errorf("unexpected users %+v", users)
+	}
+	var sessions []SessionState
+	adminCall(t, client, srv.URL, http.MethodGet, "/sessions", nil, &sessions)
+	if len(sessions) != 1 || sessions[0].Room != lobbyName || sessions[0].ID != "p1" ||
+		sessions[0].Host != "alice" {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+	var state State
+	adminCall(t, client, srv.URL, http.MethodGet, "/state", nil, &state)
+	if state.Limit != DefaultUserLimit || len(state.Rooms) != 2 || state.Rooms[0].Name != "dev" ||
+		!reflect.DeepEqual(state.Rooms[0].Members, []string{"bob"}) || state.Rooms[1].Seats != 1 {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	var done struct{}
+	adminCall(t, client, srv.URL, http.MethodPost, "/broadcast", Broadcast{Text: "maintenance at noon"}, &done)
+	waitFor(t, aliceResults, "maintenance at noon")
+	waitFor(t, bobResults, "maintenance at noon")
+
+	adminCall(t, client, srv.URL, http.MethodPost, "/kick", Kick{User: "bob"}, &done)
+	if res := waitForType(t, bobResults, result.Exit); res.Message != "You were "+kickReason {
+		t.Errorf("unexpected exit message %q", res.Message)
+	}
+	var failure adminError
+	if status := adminCall(t, client, srv.URL, http.MethodPost, "/kick", Kick{User: "nobody"}, &failure); status != http.StatusBadRequest ||
+		failure.Error != "kick: nobody is not online" {
+		t.Errorf("unexpected answer to a kick of nobody: %d %+v", status, failure)
+	}
+	if status := adminCall(t, client, srv.URL, http.MethodPost, "/limit", Limit{Limit: 0}, &failure); status != http.StatusBadRequest {
+		t.Errorf("a zero limit was accepted")
+	}
+	if status := adminCall(t, client, srv.URL, http.MethodGet, "/limit", nil, &failure); status != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status %d for GET /limit", status)
+	}
+
+	adminCall(t, client, srv.URL, http.MethodPost, "/limit", Limit{Limit: 1}, &done)
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	defer carol.Close()
+	waitFor(t, carol.results(), ErrRoomFull.Error())
+}
+
+// TestAdminSocket tests whether the admin interface is served on a Unix
+// socket only its owner may use and whether it is closed on shutdown
+func TestAdminSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chat.sock")
+	chat := New("tcp", "127.0.0.1:0", HistoryConfig{}, seruser.QueueConfig{}, nil, nil)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- chat.StartAdmin(path)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	var state State
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("the admin socket was not created")
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected mode of the admin socket: %v %v", info.Mode(), err)
+	}
+	if status := adminCall(t, client, "http://admin", http.MethodGet, "/state", nil, &state); status != http.StatusOK ||
+		len(state.Rooms) != 1 || state.Rooms[0].Name != lobbyName {
+		t.Errorf("unexpected state %d %+v", status, state)
+	}
+
+	chat.SetCountdown(0)
+	if err := chat.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stopped; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the admin socket was left behind: %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+const (
+	// DefaultUserLimit is the number of users a room holds by default
+	DefaultUserLimit = 20
+	// DefaultListen is the address of the terminal clients by default
+	DefaultListen = "localhost:4000"
+	// DefaultReplay is the number of recent messages a new user receives
+	// by default
+	DefaultReplay = 20
+)
+
+// Duration is a time.Duration written like "10m" or "2h" in the config
+// file
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration: %s", err)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// Config is the configuration of a chat server, it is read from a JSON
+// file and every setting has a matching flag. Only the settings Apply
+// changes can be reloaded while the server runs
+type Config struct {
+	// Listen is the address of the terminal clients and Web the one of
+	// the browser clients, the browsers are not served if Web is empty
+	Listen string `json:"listen"`
+	Web    string `json:"web,omitempty"`
+	// Admin is the Unix socket of the admin interface, it is not served
+	// if empty
+	Admin string `json:"admin,omitempty"`
+
+	UserLimit   int      `json:"user_limit"`
+	MaxUsername int      `json:"max_username"`
+	MaxMessage  int      `json:"max_message"`
+	MOTD        string   `json:"motd,omitempty"`
+	IdleAfter   Duration `json:"idle_after"`
+	ResumeGrace Duration `json:"resume_grace"`
+	// InviteExpiry is how long an invite to a private session waits
+	InviteExpiry Duration `json:"invite_expiry"`
+	// Countdown is how long the users are warned before the server
+	// shuts down
+	Countdown Duration `json:"shutdown_countdown"`
+
+	Flood   FloodFile    `json:"flood"`
+	History HistoryFiles `json:"history"`
+	Queue   QueueFile    `json:"queue"`
+	Mailbox MailboxFile  `json:"mailbox"`
+	TLS     TLSFiles     `json:"tls"`
+
+	// Accounts and Bans are the files that keep the registered users and
+	// the bans, they are kept in memory if empty
+	Accounts   string   `json:"accounts,omitempty"`
+	Bans       string   `json:"bans,omitempty"`
+	Owner      string   `json:"owner,omitempty"`
+	Moderators []string `json:"moderators,omitempty"`
+	// Bots are the names of the sample plugins the server runs
+	Bots []string `json:"bots,omitempty"`
+}
+
+// FloodFile is the flood section of the config file, a zero rate is no
+// limit
+type FloodFile struct {
+	// MessageRate is the number of chat messages a user sends per second
+	// on average, MessageBurst the number the user sends at once
+	MessageRate  float64 `json:"message_rate"`
+	MessageBurst int     `json:"message_burst"`
+	CommandRate  float64 `json:"command_rate"`
+	CommandBurst int     `json:"command_burst"`
+	// Strikes is the number of refused commands within a minute that
+	// punishes the user with Action, mute or disconnect
+	Strikes int      `json:"strikes"`
+	Action  string   `json:"action"`
+	MuteFor Duration `json:"mute_for"`
+}
+
+// HistoryFiles is the history section of the config file
+type HistoryFiles struct {
+	// Dir is the folder that keeps the history, it is kept in memory if
+	// empty
+	Dir    string   `json:"dir,omitempty"`
+	Size   int      `json:"size"`
+	Age    Duration `json:"age"`
+	Replay int      `json:"replay"`
+}
+
+// QueueFile is the queue section of the config file
+type QueueFile struct {
+	Size int `json:"size"`
+	// Policy is drop or disconnect
+	Policy string `json:"policy"`
+}
+
+// MailboxFile is the mailbox section of the config file
+type MailboxFile struct {
+	// File keeps the mailboxes, they are kept in memory if empty
+	File string   `json:"file,omitempty"`
+	Size int      `json:"size"`
+	Age  Duration `json:"age"`
+}
+
+// TLSFiles is the TLS section of the config file, the server accepts TLS
+// connections only if Cert is given
+type TLSFiles struct {
+	Cert              string `json:"cert,omitempty"`
+	Key               string `json:"key,omitempty"`
+	ClientCA          string `json:"client_ca,omitempty"`
+	RequireClientCert bool   `json:"require_client_cert,omitempty"`
+}
+
+// DefaultConfig returns the configuration of a server started without a
+// config file nor flags
+func DefaultConfig() Config {
+	return Config{
+		Listen:       DefaultListen,
+		UserLimit:    DefaultUserLimit,
+		MaxUsername:  seruser.DefaultMaxUsername,
+		MaxMessage:   seruser.DefaultMaxMessage,
+		IdleAfter:    Duration{seruser.DefaultIdleAfter},
+		ResumeGrace:  Duration{seruser.DefaultResumeGrace},
+		InviteExpiry: Duration{public.DefaultInviteExpiry},
+		Countdown:    Duration{DefaultCountdown},
+		Flood: FloodFile{
+			MessageRate:  1,
+			MessageBurst: 5,
+			CommandRate:  5,
+			CommandBurst: 20,
+			Strikes:      5,
+			Action:       "mute",
+			MuteFor:      Duration{time.Minute},
+		},
+		History: HistoryFiles{
+			Size:   history.DefaultCount,
+			Replay: DefaultReplay,
+		},
+		Queue: QueueFile{
+			Size:   seruser.DefaultQueueSize,
+			Policy: "drop",
+		},
+		Mailbox: MailboxFile{
+			Size: mailbox.DefaultCount,
+			Age:  Duration{mailbox.DefaultAge},
+		},
+	}
+}
+
+// LoadConfig reads the config file over cfg, the settings the file leaves
+// out keep their value. Unknown settings are refused
+func LoadConfig(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("load config: %s", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("load config %s: %s", path, err)
+	}
+	return cfg.Validate()
+}
+
+// Validate checks the settings that cannot be used as they are
+func (cfg Config) Validate() error {
+	if cfg.UserLimit <= 0 {
+		return fmt.Errorf("config: the user limit must be positive, got %d", cfg.UserLimit)
+	} else if cfg.MaxUsername < 0 || cfg.MaxMessage < 0 {
+		return fmt.Errorf("config: the maximum lengths cannot be negative")
+	} else if cfg.Flood.MessageRate < 0 || cfg.Flood.CommandRate < 0 {
+		return fmt.Errorf("config: the flood rates cannot be negative")
+	} else if cfg.Flood.Action != "mute" && cfg.Flood.Action != "disconnect" {
+		return fmt.Errorf("config: unknown flood action %q, use mute or disconnect", cfg.Flood.Action)
+	} else if _, err := seruser.ParseDropPolicy(cfg.Queue.Policy); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	return nil
+}
+
+// HistoryConfig returns how the rooms keep their history
+func (cfg Config) HistoryConfig() HistoryConfig {
+	return HistoryConfig{
+		Dir: cfg.History.Dir,
+		Retention: history.Retention{
+			MaxCount: cfg.History.Size,
+			MaxAge:   cfg.History.Age.Duration,
+		},
+		Replay: cfg.History.Replay,
+	}
+}
+
+// QueueConfig returns the outbound queue of the users
+func (cfg Config) QueueConfig() (seruser.QueueConfig, error) {
+	policy, err := seruser.ParseDropPolicy(cfg.Queue.Policy)
+	if err != nil {
+		return seruser.QueueConfig{}, err
+	}
+	return seruser.QueueConfig{Size: cfg.Queue.Size, Policy: policy}, nil
+}
+
+// MailboxLimits returns the bounds of the mailboxes
+func (cfg Config) MailboxLimits() mailbox.Limits {
+	return mailbox.Limits{MaxCount: cfg.Mailbox.Size, MaxAge: cfg.Mailbox.Age.Duration}
+}
+
+// Settings returns the limits of the users
+func (cfg Config) Settings() seruser.Settings {
+	return seruser.Settings{
+		MaxUsername: cfg.MaxUsername,
+		MaxMessage:  cfg.MaxMessage,
+		MOTD:        cfg.MOTD,
+		IdleAfter:   cfg.IdleAfter.Duration,
+		ResumeGrace: cfg.ResumeGrace.Duration,
+		Flood: seruser.Flood{
+			MessageRate:  cfg.Flood.MessageRate,
+			MessageBurst: cfg.Flood.MessageBurst,
+			CommandRate:  cfg.Flood.CommandRate,
+			CommandBurst: cfg.Flood.CommandBurst,
+			Strikes:      cfg.Flood.Strikes,
+			Disconnect:   cfg.Flood.Action == "disconnect",
+			MuteFor:      cfg.Flood.MuteFor.Duration,
+		},
+	}
+}
+
+// Load loads the TLS configuration, it is nil if no certificate is given
+func (files TLSFiles) Load() (*tls.Config, error) {
+	if files.Cert == "" {
+		return nil, nil
+	}
+	return LoadTLSConfig(files.Cert, files.Key, files.ClientCA, files.RequireClientCert)
+}
+
+// NeedsRestart lists the settings that differ in next but only take
+// effect once the server restarts
+func (cfg Config) NeedsRestart(next Config) []string {
+	fixed := []struct {
+		name      string
+		old, next interface{}
+	}{
+		{"listen", cfg.Listen, next.Listen},
+		{"web", cfg.Web, next.Web},
+		{"admin", cfg.Admin, next.Admin},
+		{"history", cfg.History, next.History},
+		{"queue", cfg.Queue, next.Queue},
+		{"mailbox", cfg.Mailbox, next.Mailbox},
+		{"tls", cfg.TLS, next.TLS},
+		{"accounts", cfg.Accounts, next.Accounts},
+		{"bans", cfg.Bans, next.Bans},
+		{"owner", cfg.Owner, next.Owner},
+		{"moderators", cfg.Moderators, next.Moderators},
+		{"bots", cfg.Bots, next.Bots},
+	}
+	changed := []string{}
+	for _, setting := range fixed {
+		if !reflect.DeepEqual(setting.old, setting.next) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
+
+// Apply changes the settings that can change while the server runs: the
+// user limit, the limits of the users, the flood limits, the MOTD, the
+// idle detection, the resume grace period, the invite expiry and the
+// shutdown countdown
+func (chat *Chat) Apply(cfg Config) {
+	chat.rooms.SetLimit(cfg.UserLimit)
+	chat.rooms.Configure(cfg.Settings())
+	chat.rooms.SetInviteExpiry(cfg.InviteExpiry.Duration)
+	chat.SetCountdown(cfg.Countdown.Duration)
+}
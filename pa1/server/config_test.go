@@ -0,0 +1,98 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestLoadConfig tests whether the config file overrides the defaults it
+// names only and whether the mistakes in the file are refused
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chat.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"listen": ":9000", "user_limit": 5, "motd": "hi", "idle_after": "2m",
+		"history": {"dir": "logs"}, "moderators": ["max"]}`)
+	cfg := DefaultConfig()
+	if err := LoadConfig(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9000" || cfg.UserLimit != 5 || cfg.MOTD != "hi" ||
+		cfg.IdleAfter.Duration != 2*time.Minute || cfg.History.Dir != "logs" {
+		t.Errorf("the file settings were not loaded: %+v", cfg)
+	}
+	if cfg.History.Replay != DefaultReplay || cfg.MaxUsername != seruser.DefaultMaxUsername {
+		t.Errorf("the settings left out lost their default: %+v", cfg)
+	}
+	if changed := DefaultConfig().NeedsRestart(cfg); !reflect.DeepEqual(changed,
+		[]string{"listen", "history", "moderators"}) {
+		t.Errorf("expected listen, history and moderators to need a restart, got %v", changed)
+	}
+
+	for _, content := range []string{
+		`{"user_limits": 5}`,
+		`{"idle_after": "soon"}`,
+		`{"user_limit": 0}`,
+		`{"queue": {"policy": "wait"}}`,
+		`{"flood": {"action": "ban"}}`,
+	} {
+		write(content)
+		cfg := DefaultConfig()
+		if err := LoadConfig(path, &cfg); err == nil {
+			t.Errorf("expected %s to be refused", content)
+		}
+	}
+}
+
+// TestSettings tests whether the users are held to the limits and
+// whether the settings and the user limit change while they are online
+func TestSettings(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	settings := reg.Settings()
+	settings.MaxUsername = 5
+	settings.MaxMessage = 10
+	settings.MOTD = "Be nice."
+	reg.Configure(settings)
+
+	long := connect(t, reg, seruser.QueueConfig{}, "alexandra")
+	defer long.Close()
+	waitFor(t, long.results(), "longer than 5 characters")
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Be nice.")
+	alice.send(t, command.Send, "this is too long")
+	waitFor(t, aliceResults, "longer than 10 characters")
+	alice.send(t, command.Send, "short")
+	waitFor(t, aliceResults, "short")
+
+	reg.SetLimit(1)
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	waitFor(t, bob.results(), ErrRoomFull.Error())
+
+	settings.MOTD = "Be kind."
+	reg.Configure(settings)
+	reg.SetLimit(2)
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	defer carol.Close()
+	waitFor(t, carol.results(), "Be kind.")
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestEditMessages tests whether the authors edit, delete and answer
+// messages and whether the late joiners see the history as edited
+func TestEditMessages(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{Replay: 5}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	alice.send(t, command.Send, "helo wrld")
+	typo := fmt.Sprint(waitFor(t, bobResults, "helo wrld").ID)
+	alice.send(t, command.Send, "oops")
+	oops := fmt.Sprint(waitFor(t, bobResults, "oops").ID)
+
+	bob.send(t, command.Edit, typo, "hacked")
+	waitFor(t, bobResults, "only the author or a moderator")
+	alice.send(t, command.Edit, "#"+typo, "hello world")
+	edited := waitForType(t, bobResults, result.Edited)
+	if fmt.Sprint(edited.ID) != typo || !strings.Contains(edited.Message, "hello world") {
+		t.Fatalf("edit: expected message %s to read hello world, received %d %q", typo, edited.ID, edited.Message)
+	}
+	alice.send(t, command.Delete, oops)
+	if deleted := waitForType(t, bobResults, result.Deleted); fmt.Sprint(deleted.ID) != oops {
+		t.Fatalf("delete: expected message %s to be deleted, received %d", oops, deleted.ID)
+	}
+
+	bob.send(t, command.Reply, typo, "welcome back")
+	reply := waitFor(t, aliceResults, "welcome back")
+	if fmt.Sprint(reply.ReplyTo) != typo || !strings.Contains(reply.Message, "alice: hello world") {
+		t.Fatalf("reply: expected a reply to %s, received %d %q", typo, reply.ReplyTo, reply.Message)
+	}
+
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	defer carol.Close()
+	carolResults := carol.results()
+	waitWithout(t, carolResults, "hello world", "helo wrld")
+	waitWithout(t, carolResults, "welcome back", "oops")
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestExport tests whether a user receives the history of the room as a
+// file in the format picked
+func TestExport(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	results := alice.results()
+	waitFor(t, results, "Name registering")
+	alice.send(t, command.Send, "first <b>")
+	waitFor(t, results, "first")
+
+	alice.send(t, command.Export)
+	res := waitForType(t, results, result.File)
+	if !strings.HasPrefix(res.Name, lobbyName+"-") || !strings.HasSuffix(res.Name, ".txt") ||
+		!strings.Contains(res.Message, "alice: first <b>") {
+		t.Errorf("unexpected text transcript %s:\n%s", res.Name, res.Message)
+	}
+	alice.send(t, command.Export, "html")
+	res = waitForType(t, results, result.File)
+	if !strings.HasSuffix(res.Name, ".html") || !strings.Contains(res.Message, "first &lt;b&gt;") {
+		t.Errorf("unexpected HTML transcript %s:\n%s", res.Name, res.Message)
+	}
+	alice.send(t, command.Export, "pdf")
+	waitFor(t, results, `export: unknown format "pdf"`)
+}
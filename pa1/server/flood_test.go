@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestFlood tests whether the messages over the limit are refused,
+// whether a flooder is muted and whether a muted flooder is disconnected
+func TestFlood(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	settings := reg.Settings()
+	settings.Flood = seruser.Flood{
+		// nothing is refilled while the test runs
+		MessageRate:  0.001,
+		MessageBurst: 2,
+		Strikes:      3,
+		MuteFor:      time.Minute,
+	}
+	reg.Configure(settings)
+
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	flooder := connect(t, reg, seruser.QueueConfig{}, "flooder")
+	defer flooder.Close()
+	results := flooder.results()
+	waitFor(t, results, "Name registering")
+
+	flooder.send(t, command.Send, "one")
+	waitFor(t, bobResults, "one")
+	flooder.send(t, command.Send, "two")
+	waitFor(t, bobResults, "two")
+	flooder.send(t, command.Send, "three")
+	waitFor(t, results, "slow down: you are sending messages too fast")
+	flooder.send(t, command.Msg, "bob", "four")
+	waitFor(t, results, "slow down")
+	// the other commands are not limited by the message bucket
+	flooder.send(t, command.Who)
+	waitFor(t, results, "bob")
+	flooder.send(t, command.Send, "five")
+	waitFor(t, results, "You were muted for 1m0s for flooding.")
+	waitFor(t, bobResults, "flooder was muted for 1m0s for flooding.")
+
+	for i := 0; i < 3; i++ {
+		flooder.send(t, command.Send, "more")
+	}
+	if res := waitForType(t, results, result.Exit); res.Message != "You were disconnected for flooding" {
+		t.Errorf("unexpected exit message %q", res.Message)
+	}
+	waitFor(t, bobResults, "flooder was disconnected for flooding.")
+}
+
+// TestSlowMode tests whether the members of a room in slow mode wait
+// between two messages while the moderators do not
+func TestSlowMode(t *testing.T) {
+	mod, err := OpenModeration("", "olive", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, mod)
+	defer reg.Close()
+
+	olive := handshake(t, reg, seruser.QueueConfig{})
+	defer olive.Close()
+	oliveResults := olive.results()
+	olive.send(t, command.Register, "olive", "secret")
+	waitFor(t, oliveResults, "Signed in as olive")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	bob.send(t, command.SlowMode, "10")
+	waitFor(t, bobResults, "slowmode: only moderators can do that")
+	olive.send(t, command.SlowMode, "60")
+	waitFor(t, bobResults, "olive turned the slow mode on: one message every 1m0s.")
+	bob.send(t, command.SlowMode)
+	waitFor(t, bobResults, "Slow mode is on in #lobby")
+
+	bob.send(t, command.Send, "first")
+	waitFor(t, oliveResults, "first")
+	bob.send(t, command.Send, "second")
+	waitFor(t, bobResults, "slow mode: wait 1m0s before talking again")
+	olive.send(t, command.Send, "still here")
+	waitFor(t, oliveResults, "still here")
+	olive.send(t, command.Send, "and again")
+	waitFor(t, oliveResults, "and again")
+
+	olive.send(t, command.SlowMode, "off")
+	waitFor(t, bobResults, "olive turned the slow mode off.")
+	bob.send(t, command.Send, "third")
+	waitFor(t, oliveResults, "third")
+}
+
+// TestSlowModePrivate tests whether the messages said in a private
+// session, replies to them included, skip the slow mode of the room
+func TestSlowModePrivate(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	reg.Lobby().SetSlowMode(time.Minute)
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	alice.send(t, command.Send, "anyone?")
+	waitFor(t, bobResults, "anyone?")
+	alice.send(t, command.Send, "hello?")
+	waitFor(t, aliceResults, "slow mode: wait 1m0s before talking again")
+
+	alice.send(t, command.Private, "bob")
+	waitFor(t, bobResults, "alice invites you")
+	bob.send(t, command.Accept)
+	waitFor(t, aliceResults, "bob joined the private session.")
+	alice.send(t, command.Send, "just us")
+	id := waitFor(t, bobResults, "just us").ID
+	alice.send(t, command.Send, "still us")
+	waitFor(t, bobResults, "still us")
+	bob.send(t, command.Switch)
+	waitFor(t, bobResults, "You are talking in #"+lobbyName)
+	bob.send(t, command.Send, "back in the room")
+	waitFor(t, bobResults, "back in the room")
+	bob.send(t, command.Reply, fmt.Sprint(id), "answered in private")
+	waitFor(t, aliceResults, "answered in private")
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+	"github.com/iocat/rutgers-cs352/pa1/server/web"
+)
+
+// TestHelp tests whether the server explains the commands of the
+// registry, before picking a name as well, and whether the server parses
+// the lines the browsers send
+func TestHelp(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	c := handshake(t, reg, seruser.QueueConfig{})
+	defer c.Close()
+	results := c.results()
+
+	c.send(t, command.Help)
+	waitFor(t, results, "@slowmode [seconds|off]")
+	c.send(t, command.Help, "dm")
+	waitFor(t, results, "Sends a direct message to one user.")
+	c.send(t, command.Help, "@nothing")
+	waitFor(t, results, "help: unknown command @nothing")
+	// a name was not needed
+	c.send(t, command.Who)
+	waitFor(t, results, "you didn't pick a username")
+
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+	b := openBrowser(t, srv.URL)
+	defer b.Close()
+	b.send(t, command.Help, "quit")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "success" && strings.HasPrefix(ev.Text, "@exit")
+	})
+	b.sendLine(t, "@help  whisper")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "success" && strings.HasPrefix(ev.Text, "@msg name text")
+	})
+	b.sendLine(t, "@whoever")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "failure" && strings.HasPrefix(ev.Text, "unknown command @whoever")
+	})
+	b.send(t, command.Join, "dev", "ops")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "failure" && ev.Text == "join: usage @join room"
+	})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestPrivateInvites tests whether users join a private session only when
+// they accept the invite and whether unanswered invites expire
+func TestPrivateInvites(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	defer carol.Close()
+	carolResults := carol.results()
+	waitFor(t, carolResults, "Name registering")
+
+	alice.send(t, command.Private, "bob", "carol")
+	waitFor(t, aliceResults, "Private session p1 created. Invited bob, carol.")
+	waitFor(t, bobResults, "alice invites you to a private session")
+	bob.send(t, command.Who)
+	waitFor(t, bobResults, "alice invited you")
+
+	bob.send(t, command.Accept)
+	waitFor(t, aliceResults, "bob joined the private session.")
+	carol.send(t, command.Decline, "alice")
+	waitFor(t, aliceResults, "carol declined your invite.")
+	carol.send(t, command.Accept)
+	waitFor(t, carolResults, "you have no pending invite")
+
+	alice.send(t, command.Send, "just us")
+	waitFor(t, bobResults, "just us")
+
+	reg.SetInviteExpiry(50 * time.Millisecond)
+	carol.send(t, command.Private, "alice")
+	waitFor(t, aliceResults, "carol invites you")
+	time.Sleep(100 * time.Millisecond)
+	alice.send(t, command.Accept, "carol")
+	waitFor(t, aliceResults, "you have no pending invite")
+	waitFor(t, carolResults, "Your invite to alice expired.")
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestMailbox tests whether the direct messages and the mentions sent to
+// an offline registered user wait until the user signs in again
+func TestMailbox(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	bob := handshake(t, reg, seruser.QueueConfig{})
+	bobResults := bob.results()
+	bob.send(t, command.Register, "bob", "secret")
+	waitFor(t, bobResults, "Signed in as bob")
+	bob.send(t, command.Exit)
+	waitFor(t, bobResults, "Signed out")
+	bob.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	alice.send(t, command.Msg, "carol", "hello?")
+	waitFor(t, aliceResults, "message not sent: carol is offline")
+	alice.send(t, command.Msg, "bob", "see you tomorrow")
+	waitFor(t, aliceResults, "bob is offline, the message waits in the mailbox.")
+	alice.send(t, command.Send, "ask @bob about it")
+	waitFor(t, aliceResults, "bob is offline, the mention waits in the mailbox")
+
+	bob = handshake(t, reg, seruser.QueueConfig{})
+	defer bob.Close()
+	bobResults = bob.results()
+	bob.send(t, command.Login, "bob", "secret")
+	waitFor(t, bobResults, "Signed in as bob")
+	waitFor(t, bobResults, "2 messages waited for you:")
+	waitFor(t, bobResults, "see you tomorrow")
+	if res := waitFor(t, bobResults, "ask @bob"); !res.Mentioned {
+		t.Fatal("mailbox: the mention is not marked")
+	}
+	waitFor(t, bobResults, "End of mailbox.")
+
+	bob.send(t, command.Exit)
+	waitFor(t, bobResults, "Signed out")
+	again := handshake(t, reg, seruser.QueueConfig{})
+	defer again.Close()
+	againResults := again.results()
+	again.send(t, command.Login, "bob", "secret")
+	waitWithout(t, againResults, "Signed in as bob", "waited for you")
+	again.send(t, command.Who)
+	waitWithout(t, againResults, "Public", "waited for you")
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestMentions tests whether the mentioned users are marked in the results
+// and whether @mentions lists the mentions of the room and of the private
+// sessions
+func TestMentions(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	bob.send(t, command.Mentions)
+	waitFor(t, bobResults, "Nobody mentioned you yet.")
+	bob.send(t, command.Away, "lunch")
+	waitFor(t, bobResults, "You are away: lunch.")
+
+	alice.send(t, command.Send, "hey @bob, look")
+	// the notice and the message may arrive in any order
+	for echo, notice := false, false; !echo || !notice; {
+		res := waitFor(t, aliceResults, "")
+		switch {
+		case strings.Contains(res.Message, "hey @bob"):
+			if res.Mentioned {
+				t.Fatal("mention: the author is marked as mentioned")
+			}
+			echo = true
+		case strings.Contains(res.Message, "bob is away: lunch"):
+			notice = true
+		}
+	}
+	if res := waitFor(t, bobResults, "hey @bob"); !res.Mentioned {
+		t.Fatal("mention: bob is not marked as mentioned")
+	}
+
+	alice.send(t, command.Private, "bob")
+	waitFor(t, bobResults, "alice invites you")
+	bob.send(t, command.Accept)
+	waitFor(t, aliceResults, "bob joined the private session.")
+	alice.send(t, command.Send, "only @alice hears this")
+	waitFor(t, bobResults, "only @alice")
+	alice.send(t, command.Send, "@bob: in private")
+	if res := waitFor(t, bobResults, "in private"); !res.Mentioned {
+		t.Fatal("mention: bob is not marked as mentioned in the private session")
+	}
+
+	bob.send(t, command.Mentions)
+	waitFor(t, bobResults, "Mentions of you:")
+	waitFor(t, bobResults, "hey @bob")
+	waitWithout(t, bobResults, "in private", "only @alice")
+	waitFor(t, bobResults, "End of mentions.")
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// Ban bans a username or an IP address, a zero Until bans forever
+type Ban struct {
+	Target  string
+	By      string
+	Created time.Time
+	Until   time.Time
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && now.After(b.Until)
+}
+
+// Moderation keeps the roles, the bans and the mutes of the server. The
+// roles are given when the server starts, the bans are kept in a file
+// and the mutes only last as long as the server does
+type Moderation struct {
+	path  string
+	roles map[string]seruser.Role
+
+	bans  map[string]*Ban
+	mutes map[string]time.Time
+
+	banChan    chan *moderationOperation
+	unbanChan  chan *moderationOperation
+	bannedChan chan *moderationOperation
+	muteChan   chan *moderationOperation
+	unmuteChan chan *moderationOperation
+	mutedChan  chan *moderationOperation
+	close      chan struct{}
+	closeOnce  sync.Once
+}
+
+type moderationOperation struct {
+	sync.WaitGroup
+	target string
+	ban    *Ban
+	until  time.Time
+	found  bool
+}
+
+// OpenModeration loads the bans kept at path, the bans are only kept in
+// memory if path is empty. The owner and the moderators only get their
+// role when they sign in with their account
+func OpenModeration(path, owner string, moderators []string) (*Moderation, error) {
+	mod := &Moderation{
+		path:       path,
+		roles:      make(map[string]seruser.Role),
+		bans:       make(map[string]*Ban),
+		mutes:      make(map[string]time.Time),
+		banChan:    make(chan *moderationOperation),
+		unbanChan:  make(chan *moderationOperation),
+		bannedChan: make(chan *moderationOperation),
+		muteChan:   make(chan *moderationOperation),
+		unmuteChan: make(chan *moderationOperation),
+		mutedChan:  make(chan *moderationOperation),
+		close:      make(chan struct{}),
+	}
+	for _, name := range moderators {
+		mod.roles[name] = seruser.Moderator
+	}
+	if owner != "" {
+		mod.roles[owner] = seruser.Owner
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("open bans: %s", err)
+		}
+		if len(data) > 0 {
+			var bans []*Ban
+			if err := json.Unmarshal(data, &bans); err != nil {
+				return nil, fmt.Errorf("open bans: %s", err)
+			}
+			for _, b := range bans {
+				mod.bans[b.Target] = b
+			}
+		}
+	}
+	go mod.listen()
+	return mod, nil
+}
+
+// Role implements the server/user.Moderation interface
+func (mod *Moderation) Role(username string) seruser.Role {
+	// the roles never change once the server started
+	return mod.roles[username]
+}
+
+// ban records the ban of a username or an IP address
+func (mod *Moderation) ban(target, by string, duration time.Duration) {
+	b := &Ban{Target: target, By: by, Created: time.Now()}
+	if duration > 0 {
+		b.Until = b.Created.Add(duration)
+	}
+	op := moderationOperation{target: target, ban: b}
+	op.Add(1)
+	mod.banChan <- &op
+	op.Wait()
+}
+
+// Unban implements the server/user.Moderation interface
+func (mod *Moderation) Unban(target string) bool {
+	return mod.do(mod.unbanChan, target).found
+}
+
+// Banned implements the server/user.Moderation interface
+func (mod *Moderation) Banned(target string) bool {
+	return mod.do(mod.bannedChan, target).found
+}
+
+// Mute implements the server/user.Moderation interface
+func (mod *Moderation) Mute(username string, duration time.Duration) {
+	op := moderationOperation{target: username}
+	if duration > 0 {
+		op.until = time.Now().Add(duration)
+	}
+	op.Add(1)
+	mod.muteChan <- &op
+	op.Wait()
+}
+
+// Unmute implements the server/user.Moderation interface
+func (mod *Moderation) Unmute(username string) bool {
+	return mod.do(mod.unmuteChan, username).found
+}
+
+// Muted implements the server/user.Moderation interface
+func (mod *Moderation) Muted(username string) (time.Time, bool) {
+	op := mod.do(mod.mutedChan, username)
+	return op.until, op.found
+}
+
+func (mod *Moderation) do(opChan chan *moderationOperation, target string) *moderationOperation {
+	op := moderationOperation{target: target}
+	op.Add(1)
+	opChan <- &op
+	op.Wait()
+	return &op
+}
+
+// Close stops the moderation, it cannot be used afterwards
+func (mod *Moderation) Close() {
+	mod.closeOnce.Do(func() {
+		close(mod.close)
+	})
+}
+
+// listen synchronizes every operations that access the bans and the
+// mutes
+func (mod *Moderation) listen() {
+	for {
+		select {
+		case op := <-mod.banChan:
+			mod.bans[op.target] = op.ban
+			mod.save()
+			op.Done()
+		case op := <-mod.unbanChan:
+			if b, ok := mod.bans[op.target]; ok {
+				delete(mod.bans, op.target)
+				op.found = !b.expired(time.Now())
+				mod.save()
+			}
+			op.Done()
+		case op := <-mod.bannedChan:
+			if b, ok := mod.bans[op.target]; ok {
+				op.found = !b.expired(time.Now())
+			}
+			op.Done()
+		case op := <-mod.muteChan:
+			mod.mutes[op.target] = op.until
+			op.Done()
+		case op := <-mod.unmuteChan:
+			if until, ok := mod.mutes[op.target]; ok {
+				delete(mod.mutes, op.target)
+				op.found = until.IsZero() || time.Now().Before(until)
+			}
+			op.Done()
+		case op := <-mod.mutedChan:
+			if until, ok := mod.mutes[op.target]; ok {
+				if until.IsZero() || time.Now().Before(until) {
+					op.until, op.found = until, true
+				} else {
+					delete(mod.mutes, op.target)
+				}
+			}
+			op.Done()
+		case <-mod.close:
+			return
+		}
+	}
+}
+
+// save rewrites the file with the bans that did not expire
+func (mod *Moderation) save() {
+	if mod.path == "" {
+		return
+	}
+	now := time.Now()
+	bans := []*Ban{}
+	for target, b := range mod.bans {
+		if b.expired(now) {
+			delete(mod.bans, target)
+			continue
+		}
+		bans = append(bans, b)
+	}
+	data, _ := json.MarshalIndent(bans, "", "\t")
+	tmp := mod.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("save bans: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, mod.path); err != nil {
+		log.Printf("save bans: %s", err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestModeration tests whether a moderator mutes, kicks and bans a member
+// and whether the ban outlives the server
+func TestModeration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moderation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans")
+	mod, err := OpenModeration(path, "olive", []string{"max"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, mod)
+	defer reg.Close()
+
+	olive := handshake(t, reg, seruser.QueueConfig{})
+	defer olive.Close()
+	oliveResults := olive.results()
+	olive.send(t, command.Register, "olive", "secret")
+	waitFor(t, oliveResults, "Signed in as olive")
+
+	troll := connect(t, reg, seruser.QueueConfig{}, "troll")
+	trollResults := troll.results()
+	waitFor(t, trollResults, "Name registering")
+	troll.send(t, command.Kick, "olive")
+	waitFor(t, trollResults, "only moderators can do that")
+
+	olive.send(t, command.Mute, "troll", "1h")
+	waitFor(t, trollResults, "You were muted by olive for 1h0m0s")
+	waitFor(t, oliveResults, "troll was muted by olive")
+	troll.send(t, command.Send, "spam")
+	waitFor(t, trollResults, "you are muted until")
+
+	olive.send(t, command.Kick, "troll", "enough")
+	waitFor(t, trollResults, "You were kicked by olive: enough")
+	waitFor(t, oliveResults, "troll was kicked by olive: enough.")
+	troll.Close()
+
+	olive.send(t, command.Ban, "troll")
+	waitFor(t, oliveResults, "troll was banned by olive until further notice")
+	olive.send(t, command.Ban, "10.0.0.1", "2h")
+	waitFor(t, oliveResults, "10.0.0.1 banned")
+	again := connect(t, reg, seruser.QueueConfig{}, "troll")
+	defer again.Close()
+	waitFor(t, again.results(), "the name is banned")
+
+	// the bans are read back from the file
+	reopened, err := OpenModeration(path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if !reopened.Banned("troll") || !reopened.Banned("10.0.0.1") {
+		t.Fatal("the bans were not saved")
+	}
+	if !reopened.Unban("troll") || reopened.Banned("troll") {
+		t.Fatal("unban: troll is still banned")
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestMsg tests whether a direct message reaches an online user in any
+// room and whether it fails when the user is offline or unknown
+func TestMsg(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	carolResults := carol.results()
+	waitFor(t, carolResults, "Name registering")
+
+	bob.send(t, command.Join, "dev")
+	waitFor(t, bobResults, "You are now in #dev")
+	alice.send(t, command.Msg, "bob", "psst")
+	if res := waitFor(t, bobResults, "psst"); res.Rtype != result.Message {
+		t.Fatalf("msg: unexpected delivery %+v", res)
+	}
+	if res := waitFor(t, aliceResults, "psst"); res.Rtype != result.Message {
+		t.Fatalf("msg: unexpected copy %+v", res)
+	}
+
+	carol.send(t, command.Exit)
+	waitFor(t, carolResults, "Signed out")
+	carol.Close()
+	for _, to := range []string{"carol", "nobody"} {
+		alice.send(t, command.Msg, to, "are you there?")
+		if res := waitFor(t, aliceResults, "message not sent: "+to+" is offline"); res.Rtype != result.Failure {
+			t.Fatalf("msg to %s: expected a failure, received %+v", to, res)
+		}
+	}
+	alice.send(t, command.Msg, "alice", "hi me")
+	waitFor(t, aliceResults, "message not sent: talking to yourself?")
+	alice.send(t, command.Msg, "bob")
+	waitFor(t, aliceResults, "msg: usage @msg name text")
+	alice.send(t, command.Msg, "bob", "")
+	waitFor(t, aliceResults, "message not sent: please provide a username and a message")
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin/dicebot"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestPlugins tests whether the sample bot is told about the users that
+// join and the commands they send, in the rooms and in the private
+// sessions, and whether its name is reserved
+func TestPlugins(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil, dicebot.New(rand.NewSource(1)))
+	defer reg.Close()
+
+	impostor := connect(t, reg, seruser.QueueConfig{}, dicebot.Name)
+	defer impostor.Close()
+	waitFor(t, impostor.results(), ErrBotName.Error())
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Welcome to #lobby, alice!")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Welcome to #lobby, bob!")
+
+	alice.send(t, command.Send, "!echo hello there")
+	if res := waitFor(t, bobResults, "dicebot"); res.Author != dicebot.Name ||
+		!strings.Contains(res.Message, "hello there") {
+		t.Fatalf("unexpected echo %+v", res)
+	}
+	alice.send(t, command.Send, "!roll 0d6")
+	waitFor(t, aliceResults, "alice: roll: roll between 1 and 100 dice")
+	alice.send(t, command.Send, "!roll 2d6")
+	waitFor(t, bobResults, "alice rolled 2d6: ")
+
+	alice.send(t, command.Private, "bob")
+	waitFor(t, bobResults, "alice invites you")
+	bob.send(t, command.Accept)
+	waitFor(t, aliceResults, "bob joined the private session.")
+	bob.send(t, command.Send, "!dice d20")
+	res := waitFor(t, aliceResults, "bob rolled 1d20")
+	if !strings.Contains(res.Message, "[p1]") {
+		t.Fatalf("the roll was not said in the private session: %q", res.Message)
+	}
+	// the room keeps the roll with the messages of the session
+	alice.send(t, command.Reply, fmt.Sprint(res.ID), "lucky you")
+	if res = waitFor(t, bobResults, "lucky you"); !strings.Contains(res.Message, "[p1]") {
+		t.Fatalf("the reply to the bot was not said in the private session: %q", res.Message)
+	}
+
+	bob.send(t, command.Join, "dev")
+	waitFor(t, bobResults, "Welcome to #dev, bob!")
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestPresence tests whether the presence of the users is shown in @who,
+// whether the senders of direct messages are told about it and whether
+// idle users are away
+func TestPresence(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	alice.send(t, command.Away, "lunch")
+	waitFor(t, aliceResults, "You are away: lunch.")
+	bob.send(t, command.Who)
+	waitFor(t, bobResults, "(guest)\x1b[0;0;0m (away: lunch)")
+	bob.send(t, command.Msg, "alice", "are you there?")
+	waitFor(t, bobResults, "alice is away: lunch")
+	waitFor(t, aliceResults, "are you there?")
+
+	alice.send(t, command.Back)
+	waitFor(t, aliceResults, "Welcome back.")
+	alice.send(t, command.Back)
+	waitFor(t, aliceResults, "you were not away")
+	alice.send(t, command.Busy)
+	waitFor(t, aliceResults, "You are busy.")
+	bob.send(t, command.Who)
+	waitFor(t, bobResults, "(busy)")
+	alice.send(t, command.Back)
+	waitFor(t, aliceResults, "Welcome back.")
+
+	settings := reg.Settings()
+	settings.IdleAfter = 50 * time.Millisecond
+	reg.Configure(settings)
+	time.Sleep(100 * time.Millisecond)
+	bob.send(t, command.Who)
+	waitFor(t, bobResults, "(away: idle for")
+}
@@ -0,0 +1,617 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/account"
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+const (
+	lobbyName = "lobby"
+	// tokenLength is the number of random bytes of a resume token
+	tokenLength = 16
+)
+
+var (
+	// ErrRoomFull is returned when a room reached its user limit
+	ErrRoomFull = errors.New("join room: number of user exceeded limit")
+	// ErrNotClaimed is returned when a username was never claimed
+	ErrNotClaimed = errors.New("join room: you didn't pick a username")
+	// ErrReserved is returned when a guest picks a registered name
+	ErrReserved = errors.New("create a name: the name is registered, use @login")
+	// ErrBanned is returned when a banned name is picked
+	ErrBanned = errors.New("create a name: the name is banned")
+	// ErrBotName is returned when the name of a bot is picked
+	ErrBotName = errors.New("create a name: the name belongs to a bot")
+)
+
+// HistoryConfig tells the registry how to keep the history of the rooms
+type HistoryConfig struct {
+	// Dir is the folder that keeps a history file per room, the
+	// history is kept in memory if Dir is empty
+	Dir       string
+	Retention history.Retention
+	// Replay is the number of recent messages a new user receives
+	Replay int
+}
+
+// open opens the history store of the named room, it falls back to the
+// memory if the file could not be opened
+func (hc HistoryConfig) open(name string) history.Store {
+	if hc.Dir == "" {
+		return history.NewMemory(hc.Retention)
+	}
+	store, err := history.OpenFile(filepath.Join(hc.Dir, name+".log"), hc.Retention)
+	if err != nil {
+		log.Printf("room #%s: %s, keeping the history in memory", name, err)
+		return history.NewMemory(hc.Retention)
+	}
+	return store
+}
+
+// Registry keeps track of the named public rooms of a chat server.
+// Rooms are created on demand and are garbage-collected as soon as
+// the last user vacates them, except for the lobby which lives as long
+// as the server does.
+// Registry implements the server/user.Rooms interface
+type Registry struct {
+	*Moderation
+	limit    int
+	history  HistoryConfig
+	accounts *account.Store
+	mailbox  *mailbox.Store
+	lobby    *public.Room
+	// plugins are told what happens in every room, the names of their
+	// bots are reserved
+	plugins []plugin.Plugin
+	bots    map[string]bool
+	// inviteExpiry is how long the invites of the rooms wait for an
+	// answer
+	inviteExpiry time.Duration
+	// settings holds the seruser.Settings of the users, it changes while
+	// the users read it
+	settings atomic.Value
+
+	// rooms maps a room name to its room and the number of seats taken
+	rooms map[string]*roomEntry
+	// claims maps a username to the user and the room it stays in
+	claims map[string]*claim
+	// tokens maps a resume token to the username it was issued for
+	tokens map[string]string
+
+	claimChan   chan *registryOperation
+	joinChan    chan *registryOperation
+	releaseChan chan *registryOperation
+	lookupChan  chan *registryOperation
+	tokenChan   chan *registryOperation
+	resumeChan  chan *registryOperation
+	usersChan   chan *usersOperation
+	expiryChan  chan *expiryOperation
+	limitChan   chan *limitOperation
+	vacateChan  chan string
+	listChan    chan *listOperation
+	stateChan   chan *stateOperation
+	close       chan struct{}
+}
+
+type roomEntry struct {
+	room  *public.Room
+	seats int
+}
+
+type claim struct {
+	user  room.User
+	room  string
+	token string
+}
+
+type registryOperation struct {
+	sync.WaitGroup
+	username string
+	name     string
+	user     room.User
+	// guest is set when the username is claimed without an account
+	guest bool
+	token string
+
+	room *public.Room
+	err  error
+}
+
+type listOperation struct {
+	sync.WaitGroup
+	rooms []seruser.RoomInfo
+}
+
+type limitOperation struct {
+	sync.WaitGroup
+	limit int
+}
+
+type usersOperation struct {
+	sync.WaitGroup
+	users map[string]room.User
+}
+
+type expiryOperation struct {
+	sync.WaitGroup
+	expiry time.Duration
+}
+
+// NewRegistry creates a registry that holds the lobby, every room
+// has the same user limit, history configuration and plugins. The
+// registered names and the bans are kept in memory if accounts or mod is
+// nil
+func NewRegistry(limit int, hist HistoryConfig, accounts *account.Store, mod *Moderation, plugins ...plugin.Plugin) *Registry {
+	if accounts == nil {
+		accounts, _ = account.Open("")
+	}
+	if mod == nil {
+		mod, _ = OpenModeration("", "", nil)
+	}
+	box, _ := mailbox.Open("", mailbox.Limits{MaxCount: mailbox.DefaultCount, MaxAge: mailbox.DefaultAge})
+	reg := &Registry{
+		Moderation:   mod,
+		mailbox:      box,
+		limit:        limit,
+		history:      hist,
+		accounts:     accounts,
+		lobby:        public.New(lobbyName, limit, hist.open(lobbyName), hist.Replay, plugins...),
+		plugins:      plugins,
+		bots:         make(map[string]bool),
+		rooms:        make(map[string]*roomEntry),
+		claims:       make(map[string]*claim),
+		tokens:       make(map[string]string),
+		claimChan:    make(chan *registryOperation),
+		joinChan:     make(chan *registryOperation),
+		releaseChan:  make(chan *registryOperation),
+		lookupChan:   make(chan *registryOperation),
+		tokenChan:    make(chan *registryOperation),
+		resumeChan:   make(chan *registryOperation),
+		usersChan:    make(chan *usersOperation),
+		expiryChan:   make(chan *expiryOperation),
+		inviteExpiry: public.DefaultInviteExpiry,
+		limitChan:    make(chan *limitOperation),
+		vacateChan:   make(chan string),
+		listChan:     make(chan *listOperation),
+		stateChan:    make(chan *stateOperation),
+		close:        make(chan struct{}),
+	}
+	for _, p := range plugins {
+		reg.bots[p.Bot().Username()] = true
+	}
+	reg.settings.Store(seruser.DefaultSettings())
+	reg.rooms[lobbyName] = &roomEntry{room: reg.lobby}
+	go reg.waitForRemovedUser(reg.lobby)
+	go reg.listen()
+	return reg
+}
+
+// Lobby returns the room every user is put in after picking a name
+func (reg *Registry) Lobby() *public.Room {
+	return reg.lobby
+}
+
+// Claim reserves the username server-wide for a guest and takes a seat
+// in the lobby, the registered names are refused
+func (reg *Registry) Claim(username string, user room.User) (*public.Room, error) {
+	return reg.claimAs(username, user, true)
+}
+
+// Register creates an account for the username and claims it, the name
+// must not be taken by anyone online
+func (reg *Registry) Register(username, password string, user room.User) (*public.Room, error) {
+	if len(password) < account.MinPasswordLength {
+		return nil, fmt.Errorf("register: %s", account.ErrShortPassword)
+	}
+	lobby, err := reg.claimAs(username, user, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := reg.accounts.Register(username, password); err != nil {
+		reg.Release(username)
+		return nil, fmt.Errorf("register: %s", err)
+	}
+	return lobby, nil
+}
+
+// Login checks the password of the account and claims its username
+func (reg *Registry) Login(username, password string, user room.User) (*public.Room, error) {
+	if err := reg.accounts.Verify(username, password); err != nil {
+		return nil, fmt.Errorf("login: %s", err)
+	}
+	lobby, err := reg.claimAs(username, user, false)
+	if err == public.ErrDuplicateUsername {
+		return nil, fmt.Errorf("login: %s is already online", username)
+	}
+	return lobby, err
+}
+
+func (reg *Registry) claimAs(username string, user room.User, guest bool) (*public.Room, error) {
+	op := registryOperation{username: username, user: user, guest: guest}
+	op.Add(1)
+	reg.claimChan <- &op
+	op.Wait()
+	return op.room, op.err
+}
+
+// Join takes a seat for the user in the named room, the room is created
+// if it does not exist. The seat of the previous room is kept until
+// the caller vacates it
+func (reg *Registry) Join(username, name string) (*public.Room, error) {
+	op := registryOperation{username: username, name: name}
+	op.Add(1)
+	reg.joinChan <- &op
+	op.Wait()
+	return op.room, op.err
+}
+
+// Vacate gives up one seat of the named room
+func (reg *Registry) Vacate(name string) {
+	reg.vacateChan <- name
+}
+
+// Release gives up the username and the seat it takes
+func (reg *Registry) Release(username string) {
+	op := registryOperation{username: username}
+	op.Add(1)
+	reg.releaseChan <- &op
+	op.Wait()
+}
+
+// Lookup finds the user that claimed the username
+func (reg *Registry) Lookup(username string) (room.User, bool) {
+	op := registryOperation{username: username}
+	op.Add(1)
+	reg.lookupChan <- &op
+	op.Wait()
+	return op.user, op.user != nil
+}
+
+// SetInviteExpiry changes how long the invites to the private sessions
+// wait for an answer in every room, the rooms have the expiry once it
+// returns
+func (reg *Registry) SetInviteExpiry(expiry time.Duration) {
+	op := expiryOperation{expiry: expiry}
+	op.Add(1)
+	reg.expiryChan <- &op
+	op.Wait()
+}
+
+// UseMailbox keeps the messages sent to the offline registered users in
+// the store, it has to be called before the users connect. The mailboxes
+// are kept in memory otherwise
+func (reg *Registry) UseMailbox(box *mailbox.Store) {
+	reg.mailbox.Close()
+	reg.mailbox = box
+}
+
+// Post implements the server/user.Rooms interface
+func (reg *Registry) Post(letter mailbox.Letter) error {
+	if !reg.accounts.Registered(letter.To) {
+		return mailbox.ErrNoMailbox
+	}
+	return reg.mailbox.Post(letter)
+}
+
+// Collect implements the server/user.Rooms interface
+func (reg *Registry) Collect(username string) []mailbox.Letter {
+	return reg.mailbox.Take(username)
+}
+
+// ResumeToken implements the server/user.Rooms interface, the token is
+// valid as long as the username is claimed
+func (reg *Registry) ResumeToken(username string) string {
+	buf := make([]byte, tokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("resume token: %s", err)
+		return ""
+	}
+	op := registryOperation{username: username, token: hex.EncodeToString(buf)}
+	op.Add(1)
+	reg.tokenChan <- &op
+	op.Wait()
+	return op.token
+}
+
+// Resume implements the server/user.Rooms interface
+func (reg *Registry) Resume(token string) (room.User, bool) {
+	op := registryOperation{token: token}
+	op.Add(1)
+	reg.resumeChan <- &op
+	op.Wait()
+	return op.user, op.user != nil
+}
+
+// Configure changes the settings of the users, the users read them once
+// it returns
+func (reg *Registry) Configure(settings seruser.Settings) {
+	reg.settings.Store(settings)
+}
+
+// Settings implements the server/user.Rooms interface
+func (reg *Registry) Settings() seruser.Settings {
+	return reg.settings.Load().(seruser.Settings)
+}
+
+// SetLimit changes the number of users every room holds, the users that
+// already took a seat keep it
+func (reg *Registry) SetLimit(limit int) {
+	op := limitOperation{limit: limit}
+	op.Add(1)
+	reg.limitChan <- &op
+	op.Wait()
+}
+
+// users returns every user that claimed a username
+func (reg *Registry) users() map[string]room.User {
+	op := usersOperation{}
+	op.Add(1)
+	reg.usersChan <- &op
+	op.Wait()
+	return op.users
+}
+
+// Kick implements the server/user.Moderation interface
+func (reg *Registry) Kick(username, reason string) bool {
+	usr, ok := reg.Lookup(username)
+	if !ok {
+		return false
+	}
+	kickable, ok := usr.(seruser.Kickable)
+	if ok {
+		kickable.Kick(reason)
+	}
+	return ok
+}
+
+// Ban implements the server/user.Moderation interface, an IP address
+// kicks every user connected from it
+func (reg *Registry) Ban(target, by string, duration time.Duration) []string {
+	reg.ban(target, by, duration)
+	reason := fmt.Sprintf("banned by %s", by)
+	if duration > 0 {
+		reason += fmt.Sprintf(" for %s", duration)
+	}
+	kicked := []string{}
+	if net.ParseIP(target) == nil {
+		if reg.Kick(target, reason) {
+			kicked = append(kicked, target)
+		}
+		return kicked
+	}
+	for username, usr := range reg.users() {
+		if host(usr) == target {
+			if kickable, ok := usr.(seruser.Kickable); ok {
+				kickable.Kick(reason)
+				kicked = append(kicked, username)
+			}
+		}
+	}
+	sort.Strings(kicked)
+	return kicked
+}
+
+// host returns the IP address a user is connected from
+func host(usr room.User) string {
+	conn, ok := usr.(interface {
+		RemoteAddr() net.Addr
+	})
+	if !ok {
+		return ""
+	}
+	h, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+// Rooms lists every open room sorted by name
+func (reg *Registry) Rooms() []seruser.RoomInfo {
+	op := listOperation{}
+	op.Add(1)
+	reg.listChan <- &op
+	op.Wait()
+	return op.rooms
+}
+
+// Announce sends a server notification to every user that picked a name,
+// wherever the user talks
+func (reg *Registry) Announce(text string) {
+	for _, usr := range reg.users() {
+		usr.Receive(public.Notification(text))
+	}
+}
+
+// Close closes every room
+func (reg *Registry) Close() {
+	close(reg.close)
+}
+
+// listen synchronizes every operations that access the room table
+func (reg *Registry) listen() {
+loop:
+	for {
+		select {
+		case op := <-reg.claimChan:
+			op.room, op.err = reg.claim(op.username, op.user, op.guest)
+			op.Done()
+		case op := <-reg.releaseChan:
+			if c, ok := reg.claims[op.username]; ok {
+				delete(reg.claims, op.username)
+				delete(reg.tokens, c.token)
+				reg.vacate(c.room)
+			}
+			op.Done()
+		case op := <-reg.tokenChan:
+			if c, ok := reg.claims[op.username]; ok {
+				delete(reg.tokens, c.token)
+				c.token = op.token
+				reg.tokens[op.token] = op.username
+			}
+			op.Done()
+		case op := <-reg.resumeChan:
+			if c, ok := reg.claims[reg.tokens[op.token]]; ok {
+				op.user = c.user
+			}
+			op.Done()
+		case op := <-reg.lookupChan:
+			if c, ok := reg.claims[op.username]; ok {
+				op.user = c.user
+			}
+			op.Done()
+		case op := <-reg.usersChan:
+			op.users = make(map[string]room.User, len(reg.claims))
+			for username, c := range reg.claims {
+				op.users[username] = c.user
+			}
+			op.Done()
+		case op := <-reg.expiryChan:
+			reg.inviteExpiry = op.expiry
+			for _, entry := range reg.rooms {
+				entry.room.SetInviteExpiry(op.expiry)
+			}
+			op.Done()
+		case op := <-reg.limitChan:
+			reg.limit = op.limit
+			for _, entry := range reg.rooms {
+				entry.room.SetLimit(op.limit)
+			}
+			op.Done()
+		case op := <-reg.joinChan:
+			op.room, op.err = reg.join(op.username, op.name)
+			op.Done()
+		case name := <-reg.vacateChan:
+			reg.vacate(name)
+		case op := <-reg.listChan:
+			op.rooms = reg.list()
+			op.Done()
+		case op := <-reg.stateChan:
+			reg.snapshot(op)
+			op.Done()
+		case <-reg.close:
+			for _, entry := range reg.rooms {
+				entry.room.Close()
+			}
+			reg.accounts.Close()
+			reg.mailbox.Close()
+			reg.Moderation.Close()
+			break loop
+		}
+	}
+}
+
+func (reg *Registry) claim(username string, user room.User, guest bool) (*public.Room, error) {
+	if _, ok := reg.claims[username]; ok {
+		return nil, public.ErrDuplicateUsername
+	} else if guest && reg.accounts.Registered(username) {
+		// registered names stay reserved while their owner is offline
+		return nil, ErrReserved
+	} else if reg.Banned(username) {
+		return nil, ErrBanned
+	} else if reg.bots[username] {
+		return nil, ErrBotName
+	}
+	lobby := reg.rooms[lobbyName]
+	if lobby.seats >= reg.limit {
+		return nil, ErrRoomFull
+	}
+	lobby.seats++
+	reg.claims[username] = &claim{user: user, room: lobbyName}
+	return lobby.room, nil
+}
+
+func (reg *Registry) join(username, name string) (*public.Room, error) {
+	c, ok := reg.claims[username]
+	if !ok {
+		return nil, ErrNotClaimed
+	}
+	if !validRoomName(name) {
+		return nil, fmt.Errorf("join room: invalid room name %q", name)
+	} else if c.room == name {
+		return nil, fmt.Errorf("join room: you are already in #%s", name)
+	}
+	entry, ok := reg.rooms[name]
+	if !ok {
+		entry = &roomEntry{room: public.New(name, reg.limit, reg.history.open(name), reg.history.Replay, reg.plugins...)}
+		entry.room.SetInviteExpiry(reg.inviteExpiry)
+		reg.rooms[name] = entry
+		go reg.waitForRemovedUser(entry.room)
+		log.Printf("Room #%s created", name)
+	} else if entry.seats >= reg.limit {
+		return nil, ErrRoomFull
+	}
+	entry.seats++
+	c.room = name
+	return entry.room, nil
+}
+
+// vacate frees a seat and closes the room if nobody is left
+func (reg *Registry) vacate(name string) {
+	entry, ok := reg.rooms[name]
+	if !ok {
+		return
+	}
+	if entry.seats > 0 {
+		entry.seats--
+	}
+	if entry.seats == 0 && name != lobbyName {
+		entry.room.Close()
+		delete(reg.rooms, name)
+		log.Printf("Room #%s closed", name)
+	}
+}
+
+func (reg *Registry) list() []seruser.RoomInfo {
+	rooms := []seruser.RoomInfo{}
+	for name, entry := range reg.rooms {
+		rooms = append(rooms, seruser.RoomInfo{Name: name, Users: entry.seats})
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+	return rooms
+}
+
+// waitForRemovedUser logs every user that leaves the room until the room
+// is closed
+func (reg *Registry) waitForRemovedUser(pub *public.Room) {
+loop:
+	for {
+		select {
+		case <-pub.Done():
+			break loop
+		case usr := <-pub.Remover():
+			if su, ok := usr.(*seruser.User); ok {
+				log.Printf("User %s@%s left #%s", su.String(), su.RemoteAddr().String(), pub.Name())
+			} else {
+				log.Printf("User %s left #%s", usr.String(), pub.Name())
+			}
+		}
+	}
+}
+
+// validRoomName checks whether a room name could be used
+func validRoomName(name string) bool {
+	// the name is also used as a file name
+	return len(name) > 0 && len(name) <= 32 && name[0] != '.' &&
+		!strings.ContainsAny(name, " \t#@/\\")
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/gob"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// resumeSession resumes a session on a new in-memory connection
+func resumeSession(t *testing.T, reg *Registry, token string) *testClient {
+	server, client := net.Pipe()
+	go seruser.New(reg, server, seruser.QueueConfig{})
+	c := &testClient{
+		Conn:    client,
+		encoder: gob.NewEncoder(client),
+		decoder: gob.NewDecoder(client),
+	}
+	c.send(t, command.Resume, token)
+	return c
+}
+
+// TestResumeSession tests whether a client that lost its connection keeps
+// its room and receives the messages it missed when it resumes in time,
+// and whether the others are told once the grace period is over
+func TestResumeSession(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	settings := reg.Settings()
+	settings.ResumeGrace = 500 * time.Millisecond
+	reg.Configure(settings)
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	aliceResults := alice.results()
+	token := waitForType(t, aliceResults, result.Token)
+	if token.Message == "" || token.Author != "alice" {
+		t.Fatalf("token: expected a token for alice, received %q for %q", token.Message, token.Author)
+	}
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	alice.send(t, command.Join, "den")
+	waitFor(t, aliceResults, "You are now in #den")
+	bob.send(t, command.Join, "den")
+	waitFor(t, bobResults, "You are now in #den")
+
+	alice.Close()
+	bob.send(t, command.Send, "while you were gone")
+	waitFor(t, bobResults, "while you were gone")
+
+	resumed := resumeSession(t, reg, token.Message)
+	resumedResults := resumed.results()
+	waitFor(t, resumedResults, "while you were gone")
+	waitFor(t, resumedResults, "Session resumed.")
+	resumed.send(t, command.Send, "back again")
+	waitWithout(t, bobResults, "back again", "disconnected")
+
+	resumed.Close()
+	waitFor(t, bobResults, "disconnected.")
+	expired := resumeSession(t, reg, token.Message)
+	defer expired.Close()
+	waitFor(t, expired.results(), "the session expired")
+}
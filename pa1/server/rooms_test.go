@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestRooms tests whether the users move between the rooms with @join and
+// @leave, whether a missing room is created and closed once empty and
+// whether @rooms lists the open rooms
+func TestRooms(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+
+	alice.send(t, command.Leave)
+	waitFor(t, aliceResults, "leave room: you cannot leave the lobby, use @exit to sign out")
+	alice.send(t, command.Join)
+	waitFor(t, aliceResults, "join: usage @join room")
+	alice.send(t, command.Join, "bad name")
+	waitFor(t, aliceResults, `join room: invalid room name "bad name"`)
+	alice.send(t, command.Join, lobbyName)
+	waitFor(t, aliceResults, "join room: you are already in #"+lobbyName)
+
+	alice.send(t, command.Join, "#dev")
+	waitFor(t, aliceResults, "You are now in #dev")
+	waitFor(t, bobResults, "left for #dev.")
+	bob.send(t, command.Rooms)
+	res := waitFor(t, bobResults, "Rooms:")
+	if !strings.Contains(res.Message, "  #dev (1)") || !strings.Contains(res.Message, "* #"+lobbyName+" (1)") {
+		t.Fatalf("rooms: unexpected list %q", res.Message)
+	}
+
+	// the rooms do not hear each other
+	bob.send(t, command.Send, "anyone in the lobby?")
+	alice.send(t, command.Send, "hello dev")
+	waitWithout(t, aliceResults, "hello dev", "anyone in the lobby?")
+
+	alice.send(t, command.Leave, "#den")
+	waitFor(t, aliceResults, "leave room: you are not in #den")
+	alice.send(t, command.Leave)
+	waitFor(t, aliceResults, "You are now in #"+lobbyName)
+	alice.send(t, command.Rooms)
+	res = waitFor(t, aliceResults, "Rooms:")
+	if strings.Contains(res.Message, "#dev") || !strings.Contains(res.Message, "* #"+lobbyName+" (2)") {
+		t.Fatalf("rooms: the empty room should be closed, received %q", res.Message)
+	}
+}
@@ -6,16 +6,21 @@ package server
 // err := server.Wait()...
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"sync"
+	"time"
 
-	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/model/account"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/plugin"
 	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+	"github.com/iocat/rutgers-cs352/pa1/server/web"
 )
 
-const chatRoomLimit = 20
-
 // Chat represents a chat server that implements the Server
 // interface. A chat server could be run simultaneously with a
 // non-locking calls to Start
@@ -24,34 +29,39 @@ type Chat struct {
 	address  string
 	protocol string
 
-	public  *public.Room
+	rooms   *Registry
+	queue   seruser.QueueConfig
+	tls     *tls.Config
 	errChan chan<- error
 	net.Listener
-}
-
-func (chat *Chat) waitForRemovedUser() {
-loop:
-	for {
-		select {
-		case <-chat.public.Done():
-			break loop
-		case usr := <-chat.public.Remover():
-			if usr, ok := usr.(*seruser.User); ok {
-				log.Printf("User %s@%s left", usr.String(), usr.RemoteAddr().String())
-			} else {
-				log.Printf("User %s left", usr.String())
-			}
+	web   *http.Server
+	admin *http.Server
 
-		}
-	}
+	// mu guards the listeners and the connections, conns are the
+	// connections that did not finish their handshake and users are the
+	// users the server waits for when it shuts down
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	users   map[seruser.Drainable]struct{}
+	closing chan struct{}
+	// countdown is the time.Duration of the shutdown notices, it is
+	// accessed atomically
+	countdown int64
 }
 
-// New creates a new server and makes it run on another goroutine
-func New(protocol, address string) *Chat {
+// New creates a new server and makes it run on another goroutine, the
+// accounts and the bans are kept in memory if accounts or mod is nil.
+// The plugins are told what happens in every room and answer as their bots
+func New(protocol, address string, hist HistoryConfig, queue seruser.QueueConfig,
+	accounts *account.Store, mod *Moderation, plugins ...plugin.Plugin) *Chat {
 	chat := &Chat{
 		protocol: protocol,
 		address:  address,
-		public:   public.New(chatRoomLimit),
+		queue:    queue,
+		rooms:    NewRegistry(DefaultUserLimit, hist, accounts, mod, plugins...),
+		conns:    make(map[net.Conn]struct{}),
+		users:    make(map[seruser.Drainable]struct{}),
+		closing:  make(chan struct{}),
 	}
 	return chat
 }
@@ -59,8 +69,13 @@ func New(protocol, address string) *Chat {
 func (chat *Chat) run() {
 	for {
 		if newConn, err := chat.Accept(); err != nil {
-			// Error receiving an error, log it
-			continue
+			select {
+			case <-chat.closing:
+				return
+			default:
+				// Error receiving an error, log it
+				continue
+			}
 		} else {
 			log.Printf("Accepted connection from %s\n",
 				newConn.RemoteAddr().String())
@@ -68,30 +83,129 @@ func (chat *Chat) run() {
 			go chat.handleClientConn(newConn)
 		}
 	}
-
 }
 
 func (chat *Chat) handleClientConn(conn net.Conn) {
-	if err := chat.createNewUser(conn); err != nil {
-
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil && chat.rooms.Banned(host) {
+		log.Printf("%s: refused, the address is banned", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+	if !chat.trackConn(conn) {
+		conn.Close()
+		return
 	}
+	usr, err := chat.createNewUser(conn)
+	chat.untrackConn(conn)
+	if err != nil {
+		log.Printf("%s: %s", conn.RemoteAddr().String(), err)
+		conn.Close()
+		return
+	}
+	chat.track(usr)
 }
 
-func (chat *Chat) createNewUser(conn net.Conn) error {
-	if _, err := seruser.New(chat.public, conn); err != nil {
-		return fmt.Errorf("create a new server user: %s", err)
+func (chat *Chat) createNewUser(conn net.Conn) (*seruser.User, error) {
+	usr, err := seruser.New(chat.rooms, conn, chat.queue)
+	if err != nil {
+		return nil, fmt.Errorf("create a new server user: %s", err)
 	}
-	return nil
+	return usr, nil
+}
+
+// UseTLS makes the server accept TLS connections only, it has to be
+// called before Start
+func (chat *Chat) UseTLS(config *tls.Config) {
+	chat.tls = config
+}
+
+// UseMailbox keeps the messages sent to the offline registered users in
+// the store, it has to be called before Start
+func (chat *Chat) UseMailbox(box *mailbox.Store) {
+	chat.rooms.UseMailbox(box)
 }
 
-// Start starts a server on another goroutine
+// SetInviteExpiry changes how long the invites to the private sessions
+// wait for an answer
+func (chat *Chat) SetInviteExpiry(expiry time.Duration) {
+	chat.rooms.SetInviteExpiry(expiry)
+}
+
+// Start starts a server on another goroutine, it returns
+// ErrServerClosed once the server is shut down
 func (chat *Chat) Start() error {
-	defer chat.public.Close()
-	var err error
-	if chat.Listener, err = net.Listen(chat.protocol, chat.address); err != nil {
+	var (
+		listener net.Listener
+		err      error
+	)
+	if chat.tls != nil {
+		listener, err = tls.Listen(chat.protocol, chat.address, chat.tls)
+	} else {
+		listener, err = net.Listen(chat.protocol, chat.address)
+	}
+	if err != nil {
+		chat.rooms.Close()
 		return fmt.Errorf("establish connection: %s", err)
 	}
-	go chat.waitForRemovedUser()
+	return chat.Serve(listener)
+}
+
+// Serve accepts the terminal clients on the listener until the server is
+// shut down, it returns ErrServerClosed
+func (chat *Chat) Serve(listener net.Listener) error {
+	chat.mu.Lock()
+	select {
+	case <-chat.closing:
+		chat.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	default:
+	}
+	chat.Listener = listener
+	chat.mu.Unlock()
 	chat.run()
+	return ErrServerClosed
+}
+
+// StartWeb serves the browser clients over HTTP and WebSocket, the
+// browsers join the same rooms as the terminal users
+func (chat *Chat) StartWeb(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("serve web clients: %s", err)
+	}
+	return chat.ServeWeb(listener)
+}
+
+// ServeWeb serves the browser clients on the listener until the server
+// is shut down, it returns ErrServerClosed
+func (chat *Chat) ServeWeb(listener net.Listener) error {
+	srv := &http.Server{
+		Handler: web.Handler(chat.rooms, func(wu *web.User) {
+			chat.track(wu)
+		}),
+		TLSConfig: chat.tls,
+	}
+	chat.mu.Lock()
+	select {
+	case <-chat.closing:
+		chat.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	default:
+	}
+	chat.web = srv
+	chat.mu.Unlock()
+	var err error
+	if chat.tls != nil {
+		err = srv.ServeTLS(listener, "", "")
+	} else {
+		err = srv.Serve(listener)
+	}
+	if err == http.ErrServerClosed {
+		return ErrServerClosed
+	} else if err != nil {
+		return fmt.Errorf("serve web clients: %s", err)
+	}
 	return nil
 }
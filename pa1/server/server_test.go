@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// testClient is the client side of an in-memory connection
+type testClient struct {
+	net.Conn
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+// connect creates a server user on an in-memory connection and picks the
+// username
+func connect(t *testing.T, reg *Registry, queue seruser.QueueConfig, username string) *testClient {
+	c := handshake(t, reg, queue)
+	c.send(t, command.Create, username)
+	return c
+}
+
+// handshake creates a server user on an in-memory connection without
+// picking a username
+func handshake(t *testing.T, reg *Registry, queue seruser.QueueConfig) *testClient {
+	server, client := net.Pipe()
+	go seruser.New(reg, server, queue)
+	c := &testClient{
+		Conn:    client,
+		encoder: gob.NewEncoder(client),
+		decoder: gob.NewDecoder(client),
+	}
+	// the first command is consumed by the handshake
+	c.send(t, command.Create, "")
+	return c
+}
+
+func (c *testClient) send(t *testing.T, ctype int, args ...string) {
+	if err := c.encoder.Encode(command.New(ctype, args)); err != nil {
+		t.Fatalf("send command: %s", err)
+	}
+}
+
+// results decodes every result until the connection is closed
+func (c *testClient) results() <-chan *result.Result {
+	results := make(chan *result.Result, 1024)
+	go func() {
+		defer close(results)
+		for {
+			var res = new(result.Result)
+			if err := c.decoder.Decode(res); err != nil {
+				return
+			}
+			results <- res
+		}
+	}()
+	return results
+}
+
+// waitFor reads the results until one contains the text and returns it
+func waitFor(t *testing.T, results <-chan *result.Result, text string) *result.Result {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				t.Fatalf("connection closed while waiting for %q", text)
+			}
+			if strings.Contains(res.Message, text) {
+				return res
+			}
+		case <-timeout:
+			t.Fatalf("timed out while waiting for %q", text)
+		}
+	}
+}
+
+// waitForType reads the results until one has the type and returns it
+func waitForType(t *testing.T, results <-chan *result.Result, rtype int) *result.Result {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				t.Fatalf("connection closed while waiting for type %d", rtype)
+			}
+			if res.Rtype == rtype {
+				return res
+			}
+		case <-timeout:
+			t.Fatalf("timed out while waiting for type %d", rtype)
+		}
+	}
+}
+
+// waitWithout reads the results until one contains the text, it fails if
+// a result contains unwanted before
+func waitWithout(t *testing.T, results <-chan *result.Result, text, unwanted string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				t.Fatalf("connection closed while waiting for %q", text)
+			}
+			if strings.Contains(res.Message, unwanted) {
+				t.Fatalf("received %q while waiting for %q", res.Message, text)
+			} else if strings.Contains(res.Message, text) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out while waiting for %q", text)
+		}
+	}
+}
+
+// TestFrozenClient tests whether a client that never reads the socket
+// does not block the delivery of messages to the others
+func TestFrozenClient(t *testing.T) {
+	policies := []seruser.DropPolicy{seruser.DropOldest, seruser.Disconnect}
+	for _, policy := range policies {
+		queue := seruser.QueueConfig{Size: 4, Policy: policy}
+		reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+
+		frozen := connect(t, reg, queue, "frozen")
+		alice := connect(t, reg, queue, "alice")
+		aliceResults := alice.results()
+		waitFor(t, aliceResults, "Name registering")
+		bob := connect(t, reg, queue, "bob")
+		bobResults := bob.results()
+		waitFor(t, bobResults, "Name registering")
+
+		for i := 0; i < 50; i++ {
+			alice.send(t, command.Send, fmt.Sprintf("message %d", i))
+		}
+		waitFor(t, bobResults, "message 49")
+
+		frozen.Close()
+		alice.Close()
+		bob.Close()
+		reg.Close()
+	}
+}
+
+// TestEmptyMessage tests whether a chat message without text is refused
+// rather than crashing the server
+func TestEmptyMessage(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	results := alice.results()
+	waitFor(t, results, "Name registering")
+
+	alice.send(t, command.Send)
+	waitFor(t, results, "message not sent: please provide a message")
+	alice.send(t, command.Send, "")
+	waitFor(t, results, "message not sent: please provide a message")
+	alice.send(t, command.Send, "still here")
+	waitFor(t, results, "still here")
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestPrivateSessions tests whether a user talks in several private
+// sessions and in the room at once, switching between them
+func TestPrivateSessions(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	bobResults := bob.results()
+	waitFor(t, bobResults, "Name registering")
+	carol := connect(t, reg, seruser.QueueConfig{}, "carol")
+	defer carol.Close()
+	carolResults := carol.results()
+	waitFor(t, carolResults, "Name registering")
+
+	alice.send(t, command.Private, "bob")
+	waitFor(t, aliceResults, "Private session p1 created")
+	bob.send(t, command.Accept, "alice")
+	waitFor(t, aliceResults, "bob joined the private session.")
+	carol.send(t, command.Private, "bob")
+	waitFor(t, carolResults, "Private session p2 created")
+	bob.send(t, command.Accept, "p2")
+	waitFor(t, carolResults, "bob joined the private session.")
+
+	// bob talks in the last session he joined
+	bob.send(t, command.Send, "for carol")
+	waitFor(t, carolResults, "[p2]")
+	bob.send(t, command.Switch, "p1")
+	waitFor(t, bobResults, "You are talking in private session p1")
+	bob.send(t, command.Send, "for alice")
+	waitWithout(t, aliceResults, "for alice", "for carol")
+	bob.send(t, command.Switch)
+	waitFor(t, bobResults, "You are talking in #lobby")
+	bob.send(t, command.Send, "for everyone")
+	waitFor(t, aliceResults, "for everyone")
+	waitWithout(t, carolResults, "for everyone", "for alice")
+
+	bob.send(t, command.Who)
+	waitFor(t, bobResults, "p2 hosted by carol: bob, carol")
+	carol.send(t, command.End)
+	waitFor(t, bobResults, "Private session p2 closed.")
+	bob.send(t, command.Switch, "p2")
+	waitFor(t, bobResults, "there is no private session p2")
+	alice.send(t, command.Send, "still here")
+	waitFor(t, bobResults, "still here")
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+const (
+	// DefaultCountdown is how long the users are warned before the
+	// server shuts down
+	DefaultCountdown = 10 * time.Second
+	// DrainTimeout is the time kept after the countdown to flush the
+	// queued results and close the connections
+	DrainTimeout = 5 * time.Second
+	// shutdownReason is what the users are told when they are signed out
+	shutdownReason = "disconnected, the server is shutting down"
+)
+
+// ErrServerClosed is returned by Start and Serve once the server is shut
+// down
+var ErrServerClosed = errors.New("chat server closed")
+
+// countdownSteps are the remaining times the users are reminded of
+var countdownSteps = []time.Duration{
+	time.Minute, 30 * time.Second, 10 * time.Second,
+	5 * time.Second, 3 * time.Second, 2 * time.Second, time.Second,
+}
+
+// SetCountdown changes how long the users are warned before the server
+// shuts down, zero signs them out right away
+func (chat *Chat) SetCountdown(countdown time.Duration) {
+	atomic.StoreInt64(&chat.countdown, int64(countdown))
+}
+
+// Countdown returns how long the users are warned before the server
+// shuts down
+func (chat *Chat) Countdown() time.Duration {
+	return time.Duration(atomic.LoadInt64(&chat.countdown))
+}
+
+// trackConn keeps a connection until its handshake is over, it reports
+// false once the server is shutting down
+func (chat *Chat) trackConn(conn net.Conn) bool {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	select {
+	case <-chat.closing:
+		return false
+	default:
+	}
+	chat.conns[conn] = struct{}{}
+	return true
+}
+
+func (chat *Chat) untrackConn(conn net.Conn) {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	delete(chat.conns, conn)
+}
+
+// track keeps the user until its connection is closed, a user that
+// connects while the server is shutting down is signed out right away
+func (chat *Chat) track(usr seruser.Drainable) {
+	chat.mu.Lock()
+	select {
+	case <-chat.closing:
+		chat.mu.Unlock()
+		usr.Kick(shutdownReason)
+		return
+	default:
+	}
+	chat.users[usr] = struct{}{}
+	chat.mu.Unlock()
+	go func() {
+		<-usr.Closed()
+		chat.mu.Lock()
+		delete(chat.users, usr)
+		chat.mu.Unlock()
+	}()
+}
+
+// Shutdown stops accepting connections, counts down with notices to the
+// users, signs every user out with an Exit result and waits for the
+// queued results to be flushed. The countdown is cut short to keep
+// DrainTimeout before the deadline of ctx. The connections left once ctx
+// is done are closed and ctx.Err() is returned
+func (chat *Chat) Shutdown(ctx context.Context) error {
+	chat.mu.Lock()
+	select {
+	case <-chat.closing:
+		chat.mu.Unlock()
+		return ErrServerClosed
+	default:
+	}
+	// closing keeps the new connections out from now on
+	close(chat.closing)
+	if chat.Listener != nil {
+		chat.Listener.Close()
+	}
+	servers := []*http.Server{chat.web, chat.admin}
+	chat.mu.Unlock()
+	for _, srv := range servers {
+		if srv != nil {
+			srv.Shutdown(ctx)
+		}
+	}
+
+	chat.countDown(ctx)
+
+	chat.mu.Lock()
+	users := make([]seruser.Drainable, 0, len(chat.users))
+	for usr := range chat.users {
+		users = append(users, usr)
+	}
+	for conn := range chat.conns {
+		// the handshake is not over, nothing is queued yet
+		conn.Close()
+	}
+	chat.mu.Unlock()
+	for _, usr := range users {
+		usr.Kick(shutdownReason)
+	}
+	err := chat.drain(ctx, users)
+	chat.rooms.Close()
+	return err
+}
+
+// drain waits for the connections of the users to be closed. Once ctx is
+// done the connections left are closed without waiting for the clients
+func (chat *Chat) drain(ctx context.Context, users []seruser.Drainable) error {
+	for i, usr := range users {
+		select {
+		case <-usr.Closed():
+		case <-ctx.Done():
+			for _, usr := range users[i:] {
+				usr.ForceClose()
+				<-usr.Closed()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// countDown notifies the users until the countdown is over or ctx is
+// done
+func (chat *Chat) countDown(ctx context.Context) {
+	remaining := chat.Countdown()
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) - DrainTimeout; left < remaining {
+			remaining = left
+		}
+	}
+	remaining = remaining.Truncate(time.Second)
+	if remaining <= 0 {
+		return
+	}
+	end := time.Now().Add(remaining)
+	chat.rooms.Announce(fmt.Sprintf("The server shuts down in %s.", remaining))
+	for _, step := range append(countdownSteps, 0) {
+		if step >= remaining {
+			continue
+		}
+		timer := time.NewTimer(time.Until(end.Add(-step)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		if step > 0 {
+			chat.rooms.Announce(fmt.Sprintf("The server shuts down in %s.", step))
+		}
+	}
+}
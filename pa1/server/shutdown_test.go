@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/codec"
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+	"github.com/iocat/rutgers-cs352/pa1/server/web"
+)
+
+// dialChat connects a JSON client to the server and decodes its results
+// until the connection is closed
+func dialChat(t *testing.T, address string, username string) (net.Conn, <-chan *result.Result) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	cod := codec.NewJSON(conn)
+	results := make(chan *result.Result, 1024)
+	go func() {
+		defer close(results)
+		for {
+			res := new(result.Result)
+			if err := cod.Decode(res); err != nil {
+				return
+			}
+			results <- res
+		}
+	}()
+	for _, name := range []string{"", username} {
+		if err := cod.Encode(command.New(command.Create, []string{name})); err != nil {
+			t.Fatalf("send command: %s", err)
+		}
+	}
+	return conn, results
+}
+
+// serveWeb serves the browsers of the chat on a local port and returns
+// the URL of the page
+func serveWeb(t *testing.T, chat *Chat) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- chat.ServeWeb(listener)
+	}()
+	return "http://" + listener.Addr().String(), served
+}
+
+// waitClosed waits for the server to close the connection
+func waitClosed(t *testing.T, results <-chan *result.Result) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-results:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out while waiting for the connection to be closed")
+		}
+	}
+}
+
+// TestShutdown tests whether the terminal and the browser users are
+// counted down and signed out with an Exit result, whether the new
+// connections are refused and whether every goroutine of the server is
+// gone afterwards
+func TestShutdown(t *testing.T) {
+	before := runtime.NumGoroutine()
+	chat := New("tcp", "", HistoryConfig{}, seruser.QueueConfig{}, nil, nil)
+	chat.SetCountdown(2 * time.Second)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- chat.Serve(listener)
+	}()
+	url, webServed := serveWeb(t, chat)
+
+	alice, aliceResults := dialChat(t, listener.Addr().String(), "alice")
+	defer alice.Close()
+	waitFor(t, aliceResults, "Name registering")
+	bob, bobResults := dialChat(t, listener.Addr().String(), "bob")
+	defer bob.Close()
+	waitFor(t, bobResults, "Name registering")
+	bob.(*net.TCPConn).CloseWrite()
+	waitFor(t, aliceResults, "disconnected")
+	// a connection that never sends its handshake
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	carol := openBrowser(t, url)
+	defer carol.Close()
+	carol.send(t, command.Create, "carol")
+	carol.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "created" })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- chat.Shutdown(ctx)
+	}()
+	waitFor(t, aliceResults, "The server shuts down in 2s.")
+	waitFor(t, aliceResults, "The server shuts down in 1s.")
+	if res := waitForType(t, aliceResults, result.Exit); res.Message != "You were "+shutdownReason {
+		t.Errorf("unexpected exit message %q", res.Message)
+	}
+	waitClosed(t, aliceResults)
+	carol.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "exit" && ev.Text == "You were "+shutdownReason
+	})
+	for range carol.events {
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("shutdown: %s", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("expected the server to be closed, got %v", err)
+	}
+	if err := <-webServed; err != ErrServerClosed {
+		t.Errorf("expected the web server to be closed, got %v", err)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("the server still accepts connections")
+	}
+	if err := chat.Shutdown(ctx); err != ErrServerClosed {
+		t.Errorf("expected a second shutdown to fail, got %v", err)
+	}
+
+	// the client side goroutines end once the connections are closed
+	alice.Close()
+	bob.Close()
+	idle.Close()
+	carol.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			var stacks bytes.Buffer
+			pprof.Lookup("goroutine").WriteTo(&stacks, 1)
+			t.Fatalf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, stacks.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestDrainTimeout tests whether the terminal and the browser users left
+// once the deadline of the shutdown passed are disconnected
+func TestDrainTimeout(t *testing.T) {
+	chat := New("tcp", "", HistoryConfig{}, seruser.QueueConfig{}, nil, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go chat.Serve(listener)
+	url, _ := serveWeb(t, chat)
+
+	alice, aliceResults := dialChat(t, listener.Addr().String(), "alice")
+	defer alice.Close()
+	waitFor(t, aliceResults, "Name registering")
+	carol := openBrowser(t, url)
+	defer carol.Close()
+	carol.send(t, command.Create, "carol")
+	carol.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "created" })
+
+	chat.mu.Lock()
+	users := make([]seruser.Drainable, 0, len(chat.users))
+	for usr := range chat.users {
+		users = append(users, usr)
+	}
+	chat.mu.Unlock()
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, tracked %d", len(users))
+	}
+	// the users are not kicked, only the deadline closes them
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := chat.drain(ctx, users); err != context.Canceled {
+		t.Errorf("expected the drain to be canceled, got %v", err)
+	}
+	waitClosed(t, aliceResults)
+	timeout := time.After(5 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-carol.events:
+		case <-timeout:
+			t.Fatal("timed out while waiting for the browser to be disconnected")
+		}
+	}
+	chat.Shutdown(context.Background())
+}
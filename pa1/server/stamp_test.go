@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// TestMessageStamps tests whether the messages carry increasing IDs,
+// their time and their author, also when they are replayed from the
+// history
+func TestMessageStamps(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{Replay: 2}, nil, nil)
+	defer reg.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	alice.send(t, command.Send, "first")
+	alice.send(t, command.Send, "second")
+	first := waitFor(t, aliceResults, "first")
+	second := waitFor(t, aliceResults, "second")
+	if first.Author != "alice" {
+		t.Fatalf("stamp: expected author alice, received %q", first.Author)
+	} else if first.Time.IsZero() || first.Time.Location() != time.UTC {
+		t.Fatalf("stamp: expected a UTC time, received %s", first.Time)
+	} else if second.ID <= first.ID {
+		t.Fatalf("stamp: expected an ID greater than %d, received %d", first.ID, second.ID)
+	}
+
+	bob := connect(t, reg, seruser.QueueConfig{}, "bob")
+	defer bob.Close()
+	replayed := waitFor(t, bob.results(), "second")
+	if replayed.ID != second.ID || replayed.Author != "alice" || !replayed.Time.Equal(second.Time) {
+		t.Fatalf("replay: expected the stamp %d %s %s, received %d %s %s",
+			second.ID, second.Author, second.Time, replayed.ID, replayed.Author, replayed.Time)
+	}
+}
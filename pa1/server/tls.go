@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// LoadTLSConfig creates the TLS configuration of the server from PEM files.
+// Client certificates are verified against the clientCA bundle if it is
+// given, and are mandatory if requireClientCert is set
+func LoadTLSConfig(certFile, keyFile, clientCA string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %s", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCA == "" {
+		if requireClientCert {
+			return nil, errors.New("load server certificate: a client CA bundle is needed to require client certificates")
+		}
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(clientCA)
+	if err != nil {
+		return nil, fmt.Errorf("load client CA: %s", err)
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("load client CA: no certificate found in %s", clientCA)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/gob"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/client"
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// certificate is a throwaway certificate written to PEM files
+type certificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// issue creates a certificate signed by the parent, a nil parent creates
+// a self-signed CA
+func issue(t *testing.T, dir, name string, parent *certificate) *certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	c := &certificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return c
+}
+
+// serveTLS accepts TLS connections the same way Chat does
+func serveTLS(t *testing.T, reg *Registry, config *tls.Config) net.Listener {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if _, err := seruser.New(reg, conn, seruser.QueueConfig{}); err != nil {
+					conn.Close()
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+func dialTLS(t *testing.T, address string, config *tls.Config) (*testClient, error) {
+	conn, err := tls.Dial("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+	c := &testClient{
+		Conn:    conn,
+		encoder: gob.NewEncoder(conn),
+		decoder: gob.NewDecoder(conn),
+	}
+	// the handshake completes once the server answers
+	if err := c.encoder.Encode(command.New(command.Create, []string{""})); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TestTLSClientCertificate tests whether the username is taken from the
+// common name of the client certificate
+func TestTLSClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := issue(t, dir, "ca", nil)
+	serverCert := issue(t, dir, "server", ca)
+	carol := issue(t, dir, "carol", ca)
+
+	serverConfig, err := LoadTLSConfig(serverCert.certFile, serverCert.keyFile, ca.certFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	listener := serveTLS(t, reg, serverConfig)
+	defer listener.Close()
+
+	clientConfig, err := client.TLSConfig(ca.certFile, carol.certFile, carol.keyFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := dialTLS(t, listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer c.Close()
+	results := c.results()
+	// the certificate picks the name
+	c.send(t, command.Create, "mallory")
+	waitFor(t, results, "your certificate names you carol")
+	c.send(t, command.Create)
+	waitFor(t, results, "Name registering")
+	c.send(t, command.Who)
+	waitFor(t, results, "carol")
+}
+
+// TestTLSRequireClientCertificate tests whether a client without a
+// certificate is refused when certificates are required
+func TestTLSRequireClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := issue(t, dir, "ca", nil)
+	serverCert := issue(t, dir, "server", ca)
+
+	serverConfig, err := LoadTLSConfig(serverCert.certFile, serverCert.keyFile, ca.certFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	listener := serveTLS(t, reg, serverConfig)
+	defer listener.Close()
+
+	// --insecure skips the verification of the server only
+	clientConfig, err := client.TLSConfig("", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := dialTLS(t, listener.Addr().String(), clientConfig)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var buf [1]byte
+	if _, err := c.Read(buf[:]); err == nil {
+		t.Fatal("a client without certificate should be refused")
+	}
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// accountArgs checks the username and password arguments of the account
+// commands
+func (su *User) accountArgs(action string, com *command.Command) (username, password string, res *result.Result) {
+	if su.getUser() != nil {
+		return "", "", result.New(result.Failure, "You already had a name")
+	}
+	if len(com.Args[0]) == 0 {
+		return "", "", result.New(result.Failure,
+			fmt.Sprintf("%s: please provide a username and a password", action))
+	} else if err := su.rooms.Settings().CheckUsername(action, com.Args[0]); err != nil {
+		return "", "", result.New(result.Failure, err.Error())
+	} else if su.certName != "" && com.Args[0] != su.certName {
+		return "", "", result.New(result.Failure,
+			fmt.Sprintf("%s: your certificate names you %s", action, su.certName))
+	}
+	return com.Args[0], com.Args[1], nil
+}
+
+// Register creates an account and signs in with it
+func (su *User) Register(com *command.Command) *result.Result {
+	username, password, res := su.accountArgs("register", com)
+	if res != nil {
+		return res
+	}
+	lobby, err := su.rooms.Register(username, password, su)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return su.signIn(username, lobby)
+}
+
+// Login signs in with an account, the password is checked by the
+// registry
+func (su *User) Login(com *command.Command) *result.Result {
+	username, password, res := su.accountArgs("login", com)
+	if res != nil {
+		return res
+	}
+	lobby, err := su.rooms.Login(username, password, su)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return su.signIn(username, lobby)
+}
+
+// signIn enters the lobby with a registered name, the messages that
+// waited in its mailbox are delivered afterwards
+func (su *User) signIn(username string, lobby *public.Room) *result.Result {
+	res := su.enter(username, lobby, false)
+	if res.Rtype != result.Success {
+		return res
+	}
+	res.Message = fmt.Sprintf("Signed in as %s", username)
+	return su.deliverMail(username, res)
+}
@@ -0,0 +1,101 @@
+package user
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// quoteLength is the number of characters of a message a reply quotes
+const quoteLength = 30
+
+// messageID parses the ID of a message, it may start with #
+func messageID(arg string) (uint64, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("%q is not a message ID", arg)
+	}
+	return id, nil
+}
+
+// quote shortens a message to remind the readers of it
+func quote(e history.Entry) string {
+	body := []rune(e.Body)
+	if len(body) > quoteLength {
+		return fmt.Sprintf("%s: %s...", e.Author, string(body[:quoteLength]))
+	}
+	return fmt.Sprintf("%s: %s", e.Author, e.Body)
+}
+
+// Edit replaces the text of a message the user wrote, the moderators edit
+// the messages of anyone
+func (su *User) Edit(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	if len(com.Args[1]) == 0 {
+		return result.New(result.Failure, "edit: please provide a message ID and a text")
+	}
+	id, err := messageID(com.Args[0])
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("edit: %s", err))
+	} else if res := mutedFailure(su.rooms, su.Username()); res != nil {
+		return res
+	} else if err := su.rooms.Settings().CheckMessage("edit", com.Args[1]); err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	if err := su.currentRoom().Edit(su, su.role >= Moderator, id, com.Args[1]); err != nil {
+		return result.New(result.Failure, fmt.Sprintf("edit: %s", err))
+	}
+	return result.New(result.Success, "")
+}
+
+// Delete deletes a message the user wrote, the moderators delete the
+// messages of anyone
+func (su *User) Delete(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	id, err := messageID(com.Args[0])
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("delete: %s", err))
+	}
+	if err := su.currentRoom().Delete(su, su.role >= Moderator, id); err != nil {
+		return result.New(result.Failure, fmt.Sprintf("delete: %s", err))
+	}
+	return result.New(result.Success, "")
+}
+
+// Reply answers a message, the reply goes to the conversation of the
+// message it answers
+func (su *User) Reply(com *command.Command) *result.Result {
+	usr := su.getUser()
+	if usr == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	if len(com.Args[1]) == 0 {
+		return result.New(result.Failure, "reply: please provide a message ID and a text")
+	}
+	id, err := messageID(com.Args[0])
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("reply: %s", err))
+	} else if res := mutedFailure(su.rooms, su.Username()); res != nil {
+		return res
+	} else if err := su.rooms.Settings().CheckMessage("reply", com.Args[1]); err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	original, err := su.currentRoom().Find(su.Username(), id)
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("reply: %s", err))
+	}
+	// the reply is stamped first so that its mentions can be mailed
+	reply := message.NewStamped(usr.Reply(id, quote(original), com.Args[1]))
+	su.getBroadcaster().Broadcaster() <- reply
+	su.notifyMentioned(reply)
+	return result.New(result.Success, "")
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/history"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// exportLimit is the largest number of messages exported at once
+const exportLimit = 10000
+
+// Export sends the history of the current room as a file
+func (su *User) Export(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	return ExportRoom(su.currentRoom(), com.Args)
+}
+
+// ExportRoom writes the history of a room in the format the first
+// argument names, plain text by default, and returns it as a File result
+func ExportRoom(pub *public.Room, args []string) *result.Result {
+	format := history.PlainText
+	if len(args) > 0 {
+		var err error
+		if format, err = history.ParseFormat(args[0]); err != nil {
+			return result.New(result.Failure, fmt.Sprintf("export: %s", err))
+		}
+	}
+	entries, err := pub.History(history.Latest, exportLimit)
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("export: %s", err))
+	}
+	now := time.Now().UTC()
+	var file bytes.Buffer
+	transcript := history.Transcript{Room: pub.Name(), Exported: now, Entries: entries}
+	if err := transcript.Write(&file, format); err != nil {
+		return result.New(result.Failure, fmt.Sprintf("export: %s", err))
+	}
+	res := result.New(result.File, file.String())
+	res.Name = fmt.Sprintf("%s-%s%s", pub.Name(), now.Format("20060102-150405"), format.Extension())
+	return res
+}
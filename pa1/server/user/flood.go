@@ -0,0 +1,170 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// strikeWindow is how long the refused commands count toward a punishment
+const strikeWindow = time.Minute
+
+var (
+	errTooManyMessages = errors.New("slow down: you are sending messages too fast")
+	errTooManyCommands = errors.New("slow down: you are sending commands too fast")
+)
+
+// bucket is a token bucket, it starts full
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if one is left, the bucket is refilled at rate
+// tokens per second up to burst tokens
+func (b *bucket) take(rate float64, burst int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else if b.tokens += now.Sub(b.last).Seconds() * rate; b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Limiter keeps a user from flooding the rooms. It is only used by the
+// goroutine that handles the commands of the user
+type Limiter struct {
+	messages bucket
+	commands bucket
+	// lastMessage is the time of the last message that was let through
+	lastMessage time.Time
+	strikes     int
+	firstStrike time.Time
+}
+
+// Allow checks a command against the limits, message is set for the chat
+// messages and slowMode is the slow mode of the room they go to. punish
+// is set once the user was refused Strikes times within a minute, the
+// slow mode does not count toward it
+func (l *Limiter) Allow(flood Flood, message bool, slowMode time.Duration, now time.Time) (punish bool, err error) {
+	if !l.commands.take(flood.CommandRate, flood.CommandBurst, now) {
+		return l.strike(flood, now), errTooManyCommands
+	}
+	if !message {
+		return false, nil
+	}
+	if wait := l.lastMessage.Add(slowMode).Sub(now); slowMode > 0 && wait > 0 {
+		return false, fmt.Errorf("slow mode: wait %s before talking again", (wait + time.Second - 1).Truncate(time.Second))
+	}
+	if !l.messages.take(flood.MessageRate, flood.MessageBurst, now) {
+		return l.strike(flood, now), errTooManyMessages
+	}
+	l.lastMessage = now
+	return false, nil
+}
+
+func (l *Limiter) strike(flood Flood, now time.Time) bool {
+	if flood.Strikes <= 0 {
+		return false
+	}
+	if now.Sub(l.firstStrike) > strikeWindow {
+		l.strikes, l.firstStrike = 0, now
+	}
+	if l.strikes++; l.strikes < flood.Strikes {
+		return false
+	}
+	l.strikes = 0
+	return true
+}
+
+// IsMessage checks whether the command sends a chat message
+func IsMessage(ctype int) bool {
+	return ctype == command.Send || ctype == command.Msg || ctype == command.Reply
+}
+
+// limit checks the command against the flood limits, refused is set when
+// the command must not be handled. The moderators and the messages said in
+// a private session ignore the slow mode
+func (su *User) limit(com *command.Command) (res *result.Result, refused bool) {
+	if com.Ctype == command.Exit {
+		return nil, false
+	}
+	flood := su.rooms.Settings().Flood
+	var slowMode time.Duration
+	if (com.Ctype == command.Send || com.Ctype == command.Reply) && su.role < Moderator && su.getUser() != nil {
+		var replyTo uint64
+		if com.Ctype == command.Reply && len(com.Args) > 0 {
+			// an invalid ID is reported by @reply
+			replyTo, _ = messageID(com.Args[0])
+		}
+		slowMode = su.currentRoom().SlowModeOf(su.Username(), replyTo)
+	}
+	punish, err := su.limiter.Allow(flood, IsMessage(com.Ctype), slowMode, time.Now())
+	if err == nil {
+		return nil, false
+	} else if punish {
+		return su.punishFlood(flood), true
+	}
+	return result.New(result.Failure, err.Error()), true
+}
+
+// punishFlood mutes the flooder, or disconnects the flooder if the server
+// is configured so or the flooder keeps on while muted
+func (su *User) punishFlood(flood Flood) *result.Result {
+	if su.getUser() != nil && !flood.Disconnect {
+		if _, muted := su.rooms.Muted(su.Username()); !muted {
+			su.rooms.Mute(su.Username(), flood.MuteFor)
+			su.announce(fmt.Sprintf("%s was muted %s for flooding.", su.Username(), ForWhile(flood.MuteFor)))
+			return result.New(result.Failure, fmt.Sprintf("You were muted %s for flooding.", ForWhile(flood.MuteFor)))
+		}
+	}
+	su.Kick("disconnected for flooding")
+	return nil
+}
+
+// SlowMode shows how long the users of the room wait between two
+// messages, the moderators change it
+func (su *User) SlowMode(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	current := su.currentRoom()
+	if len(com.Args) == 0 {
+		if delay := current.SlowMode(); delay > 0 {
+			return result.New(result.Success, fmt.Sprintf("Slow mode is on in #%s: one message every %s.", current.Name(), delay))
+		}
+		return result.New(result.Success, fmt.Sprintf("Slow mode is off in #%s.", current.Name()))
+	} else if su.role < Moderator {
+		return result.New(result.Failure, "slowmode: only moderators can do that")
+	}
+	seconds, err := strconv.Atoi(com.Args[0])
+	if com.Args[0] == "off" {
+		seconds, err = 0, nil
+	}
+	if err != nil || seconds < 0 {
+		return result.New(result.Failure, fmt.Sprintf("slowmode: invalid number of seconds %q", com.Args[0]))
+	}
+	delay := time.Duration(seconds) * time.Second
+	current.SetSlowMode(delay)
+	if delay == 0 {
+		su.announce(fmt.Sprintf("%s turned the slow mode off.", su.Username()))
+		return result.New(result.Success, "slow mode off")
+	}
+	su.announce(fmt.Sprintf("%s turned the slow mode on: one message every %s.", su.Username(), delay))
+	return result.New(result.Success, "slow mode on")
+}
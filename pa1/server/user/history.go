@@ -0,0 +1,47 @@
+package user
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+const (
+	defaultHistoryPage = 10
+	maxHistoryPage     = 100
+)
+
+// History pages through the messages of the current room that are older
+// than the ones the user had seen, every call goes further back in time.
+// The messages are sent one by one so that they keep their stamp
+func (su *User) History(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	n := defaultHistoryPage
+	if len(com.Args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(com.Args[0]); err != nil || n <= 0 {
+			return result.New(result.Failure, "history: please provide a positive number of messages")
+		}
+		if n > maxHistoryPage {
+			n = maxHistoryPage
+		}
+	}
+	pub := su.currentRoom()
+	entries, err := pub.History(su.historyCursor, n)
+	if err != nil {
+		return result.New(result.Failure, fmt.Sprintf("history: %s", err))
+	}
+	if len(entries) == 0 {
+		return result.New(result.Success, "No older messages.")
+	}
+	su.historyCursor = entries[0].Seq
+	su.enqueue(result.New(result.Success, fmt.Sprintf("History of #%s:", pub.Name())))
+	for _, entry := range entries {
+		su.enqueue(result.FromMessage(entry))
+	}
+	return result.New(result.Success, "End of history.")
+}
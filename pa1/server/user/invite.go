@@ -0,0 +1,51 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// describeInvite prints an invite from the point of view of the user
+func describeInvite(inv public.Invite, username string) string {
+	left := time.Until(inv.Expires).Round(time.Second)
+	if inv.Guest == username {
+		return fmt.Sprintf("%s invited you to %s (expires in %s)", inv.Host, inv.Session, left)
+	}
+	return fmt.Sprintf("you invited %s to %s (expires in %s)", inv.Guest, inv.Session, left)
+}
+
+// inviteName returns the optional session ID or host argument of @accept
+// and @decline
+func inviteName(com *command.Command) string {
+	if len(com.Args) == 0 {
+		return ""
+	}
+	return com.Args[0]
+}
+
+// Accept accepts an invite, the user talks in the private session
+// afterwards
+func (su *User) Accept(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	if err := su.currentRoom().Accept(su, inviteName(com)); err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return result.New(result.Success, "")
+}
+
+// Decline declines an invite, the host is told about it
+func (su *User) Decline(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	if err := su.currentRoom().Decline(su, inviteName(com)); err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return result.New(result.Success, "Invite declined.")
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// letter puts a stamped message in an envelope for the mailbox of the user
+func letter(to string, mes message.Stamper, mention bool) mailbox.Letter {
+	stamp := mes.Stamp()
+	return mailbox.Letter{
+		To:      to,
+		From:    stamp.Author,
+		ID:      stamp.ID,
+		Time:    stamp.Time,
+		Text:    mes.String(),
+		Mention: mention,
+	}
+}
+
+// mail keeps a direct message for a registered user who is offline
+func mail(rooms Rooms, to string, whisper message.Stamper) *result.Result {
+	switch err := rooms.Post(letter(to, whisper, false)); err {
+	case nil:
+		return result.New(result.Success, fmt.Sprintf("%s is offline, the message waits in the mailbox.", to))
+	case mailbox.ErrNoMailbox:
+		return result.New(result.Failure, fmt.Sprintf("message not sent: %s is offline", to))
+	default:
+		return result.New(result.Failure, fmt.Sprintf("message not sent: %s is offline and %s", to, err))
+	}
+}
+
+// deliverMail sends the messages that waited for the user once the user
+// entered the lobby, res is the result of entering
+func (su *User) deliverMail(username string, res *result.Result) *result.Result {
+	letters := su.rooms.Collect(username)
+	if len(letters) == 0 {
+		return res
+	}
+	su.enqueue(res)
+	return DeliverMail(letters, func(delivered *result.Result) {
+		if delivered.Mentioned {
+			su.remember(delivered)
+		}
+		su.enqueue(delivered)
+	})
+}
+
+// DeliverMail sends the messages collected from the mailbox of the user
+// to the sink and returns the result that ends them. The terminal and the
+// browser users both read their mail with it
+func DeliverMail(letters []mailbox.Letter, sink func(*result.Result)) *result.Result {
+	waited := fmt.Sprintf("%d messages waited for you:", len(letters))
+	if len(letters) == 1 {
+		waited = "1 message waited for you:"
+	}
+	sink(result.New(result.Success, waited))
+	for _, l := range letters {
+		delivered := result.New(result.Message, l.Text)
+		delivered.ID, delivered.Time, delivered.Author = l.ID, l.Time, l.From
+		delivered.Mentioned = l.Mention
+		sink(delivered)
+	}
+	return result.New(result.Success, "End of mailbox.")
+}
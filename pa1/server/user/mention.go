@@ -0,0 +1,118 @@
+package user
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// mentionLimit is the number of mentions a user can list with @mentions
+const mentionLimit = 20
+
+type mentionsGetter struct {
+	sync.WaitGroup
+	mentions []*result.Result
+}
+
+// markMention marks the result of a chat message that mentions the user,
+// it reports whether the message mentions the user
+func (su *User) markMention(mes message.Message, res *result.Result) bool {
+	stamper, ok := mes.(message.Stamper)
+	if !ok || res.Rtype != result.Message {
+		return false
+	}
+	res.Mentioned = stamper.Stamp().Mentioned(su.Username())
+	return res.Mentioned
+}
+
+// remember keeps a mention for @mentions
+func (su *User) remember(res *result.Result) {
+	select {
+	case su.mentionChan <- res:
+	case <-su.done:
+	}
+}
+
+// rememberMention adds a mention to the recent ones, the messages
+// replayed to the user are only kept once and the oldest mentions are
+// forgotten
+func rememberMention(mentions []*result.Result, res *result.Result) []*result.Result {
+	for _, kept := range mentions {
+		if kept.ID == res.ID {
+			return mentions
+		}
+	}
+	mentions = append(mentions, res)
+	if len(mentions) > mentionLimit {
+		mentions = mentions[len(mentions)-mentionLimit:]
+	}
+	return mentions
+}
+
+func (su *User) getMentions() []*result.Result {
+	getter := mentionsGetter{}
+	getter.Add(1)
+	su.mentionsRequest <- &getter
+	getter.Wait()
+	return getter.mentions
+}
+
+// notifyMentioned tells the user which of the users the message mentions
+// are not online
+func (su *User) notifyMentioned(mes message.Stamper) {
+	for _, res := range mentionNotices(su.rooms, su.Username(), mes) {
+		su.enqueue(res)
+	}
+}
+
+// mentionNotices returns the notices of the users the message of the
+// author mentions that are not online, the message waits in the mailbox
+// of the offline ones
+func mentionNotices(rooms Rooms, author string, mes message.Stamper) []*result.Result {
+	var notices []*result.Result
+	for _, name := range mes.Stamp().Mentions {
+		if name == author {
+			continue
+		}
+		if target, ok := rooms.Lookup(name); ok {
+			if notice := AwayNotice(target); notice != "" {
+				notices = append(notices, result.New(result.Message, notice))
+			}
+			continue
+		}
+		switch err := rooms.Post(letter(name, mes, true)); err {
+		case nil:
+			notices = append(notices, result.New(result.Message,
+				fmt.Sprintf("%s is offline, the mention waits in the mailbox", name)))
+		case mailbox.ErrNoMailbox:
+			// the guests are not told, they may never come back
+		default:
+			notices = append(notices, result.New(result.Message, fmt.Sprintf("%s is offline: %s", name, err)))
+		}
+	}
+	return notices
+}
+
+// Mentions lists the recent messages that mentioned the user, wherever
+// the user received them
+func (su *User) Mentions(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	mentions := su.getMentions()
+	if len(mentions) == 0 {
+		return result.New(result.Success, "Nobody mentioned you yet.")
+	}
+	su.enqueue(result.New(result.Success, "Mentions of you:"))
+	for _, res := range mentions {
+		// the list does not ring the bell again
+		listed := *res
+		listed.Mentioned = false
+		su.enqueue(&listed)
+	}
+	return result.New(result.Success, "End of mentions.")
+}
@@ -0,0 +1,223 @@
+package user
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// Role is the rank of a user, a higher role moderates the lower ones
+type Role int
+
+const (
+	// Member is the role of every guest and registered user
+	Member Role = iota
+	// Moderator can kick, ban and mute the members
+	Moderator
+	// Owner can also moderate the moderators
+	Owner
+)
+
+var roleNames = map[Role]string{
+	Member:    "member",
+	Moderator: "moderator",
+	Owner:     "owner",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// Moderation keeps the roles, the bans and the mutes of the server. A
+// zero time means the ban or the mute lasts until it is lifted
+type Moderation interface {
+	// Role returns the role of a registered user
+	Role(username string) Role
+	// Kick forces an online user out of the server
+	Kick(username, reason string) bool
+	// Ban bans a username or an IP address and kicks the users it
+	// matches, a zero duration bans forever
+	Ban(target, by string, duration time.Duration) []string
+	// Unban lifts the ban of a username or an IP address
+	Unban(target string) bool
+	// Banned checks whether a username or an IP address is banned
+	Banned(target string) bool
+	// Mute keeps a user from sending messages to the rooms, a zero
+	// duration mutes until the user is unmuted
+	Mute(username string, duration time.Duration)
+	// Unmute lets a muted user speak again
+	Unmute(username string) bool
+	// Muted checks whether the user is muted and until when
+	Muted(username string) (until time.Time, muted bool)
+}
+
+// Kickable is a user that can be forced out of the server
+type Kickable interface {
+	Kick(reason string)
+}
+
+// Drainable is a user the server waits for when it shuts down
+type Drainable interface {
+	Kickable
+	// Closed is closed once the queued results were flushed and the
+	// connection was closed
+	Closed() <-chan struct{}
+	// ForceClose closes the connection without waiting for the queued
+	// results to be flushed
+	ForceClose()
+}
+
+// Kick signs the user out from another goroutine. The pending read is
+// interrupted so that the command handler signs the user out
+func (su *User) Kick(reason string) {
+	su.kicked.Store(reason)
+	su.enqueue(result.New(result.Exit, fmt.Sprintf("You were %s", reason)))
+	su.Conn.SetReadDeadline(time.Now())
+	// a user waiting for the client to resume is signed out right away
+	select {
+	case su.wake <- struct{}{}:
+	default:
+	}
+}
+
+// kickReason returns why the user was kicked, empty if it was not
+func (su *User) kickReason() string {
+	reason, _ := su.kicked.Load().(string)
+	return reason
+}
+
+// ForWhile describes how long a ban or a mute lasts
+func ForWhile(duration time.Duration) string {
+	if duration == 0 {
+		return "until further notice"
+	}
+	return fmt.Sprintf("for %s", duration)
+}
+
+// moderate checks whether the user may moderate the target
+func (su *User) moderate(action, target string) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	} else if su.role < Moderator {
+		return result.New(result.Failure, fmt.Sprintf("%s: only moderators can do that", action))
+	} else if target == su.Username() {
+		return result.New(result.Failure, fmt.Sprintf("%s: you cannot moderate yourself", action))
+	} else if net.ParseIP(target) == nil && su.rooms.Role(target) >= su.role {
+		return result.New(result.Failure, fmt.Sprintf("%s: %s is not below you", action, target))
+	}
+	return nil
+}
+
+// announce notifies the room the moderator stays in
+func (su *User) announce(text string) {
+	su.currentRoom().Broadcaster() <- public.Notification(text)
+}
+
+// parseDuration parses the optional duration argument
+func parseDuration(action string, args []string) (time.Duration, *result.Result) {
+	if len(args) < 2 {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(args[1])
+	if err != nil || duration < 0 {
+		return 0, result.New(result.Failure, fmt.Sprintf("%s: invalid duration %q, e.g. 10m or 2h", action, args[1]))
+	}
+	return duration, nil
+}
+
+// KickUser forces a user out of the server
+func (su *User) KickUser(com *command.Command) *result.Result {
+	target := com.Args[0]
+	if res := su.moderate("kick", target); res != nil {
+		return res
+	}
+	reason := fmt.Sprintf("kicked by %s", su.Username())
+	if len(com.Args) > 1 && strings.TrimSpace(com.Args[1]) != "" {
+		reason += ": " + strings.TrimSpace(com.Args[1])
+	}
+	if !su.rooms.Kick(target, reason) {
+		return result.New(result.Failure, fmt.Sprintf("kick: %s is offline", target))
+	}
+	return result.New(result.Success, fmt.Sprintf("%s was kicked", target))
+}
+
+// Ban bans a username or an IP address
+func (su *User) Ban(com *command.Command) *result.Result {
+	target := com.Args[0]
+	if res := su.moderate("ban", target); res != nil {
+		return res
+	}
+	duration, res := parseDuration("ban", com.Args)
+	if res != nil {
+		return res
+	}
+	kicked := su.rooms.Ban(target, su.Username(), duration)
+	su.announce(fmt.Sprintf("%s was banned by %s %s.", target, su.Username(), ForWhile(duration)))
+	if len(kicked) > 0 {
+		return result.New(result.Success, fmt.Sprintf("%s banned, kicked %s", target, strings.Join(kicked, ", ")))
+	}
+	return result.New(result.Success, fmt.Sprintf("%s banned", target))
+}
+
+// Unban lifts the ban of a username or an IP address
+func (su *User) Unban(com *command.Command) *result.Result {
+	target := com.Args[0]
+	if res := su.moderate("unban", target); res != nil {
+		return res
+	}
+	if !su.rooms.Unban(target) {
+		return result.New(result.Failure, fmt.Sprintf("unban: %s is not banned", target))
+	}
+	su.announce(fmt.Sprintf("%s was unbanned by %s.", target, su.Username()))
+	return result.New(result.Success, fmt.Sprintf("%s unbanned", target))
+}
+
+// Mute keeps a user from sending messages to the rooms
+func (su *User) Mute(com *command.Command) *result.Result {
+	target := com.Args[0]
+	if res := su.moderate("mute", target); res != nil {
+		return res
+	}
+	duration, res := parseDuration("mute", com.Args)
+	if res != nil {
+		return res
+	}
+	su.rooms.Mute(target, duration)
+	if usr, ok := su.rooms.Lookup(target); ok {
+		usr.Receive(public.Notification(fmt.Sprintf("You were muted by %s %s.", su.Username(), ForWhile(duration))))
+	}
+	su.announce(fmt.Sprintf("%s was muted by %s %s.", target, su.Username(), ForWhile(duration)))
+	return result.New(result.Success, fmt.Sprintf("%s muted", target))
+}
+
+// Unmute lets a muted user speak again
+func (su *User) Unmute(com *command.Command) *result.Result {
+	target := com.Args[0]
+	if res := su.moderate("unmute", target); res != nil {
+		return res
+	}
+	if !su.rooms.Unmute(target) {
+		return result.New(result.Failure, fmt.Sprintf("unmute: %s is not muted", target))
+	}
+	if usr, ok := su.rooms.Lookup(target); ok {
+		usr.Receive(public.Notification(fmt.Sprintf("You were unmuted by %s.", su.Username())))
+	}
+	su.announce(fmt.Sprintf("%s was unmuted by %s.", target, su.Username()))
+	return result.New(result.Success, fmt.Sprintf("%s unmuted", target))
+}
+
+// mutedFailure returns a failure if the username is muted
+func mutedFailure(rooms Rooms, username string) *result.Result {
+	until, muted := rooms.Muted(username)
+	if !muted {
+		return nil
+	} else if until.IsZero() {
+		return result.New(result.Failure, "message not sent: you are muted")
+	}
+	return result.New(result.Failure, fmt.Sprintf("message not sent: you are muted until %s", until.Format("15:04:05")))
+}
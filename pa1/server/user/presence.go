@@ -0,0 +1,147 @@
+package user
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// Presence tells the others whether a user is around
+type Presence int
+
+const (
+	// Online is the presence of every active user
+	Online Presence = iota
+	// Away is set with @away or after the user was idle for a while
+	Away
+	// Busy is set with @busy
+	Busy
+)
+
+// DefaultIdleAfter is how long the users wait without sending a command
+// before they are away
+const DefaultIdleAfter = 10 * time.Minute
+
+var presenceNames = map[Presence]string{
+	Online: "online",
+	Away:   "away",
+	Busy:   "busy",
+}
+
+func (p Presence) String() string {
+	return presenceNames[p]
+}
+
+// Status is the presence of a user and the reason the user gave for it
+type Status struct {
+	Presence Presence
+	Reason   string
+	// Idle is set when the user is away because no command was received
+	// for a while
+	Idle bool
+}
+
+func (s Status) String() string {
+	if s.Reason == "" {
+		return s.Presence.String()
+	}
+	return fmt.Sprintf("%s: %s", s.Presence, s.Reason)
+}
+
+// Present is a user that shows its presence to the others
+type Present interface {
+	Status() Status
+}
+
+// StatusOf returns the status of a user, the users that do not show
+// their presence are online
+func StatusOf(usr room.User) Status {
+	if present, ok := usr.(Present); ok {
+		return present.Status()
+	}
+	return Status{}
+}
+
+// presenceOf describes the status of a user next to its name, nothing is
+// added for the online users
+func presenceOf(usr room.User) string {
+	if status := StatusOf(usr); status.Presence != Online {
+		return fmt.Sprintf(" (%s)", status)
+	}
+	return ""
+}
+
+// AwayNotice tells the sender of a direct message or a mention that the
+// user may not answer, it is empty if the user is online
+func AwayNotice(usr room.User) string {
+	status := StatusOf(usr)
+	if status.Presence == Online {
+		return ""
+	}
+	return fmt.Sprintf("%s is %s", usr.Username(), status)
+}
+
+// Status implements the Present interface. The status the user picked
+// wins over the idle detection
+func (su *User) Status() Status {
+	if status, ok := su.status.Load().(Status); ok && status.Presence != Online {
+		return status
+	}
+	idleAfter := su.rooms.Settings().IdleAfter
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&su.lastInput)))
+	if idleAfter > 0 && idle >= idleAfter {
+		return Status{
+			Presence: Away,
+			Reason:   fmt.Sprintf("idle for %s", idle.Round(time.Second)),
+			Idle:     true,
+		}
+	}
+	return Status{}
+}
+
+// touch records that the user just sent a command
+func (su *User) touch() {
+	atomic.StoreInt64(&su.lastInput, time.Now().UnixNano())
+}
+
+// presenceReason returns the optional reason of @away and @busy
+func presenceReason(com *command.Command) string {
+	if len(com.Args) == 0 {
+		return ""
+	}
+	return com.Args[0]
+}
+
+// Away marks the user away until @back
+func (su *User) Away(com *command.Command) *result.Result {
+	return su.setPresence(Status{Presence: Away, Reason: presenceReason(com)})
+}
+
+// Busy marks the user busy until @back
+func (su *User) Busy(com *command.Command) *result.Result {
+	return su.setPresence(Status{Presence: Busy, Reason: presenceReason(com)})
+}
+
+// Back marks the user online again
+func (su *User) Back(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	if status, _ := su.status.Load().(Status); status.Presence == Online {
+		return result.New(result.Failure, "back: you were not away")
+	}
+	su.status.Store(Status{})
+	return result.New(result.Success, "Welcome back.")
+}
+
+func (su *User) setPresence(status Status) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	su.status.Store(status)
+	return result.New(result.Success, fmt.Sprintf("You are %s.", status))
+}
@@ -0,0 +1,181 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// DropPolicy tells what happens when the outbound queue of a user is full
+type DropPolicy int
+
+const (
+	// DropOldest drops the oldest queued results and tells the client
+	// how many messages were skipped
+	DropOldest DropPolicy = iota
+	// Disconnect closes the connection of the slow client
+	Disconnect
+)
+
+const (
+	// DefaultQueueSize is the outbound queue size used when none is given
+	DefaultQueueSize = 256
+	// writeTimeout is how long a single result may take to be written
+	writeTimeout = 30 * time.Second
+	// handshakeTimeout is how long the TLS handshake may take
+	handshakeTimeout = 10 * time.Second
+)
+
+// QueueConfig configures the outbound queue of every user
+type QueueConfig struct {
+	Size   int
+	Policy DropPolicy
+}
+
+func (qc QueueConfig) size() int {
+	if qc.Size <= 0 {
+		return DefaultQueueSize
+	}
+	return qc.Size
+}
+
+// ParseDropPolicy reads a drop policy from its name
+func ParseDropPolicy(name string) (DropPolicy, error) {
+	switch name {
+	case "drop":
+		return DropOldest, nil
+	case "disconnect":
+		return Disconnect, nil
+	}
+	return DropOldest, fmt.Errorf("unknown drop policy %q", name)
+}
+
+// queueCounters are updated by every goroutine that queues a result, hence
+// the atomic operations
+type queueCounters struct {
+	// skipped is the number of results dropped since the last notice
+	skipped int64
+	// dropped is the total number of results dropped
+	dropped int64
+	peak    int64
+	slow    int32
+}
+
+func (qc *queueCounters) isSlow() bool {
+	return atomic.LoadInt32(&qc.slow) == 1
+}
+
+// QueueStats describes the outbound queue of a user
+type QueueStats struct {
+	Depth    int
+	Capacity int
+	Peak     int
+	Dropped  int
+}
+
+// QueueStats returns the statistics of the outbound queue
+func (su *User) QueueStats() QueueStats {
+	return QueueStats{
+		Depth:    len(su.outbox),
+		Capacity: cap(su.outbox),
+		Peak:     int(atomic.LoadInt64(&su.stats.peak)),
+		Dropped:  int(atomic.LoadInt64(&su.stats.dropped)),
+	}
+}
+
+// enqueue queues a result without blocking, the drop policy decides what
+// to do when the queue is full
+func (su *User) enqueue(res *result.Result) {
+	for {
+		select {
+		case su.outbox <- res:
+			su.recordDepth(int64(len(su.outbox)))
+			return
+		default:
+		}
+		if su.queue.Policy == Disconnect {
+			su.disconnectSlow()
+			return
+		}
+		// make room by dropping the oldest result
+		select {
+		case <-su.outbox:
+			atomic.AddInt64(&su.stats.skipped, 1)
+			if atomic.AddInt64(&su.stats.dropped, 1) == 1 {
+				log.Printf("user %s is too slow, dropping messages", su.RemoteAddr().String())
+			}
+		default:
+		}
+	}
+}
+
+func (su *User) recordDepth(depth int64) {
+	for {
+		peak := atomic.LoadInt64(&su.stats.peak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&su.stats.peak, peak, depth) {
+			return
+		}
+	}
+}
+
+// disconnectSlow closes the connection once, the command handler notices
+// it and signs the user out
+func (su *User) disconnectSlow() {
+	if atomic.CompareAndSwapInt32(&su.stats.slow, 0, 1) {
+		su.Conn.Close()
+	}
+}
+
+// writeResults is the only subroutine that writes to the socket. When the
+// user is done the queued results are flushed and the connection is closed
+func (su *User) writeResults() {
+	defer close(su.closed)
+	defer su.Conn.Close()
+	for {
+		select {
+		case <-su.done:
+			for {
+				select {
+				case res := <-su.outbox:
+					if err := su.write(res); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case res := <-su.outbox:
+			for {
+				err := su.write(res)
+				if err == nil {
+					break
+				}
+				su.handleCommunicationError("sends results to the client", err)
+				// the result is sent again once the session is resumed
+				if !su.waitForResume() {
+					return
+				}
+			}
+		}
+	}
+}
+
+// write sends a result, a notice is sent first if results were skipped
+func (su *User) write(res *result.Result) error {
+	if skipped := atomic.SwapInt64(&su.stats.skipped, 0); skipped > 0 {
+		notice := result.New(result.Failure,
+			fmt.Sprintf("%d messages skipped: you are receiving messages too slowly", skipped))
+		if err := su.encode(notice); err != nil {
+			return err
+		}
+	}
+	return su.encode(res)
+}
+
+func (su *User) encode(res *result.Result) error {
+	su.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return su.codec.Encode(res)
+}
@@ -0,0 +1,141 @@
+package user
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/codec"
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// DefaultResumeGrace is how long the seat of a disconnected user is held
+// for the client to resume the session
+const DefaultResumeGrace = 30 * time.Second
+
+// errExpired is returned when no session can be resumed with the token
+var errExpired = errors.New("resume: the session expired, pick a name again")
+
+// link is the connection of a user, the client replaces it when it
+// resumes the session over a new connection. link implements net.Conn
+// and codec.Codec, every call goes to the current connection
+type link struct {
+	current atomic.Value
+}
+
+type connection struct {
+	net.Conn
+	codec codec.Codec
+}
+
+func newLink(conn net.Conn, cod codec.Codec) *link {
+	l := &link{}
+	l.current.Store(&connection{Conn: conn, codec: cod})
+	return l
+}
+
+func (l *link) conn() *connection {
+	return l.current.Load().(*connection)
+}
+
+// replace makes the link use the new connection
+func (l *link) replace(conn net.Conn, cod codec.Codec) {
+	l.current.Store(&connection{Conn: conn, codec: cod})
+}
+
+func (l *link) Read(b []byte) (int, error)         { return l.conn().Read(b) }
+func (l *link) Write(b []byte) (int, error)        { return l.conn().Write(b) }
+func (l *link) Close() error                       { return l.conn().Close() }
+func (l *link) LocalAddr() net.Addr                { return l.conn().LocalAddr() }
+func (l *link) RemoteAddr() net.Addr               { return l.conn().RemoteAddr() }
+func (l *link) SetDeadline(t time.Time) error      { return l.conn().SetDeadline(t) }
+func (l *link) SetReadDeadline(t time.Time) error  { return l.conn().SetReadDeadline(t) }
+func (l *link) SetWriteDeadline(t time.Time) error { return l.conn().SetWriteDeadline(t) }
+func (l *link) Encode(v interface{}) error         { return l.conn().codec.Encode(v) }
+func (l *link) Decode(v interface{}) error         { return l.conn().codec.Decode(v) }
+func (l *link) Name() string                       { return l.conn().codec.Name() }
+
+// attachOperation hands a new connection over to a held user
+type attachOperation struct {
+	sync.WaitGroup
+	conn  net.Conn
+	codec codec.Codec
+	ok    bool
+}
+
+// resume hands the connection over to the user the token was issued to,
+// the user keeps its rooms and receives the results queued meanwhile
+func resume(rooms Rooms, conn net.Conn, cod codec.Codec, certName string, com *command.Command) (*User, error) {
+	var su *User
+	if len(com.Args) == 1 {
+		if held, ok := rooms.Resume(com.Args[0]); ok {
+			su, _ = held.(*User)
+		}
+	}
+	if su == nil || !su.attach(conn, cod, certName) {
+		cod.Encode(result.New(result.Failure, errExpired.Error()))
+		return nil, errExpired
+	}
+	return su, nil
+}
+
+// attach replaces the connection of the user. The previous connection is
+// closed first in case the server did not notice it was lost
+func (su *User) attach(conn net.Conn, cod codec.Codec, certName string) bool {
+	if su.certName != certName || su.stats.isSlow() || su.kickReason() != "" {
+		return false
+	}
+	op := attachOperation{conn: conn, codec: cod}
+	op.Add(1)
+	su.Conn.Close()
+	select {
+	case su.attachChan <- &op:
+	case <-su.done:
+		return false
+	}
+	op.Wait()
+	return op.ok
+}
+
+// hold waits for the client to resume the session once its connection
+// was lost, it reports whether the session was resumed. The seat is held
+// for the grace period unless the user was kicked meanwhile
+func (su *User) hold() bool {
+	grace := su.rooms.Settings().ResumeGrace
+	if grace <= 0 || su.getUser() == nil || su.stats.isSlow() || su.kickReason() != "" {
+		return false
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case op := <-su.attachChan:
+		su.link.replace(op.conn, op.codec)
+		op.ok = true
+		op.Done()
+		su.enqueue(result.New(result.Success, "Session resumed."))
+		// the writer retries the result it failed to write
+		select {
+		case su.resumed <- struct{}{}:
+		default:
+		}
+		return true
+	case <-su.wake:
+	case <-timer.C:
+	case <-su.done:
+	}
+	return false
+}
+
+// waitForResume blocks the writer until the session is resumed, it
+// reports false once the user is done
+func (su *User) waitForResume() bool {
+	select {
+	case <-su.resumed:
+		return true
+	case <-su.done:
+		return false
+	}
+}
@@ -0,0 +1,145 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/mailbox"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// Rooms is the registry of named public rooms the user moves between, it
+// also owns the usernames
+type Rooms interface {
+	// Lobby returns the room every user is put in after picking a name
+	Lobby() *public.Room
+	// Claim reserves a username server-wide for a guest and takes a seat
+	// in the lobby
+	Claim(username string, user room.User) (*public.Room, error)
+	// Register creates an account and claims its username
+	Register(username, password string, user room.User) (*public.Room, error)
+	// Login checks the password of an account and claims its username
+	Login(username, password string, user room.User) (*public.Room, error)
+	// Join takes a seat in the named room, creating it if needed
+	Join(username, name string) (*public.Room, error)
+	// Vacate gives up a seat of the named room
+	Vacate(name string)
+	// Release gives up the username and the seat it takes
+	Release(username string)
+	// Lookup finds the user that claimed the username
+	Lookup(username string) (room.User, bool)
+	// Rooms lists the open rooms
+	Rooms() []RoomInfo
+	// Settings returns the current limits of the users
+	Settings() Settings
+	// ResumeToken issues the token that resumes the session of the user
+	// once its connection was lost
+	ResumeToken(username string) string
+	// Resume finds the user the token was issued to
+	Resume(token string) (room.User, bool)
+	// Post keeps a message for a registered user who is offline
+	Post(letter mailbox.Letter) error
+	// Collect takes the messages kept for the user
+	Collect(username string) []mailbox.Letter
+	Moderation
+}
+
+// RoomInfo describes an open room
+type RoomInfo struct {
+	Name  string
+	Users int
+}
+
+type roomGetter struct {
+	sync.WaitGroup
+	room *public.Room
+}
+
+// currentRoom returns the room the user broadcasts to
+func (su *User) currentRoom() *public.Room {
+	getter := roomGetter{}
+	getter.Add(1)
+	su.getRoomRequest <- &getter
+	getter.Wait()
+	return getter.room
+}
+
+// move moves the user from the current room to the named room, enter is
+// called with the next room before the user is added to it
+func move(rooms Rooms, usr room.User, current *public.Room, name string, enter func(*public.Room)) *result.Result {
+	next, err := rooms.Join(usr.Username(), name)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	current.Remove(usr.Username())
+	current.Broadcaster() <- message.NewConcrete(&color.Reset,
+		fmt.Sprintf("%s left for #%s.", usr.String(), name))
+	rooms.Vacate(current.Name())
+	enter(next)
+	next.Adder() <- usr
+	return result.New(result.Success, fmt.Sprintf("You are now in #%s", name))
+}
+
+// JoinRoom moves the user from the current room to the room a @join
+// names, the terminal and the browser users both join with it
+func JoinRoom(rooms Rooms, usr room.User, current *public.Room, com *command.Command,
+	enter func(*public.Room)) *result.Result {
+	return move(rooms, usr, current, strings.TrimPrefix(com.Args[0], "#"), enter)
+}
+
+// LeaveRoom moves the user from the current room back to the lobby
+func LeaveRoom(rooms Rooms, usr room.User, current *public.Room, com *command.Command,
+	enter func(*public.Room)) *result.Result {
+	if len(com.Args) > 0 {
+		if name := strings.TrimPrefix(com.Args[0], "#"); name != current.Name() {
+			return result.New(result.Failure, fmt.Sprintf("leave room: you are not in #%s", name))
+		}
+	}
+	lobby := rooms.Lobby()
+	if current == lobby {
+		return result.New(result.Failure, "leave room: you cannot leave the lobby, use @exit to sign out")
+	}
+	return move(rooms, usr, current, lobby.Name(), enter)
+}
+
+// enterRoom makes the room the current room of the user
+func (su *User) enterRoom(next *public.Room) {
+	su.historyCursor = 0
+	su.setRoom <- next
+}
+
+// Join moves the user to a named room
+func (su *User) Join(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	return JoinRoom(su.rooms, su, su.currentRoom(), com, su.enterRoom)
+}
+
+// Leave leaves the current room and goes back to the lobby
+func (su *User) Leave(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	return LeaveRoom(su.rooms, su, su.currentRoom(), com, su.enterRoom)
+}
+
+// Rooms lists every open room
+func (su *User) Rooms(com *command.Command) *result.Result {
+	current := su.currentRoom()
+	res := fmt.Sprintf("\n%sRooms:\n", color.Reset.String())
+	for _, info := range su.rooms.Rooms() {
+		marker := " "
+		if info.Name == current.Name() {
+			marker = "*"
+		}
+		res += fmt.Sprintf("\t%s #%s (%d)\n", marker, info.Name, info.Users)
+	}
+	return result.New(result.Success, res)
+}
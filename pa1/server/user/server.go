@@ -3,19 +3,22 @@
 package user
 
 import (
-	"encoding/gob"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/iocat/rutgers-cs352/pa1/codec"
 	"github.com/iocat/rutgers-cs352/pa1/command"
 	"github.com/iocat/rutgers-cs352/pa1/model/color"
 	"github.com/iocat/rutgers-cs352/pa1/model/message"
 	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
-	"github.com/iocat/rutgers-cs352/pa1/model/room/private"
 	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
 	"github.com/iocat/rutgers-cs352/pa1/model/user"
 	"github.com/iocat/rutgers-cs352/pa1/result"
@@ -29,34 +32,78 @@ import (
 // server.User also wraps around model.User
 type User struct {
 	user.User
+	// Conn and codec are the link, they follow the connection the
+	// client resumes the session over
 	net.Conn
-	encoder *gob.Encoder
-	decoder *gob.Decoder
+	codec codec.Codec
+	link  *link
+	// certName is the common name of the client certificate, it is the
+	// only username the user can pick
+	certName string
+	// role is set when the user signs in, it is only accessed by the
+	// command handler
+	role Role
+	// kicked holds the reason the user was kicked for
+	kicked atomic.Value
+	// status holds the Status the user picked with @away or @busy
+	status atomic.Value
+	// mentions are the recent results that mentioned the user, they are
+	// only accessed by synchronizeMessage
+	mentions []*result.Result
+	// lastInput is the time of the last command in Unix nanoseconds, it
+	// is accessed atomically
+	lastInput int64
+	// limiter keeps the user from flooding, it is only accessed by the
+	// command handler
+	limiter Limiter
+
+	// outbox queues every result sent to the client, the queue is
+	// drained by writeResults which is the only one that encodes
+	outbox chan *result.Result
+	queue  QueueConfig
+	stats  *queueCounters
 
 	errChan chan error
 
-	// public is the room where the user stays forever
-	public *public.Room
+	// rooms is the registry of the rooms the user can move between
+	rooms Rooms
+	// room is the public room the user currently stays in
+	room *public.Room
+	// historyCursor is the oldest message of the room the user paged
+	// through with @history, it is only accessed by the command handler
+	historyCursor uint64
 	// broadcaster is the room that this user sends the message to everyone in it
 	broadcaster room.Broadcaster
-	// receives message than sends to the broadcaster
-	broadcastMessageChan chan message.Message
-	// messageChan is the message channel this user receives message from
-	messageChan chan message.Message
 	// receiveBroadcaster receives a new broadcaster that this user wants
 	// to receive message from
-	receiveBroadcaster chan room.Broadcaster
-	removeUserRequest  chan *sync.WaitGroup
-	getUserRequest     chan *userGetter
-	createRequest      chan *userCreator
+	receiveBroadcaster    chan room.Broadcaster
+	getBroadcasterRequest chan *broadcasterGetter
+	removeUserRequest     chan *sync.WaitGroup
+	getUserRequest        chan *userGetter
+	createRequest         chan *userCreator
+	getRoomRequest        chan *roomGetter
+	setRoom               chan *public.Room
+	mentionChan           chan *result.Result
+	mentionsRequest       chan *mentionsGetter
+
+	// attachChan hands the connection of a resumed session to the
+	// command handler, resumed then wakes up the writer and wake
+	// interrupts the wait of a kicked user
+	attachChan chan *attachOperation
+	resumed    chan struct{}
+	wake       chan struct{}
 
-	done chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	// closed is closed by writeResults once the connection is closed
+	closed chan struct{}
 }
 
 type userCreator struct {
 	err error
 	sync.WaitGroup
 	username string
+	guest    bool
 }
 
 type userGetter struct {
@@ -64,17 +111,38 @@ type userGetter struct {
 	user.User
 }
 
+type broadcasterGetter struct {
+	sync.WaitGroup
+	room.Broadcaster
+}
+
 func (su *User) Done() <-chan struct{} {
 	return su.done
 }
 
+// Closed implements the Drainable interface
+func (su *User) Closed() <-chan struct{} {
+	return su.closed
+}
+
+// ForceClose implements the Drainable interface
+func (su *User) ForceClose() {
+	su.Conn.Close()
+}
+
 func (su *User) Error() chan<- error {
 	return su.errChan
 }
 
-// Receive receives a message
+// Receive queues a message to be sent to the client, it never blocks
+// the room that sends the message. The mentions of the user are marked
+// and kept for @mentions
 func (su *User) Receive(mes message.Message) {
-	su.messageChan <- mes
+	res := result.FromMessage(mes)
+	if su.markMention(mes, res) {
+		su.remember(res)
+	}
+	su.enqueue(res)
 }
 
 // SetBroadcaster sets the Broadcaster of the user
@@ -84,47 +152,81 @@ func (su *User) SetBroadcaster(broadcaster room.Broadcaster) {
 
 // New creates a new user, adds the user to the public room, and spawns
 // subroutines that actively communicates with clients
-func New(pub *public.Room, conn net.Conn) (*User, error) {
+func New(rooms Rooms, conn net.Conn, queue QueueConfig) (*User, error) {
 	var (
 		newUser user.User
 		com     *command.Command
 		res     *result.Result
 		err     error
-		encoder = gob.NewEncoder(conn)
-		decoder = gob.NewDecoder(conn)
+		cod     codec.Codec
 	)
 
+	var certName string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err = tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("fail to create a new user: %s", err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			certName = certs[0].Subject.CommonName
+		}
+	}
+	// the client picks the wire format with its first byte
+	if cod, err = codec.Detect(conn); err != nil {
+		return nil, fmt.Errorf("fail to create a new user: %s", err)
+	}
 	com = &command.Command{}
-	decoder.Decode(com)
+	if err = cod.Decode(com); err != nil {
+		return nil, fmt.Errorf("fail to create a new user: %s", err)
+	}
+	if com.Ctype == command.Resume {
+		return resume(rooms, conn, cod, certName, com)
+	}
 	// Not an expected command
 	if com.Ctype != command.Create {
 		err = errors.New("fail to create a new user: invalid command type")
 		res = result.New(result.Failure, err.Error())
-		encoder.Encode(res)
+		cod.Encode(res)
 		return nil, err
 	} else if len(com.Args) == 0 {
 		err = errors.New("fail to create a new user: no username is received")
 		res = result.New(result.Failure, err.Error())
-		encoder.Encode(res)
+		cod.Encode(res)
 		return nil, err
 	}
+	l := newLink(conn, cod)
 	serverUser := &User{
 		User:        newUser,
-		Conn:        conn,
-		encoder:     encoder,
-		decoder:     decoder,
-		public:      pub,
-		broadcaster: pub,
-
-		messageChan:          make(chan message.Message),
-		receiveBroadcaster:   make(chan room.Broadcaster),
-		broadcastMessageChan: make(chan message.Message),
-		errChan:              make(chan error),
-		done:                 make(chan struct{}),
-		removeUserRequest:    make(chan *sync.WaitGroup),
-		getUserRequest:       make(chan *userGetter),
-		createRequest:        make(chan *userCreator),
+		Conn:        l,
+		codec:       l,
+		link:        l,
+		certName:    certName,
+		rooms:       rooms,
+		room:        rooms.Lobby(),
+		broadcaster: rooms.Lobby(),
+		outbox:      make(chan *result.Result, queue.size()),
+		queue:       queue,
+		stats:       &queueCounters{},
+		lastInput:   time.Now().UnixNano(),
+
+		receiveBroadcaster:    make(chan room.Broadcaster),
+		getBroadcasterRequest: make(chan *broadcasterGetter),
+		errChan:               make(chan error),
+		done:                  make(chan struct{}),
+		closed:                make(chan struct{}),
+		removeUserRequest:     make(chan *sync.WaitGroup),
+		getUserRequest:        make(chan *userGetter),
+		createRequest:         make(chan *userCreator),
+		getRoomRequest:        make(chan *roomGetter),
+		setRoom:               make(chan *public.Room),
+		mentionChan:           make(chan *result.Result),
+		mentionsRequest:       make(chan *mentionsGetter),
+		attachChan:            make(chan *attachOperation),
+		resumed:               make(chan struct{}, 1),
+		wake:                  make(chan struct{}, 1),
 	}
+	go serverUser.writeResults()
 	go serverUser.synchronizeMessage()
 	go serverUser.receiveError()
 	go serverUser.receiveCommand()
@@ -150,58 +252,62 @@ loop:
 				res = result.New(result.Failure, err.Error())
 			}
 
-			if err := su.encoder.Encode(res); err != nil {
-				su.handleCommunicationError("receive error", err)
-				break loop
-			}
+			su.enqueue(res)
 		}
 	}
 }
 
-// synchronizeMessage controls the concurrent access to the user message queue
-// the user can only either receives a message or set a new broadcaster (that
-// sends the message to user) at one particular moment in real time
+// synchronizeMessage controls the concurrent access to the user states
+// the user can only either set a new broadcaster or read it at one
+// particular moment in real time
 func (su *User) synchronizeMessage() {
 loop:
 	for {
 		select {
 		case <-su.done:
 			break loop
-		case mes := <-su.messageChan:
-			su.handleMessage(mes)
 		case broadcaster := <-su.receiveBroadcaster:
 			su.broadcaster = broadcaster
-		case mes := <-su.broadcastMessageChan:
-			su.broadcaster.Broadcaster() <- mes
+		case getter := <-su.getBroadcasterRequest:
+			getter.Broadcaster = su.broadcaster
+			getter.Done()
 		case remover := <-su.removeUserRequest:
 			su.User = nil
 			remover.Done()
 		case getter := <-su.getUserRequest:
 			getter.User = su.User
 			getter.Done()
+		case getter := <-su.getRoomRequest:
+			getter.room = su.room
+			getter.Done()
+		case pub := <-su.setRoom:
+			su.room = pub
+		case res := <-su.mentionChan:
+			su.mentions = rememberMention(su.mentions, res)
+		case getter := <-su.mentionsRequest:
+			getter.mentions = append([]*result.Result(nil), su.mentions...)
+			getter.Done()
 		case req := <-su.createRequest:
 			// Create a new user from user model
-			var err error
-			if su.User, err = user.New(req.username, color.Randomize(), nil); err != nil {
+			var (
+				usr *user.ConcreteUser
+				err error
+			)
+			if req.guest {
+				usr, err = user.NewGuest(req.username, color.Randomize(), nil)
+			} else {
+				usr, err = user.New(req.username, color.Randomize(), nil)
+			}
+			if err != nil {
 				req.err = err
+			} else {
+				su.User = usr
 			}
 			req.WaitGroup.Done()
 		}
 	}
 }
 
-// handleMessage is a callback that is passed down to the user
-// whenever a Receive is called handleMessage is invoked
-func (su *User) handleMessage(mes message.Message) {
-	res := result.New(result.Message, mes.String())
-	// send the result
-	if err := su.encoder.Encode(res); err != nil {
-		if err != nil {
-			su.handleCommunicationError("sends results to the clients", err)
-		}
-	}
-}
-
 // receiveCommand waits til a command is completely read from a socket
 func (su *User) receiveCommand() {
 loop:
@@ -212,73 +318,215 @@ loop:
 		default:
 			var com = new(command.Command)
 			// Blocking call that handles one command at a time
-			err := su.decoder.Decode(com)
+			err := su.codec.Decode(com)
+			if err == nil && su.kickReason() != "" {
+				err = io.EOF
+			}
+			if err != nil && su.hold() {
+				continue
+			}
 			if err != nil {
-				su.handleCommunicationError("receives command from clients", err)
+				if err != io.EOF && !su.stats.isSlow() && su.kickReason() == "" {
+					log.Printf("receives command from clients: %s", err)
+				}
+				su.signOut()
 				break loop
 			}
 			// handle Command
+			su.touch()
 			su.handleCommand(com)
 		}
 	}
 }
 
-func (su *User) handleCommand(com *command.Command) {
-	var res *result.Result
-	switch com.Ctype {
-	case command.Send:
+// handlers serve the commands the terminal clients send, the arguments
+// are checked against the registry of the command package beforehand
+var handlers = map[int]func(*User, *command.Command) *result.Result{
+	command.Send: func(su *User, com *command.Command) *result.Result {
 		su.Send(com)
+		return nil
+	},
+	command.Private:  (*User).Private,
+	command.End:      (*User).End,
+	command.Who:      (*User).Who,
+	command.Help:     func(_ *User, com *command.Command) *result.Result { return Help(com) },
+	command.Exit:     (*User).Exit,
+	command.Create:   (*User).Create,
+	command.Join:     (*User).Join,
+	command.Leave:    (*User).Leave,
+	command.Rooms:    (*User).Rooms,
+	command.Msg:      (*User).Msg,
+	command.History:  (*User).History,
+	command.Register: (*User).Register,
+	command.Login:    (*User).Login,
+	command.Kick:     (*User).KickUser,
+	command.Ban:      (*User).Ban,
+	command.Unban:    (*User).Unban,
+	command.Mute:     (*User).Mute,
+	command.Unmute:   (*User).Unmute,
+	command.Accept:   (*User).Accept,
+	command.Decline:  (*User).Decline,
+	command.Switch:   (*User).Switch,
+	command.Edit:     (*User).Edit,
+	command.Delete:   (*User).Delete,
+	command.Reply:    (*User).Reply,
+	command.Away:     (*User).Away,
+	command.Busy:     (*User).Busy,
+	command.Back:     (*User).Back,
+	command.Mentions: (*User).Mentions,
+	command.Export:   (*User).Export,
+	command.SlowMode: (*User).SlowMode,
+}
+
+func (su *User) handleCommand(com *command.Command) {
+	if res, refused := su.limit(com); refused {
+		if res != nil {
+			su.enqueue(res)
+		}
+		return
+	}
+	handler, ok := handlers[com.Ctype]
+	if !ok {
+		su.enqueue(result.New(result.Failure, "unknown command"))
+		return
+	} else if err := command.Validate(com); err != nil {
+		su.enqueue(result.New(result.Failure, err.Error()))
+		return
+	}
+	res := handler(su, com)
+	if res == nil {
 		return
-	case command.Private:
-		res = su.Private(com)
-	case command.End:
-		res = su.End(com)
-	case command.Who:
-		res = su.Who(com)
-	case command.Exit:
-		res = su.Exit(com)
-	case command.Create:
-		res = su.Create(com)
 	}
-	if err := su.encoder.Encode(res); err != nil {
-		su.handleCommunicationError("sends results to the client", err)
+	su.enqueue(res)
+	if res.Rtype == result.Exit {
+		// the result is flushed before the connection is closed
+		su.close()
 	}
 }
 
-// signOutEOF removes the user from any room he resides and notifies everybody
+// close stops every subroutines of the user
+func (su *User) close() {
+	su.closeOnce.Do(func() {
+		close(su.done)
+	})
+}
+
+// signOut removes the user from any room he resides and notifies everybody
 // the incident
-func (su *User) signOutEOF() {
+func (su *User) signOut() {
+	defer su.close()
 	if u := su.getUser(); u != nil {
-		su.public.Remove(u.Username())
-		su.public.Broadcaster() <- message.NewConcrete(&color.Reset,
-			fmt.Sprintf("%s disconnected.", u.String()))
+		pub := su.currentRoom()
+		pub.Remove(u.Username())
+		if reason := su.kickReason(); reason != "" {
+			pub.Broadcaster() <- public.Notification(fmt.Sprintf("%s was %s.", u.Username(), reason))
+		} else {
+			pub.Broadcaster() <- message.NewConcrete(&color.Reset,
+				fmt.Sprintf("%s disconnected.", u.String()))
+		}
+		su.rooms.Release(u.Username())
 		// Log the incident
-		log.Printf("user %s@%s closed connection unexpectedly", u.Username(), su.Conn.RemoteAddr().String())
+		if reason := su.kickReason(); reason != "" {
+			log.Printf("user %s@%s was %s", u.Username(), su.Conn.RemoteAddr().String(), reason)
+		} else if su.stats.isSlow() {
+			log.Printf("user %s@%s disconnected: too slow to receive messages", u.Username(), su.Conn.RemoteAddr().String())
+		} else {
+			log.Printf("user %s@%s closed connection unexpectedly", u.Username(), su.Conn.RemoteAddr().String())
+		}
 	} else {
 		log.Printf("connection on %s closed unexpectedly", su.Conn.RemoteAddr().String())
 	}
 }
 
+// handleCommunicationError logs the error and closes the connection, the
+// command handler then holds the seat for the client to resume the
+// session or signs the user out
 func (su *User) handleCommunicationError(logPrefix string, err error) {
-	if err == io.EOF {
-		su.signOutEOF()
-		return
+	if err != io.EOF {
+		log.Printf("%s: %s", logPrefix, err)
 	}
-	log.Printf("%s: %s", logPrefix, err)
+	su.Conn.Close()
 }
 
 // Send corresponds to a send message operation which broadcasts the message
 // to the entire room
 func (su *User) Send(com *command.Command) {
-	if su.getUser() == nil {
-		err := su.encoder.Encode(result.New(result.Failure, "you didn't pick a username. Pick one with @name"))
-		if err != nil {
-			su.handleCommunicationError("send message", err)
-			return
-		}
+	usr := su.getUser()
+	if usr == nil {
+		su.enqueue(result.New(result.Failure, "you didn't pick a username. Pick one with @name"))
 		return
 	}
-	su.broadcastMessageChan <- su.Message(com.Args[0])
+	for _, res := range Say(su.rooms, usr, su.getBroadcaster(), com) {
+		su.enqueue(res)
+	}
+}
+
+// Say broadcasts the message of a @send to the conversation the user
+// talks in, the results tell the user why the message was not sent or
+// which of the mentioned users are not online. The terminal and the
+// browser users both send with it
+func Say(rooms Rooms, usr user.User, to room.Broadcaster, com *command.Command) []*result.Result {
+	if len(com.Args) == 0 || len(com.Args[0]) == 0 {
+		return []*result.Result{result.New(result.Failure, "message not sent: please provide a message")}
+	} else if res := mutedFailure(rooms, usr.Username()); res != nil {
+		return []*result.Result{res}
+	} else if err := rooms.Settings().CheckMessage("message not sent", com.Args[0]); err != nil {
+		return []*result.Result{result.New(result.Failure, err.Error())}
+	}
+	// the message is stamped first so that its mentions can be mailed
+	mes := message.NewStamped(usr.Message(com.Args[0]))
+	to.Broadcaster() <- mes
+	return mentionNotices(rooms, usr.Username(), mes)
+}
+
+func (su *User) getBroadcaster() room.Broadcaster {
+	getter := broadcasterGetter{}
+	getter.Add(1)
+	su.getBroadcasterRequest <- &getter
+	getter.Wait()
+	return getter.Broadcaster
+}
+
+// Msg sends a direct message to one user wherever the user stays, neither
+// of them leaves the current room
+func (su *User) Msg(com *command.Command) *result.Result {
+	usr := su.getUser()
+	if usr == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	whisper, res := Whisper(su.rooms, usr, com)
+	if whisper == nil {
+		return res
+	} else if res != nil {
+		su.enqueue(result.FromMessage(whisper))
+		return res
+	}
+	return result.FromMessage(whisper)
+}
+
+// Whisper sends the direct message of a @msg, the message waits in the
+// mailbox of a registered user who is offline. The whisper is nil unless
+// it was delivered and res then tells the user why, otherwise res is the
+// away notice of the user if any. The terminal and the browser users both
+// whisper with it
+func Whisper(rooms Rooms, usr user.User, com *command.Command) (whisper message.Stamper, res *result.Result) {
+	if len(com.Args[1]) == 0 {
+		return nil, result.New(result.Failure, "message not sent: please provide a username and a message")
+	} else if com.Args[0] == usr.Username() {
+		return nil, result.New(result.Failure, "message not sent: talking to yourself?")
+	} else if err := rooms.Settings().CheckMessage("message not sent", com.Args[1]); err != nil {
+		return nil, result.New(result.Failure, err.Error())
+	}
+	target, ok := rooms.Lookup(com.Args[0])
+	if !ok {
+		return nil, mail(rooms, com.Args[0], message.NewStamped(usr.Whisper(com.Args[0], com.Args[1])))
+	}
+	whisper = message.NewStamped(usr.Whisper(target.Username(), com.Args[1]))
+	target.Receive(whisper)
+	if notice := AwayNotice(target); notice != "" {
+		return whisper, result.New(result.Message, notice)
+	}
+	return whisper, nil
 }
 
 func (su *User) getUser() user.User {
@@ -289,48 +537,58 @@ func (su *User) getUser() user.User {
 	return getter.User
 }
 
-// Private corresponds to the private command
+// Private corresponds to the private command, the users are invited to
+// the private session the user hosts and talks in, or to a new one
 func (su *User) Private(com *command.Command) *result.Result {
 	if su.getUser() == nil {
 		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
 	}
-	if len(com.Args) == 0 {
-		return result.New(result.Failure, "private session not created: you didn't provide any names")
-	} else if len(com.Args) == 1 && com.Args[0] == su.Username() {
+	if len(com.Args) == 1 && com.Args[0] == su.Username() {
 		return result.New(result.Failure, "private session not created: please avoid adding yourself")
 	}
-	_, pris := su.public.WhoIsOnline()
-	for _, pri := range pris {
-		if pri == su {
-			return result.New(result.Failure, "You cannot create a private session if you are in one")
-		}
+	pub := su.currentRoom()
+	id, created, err := pub.HostPrivate(su)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
 	}
-	pri := private.New(su)
-	su.public.PrivateAdder() <- pri
-	su.public.ToPrivate(su, su.Username())
+	invited := []string{}
 	for _, arg := range com.Args {
 		if arg == su.Username() {
 			su.Error() <- errors.New("you don't have to explicitly add yourself to the private session")
 			continue
 		}
-		su.public.ToPrivate(su, arg)
+		if err := pub.Invite(su, id, arg); err != nil {
+			su.Error() <- err
+			continue
+		}
+		invited = append(invited, arg)
+	}
+	res := ""
+	if created {
+		res = fmt.Sprintf("Private session %s created. ", id)
 	}
-	return result.New(result.Success, "Private session created.")
+	if len(invited) > 0 {
+		res += fmt.Sprintf("Invited %s.", strings.Join(invited, ", "))
+	}
+	return result.New(result.Success, res)
 }
 
-// End ends the users' private session with some users
+// End ends the private session the user talks in, or removes some users
+// from it
 func (su *User) End(com *command.Command) *result.Result {
 	if su.getUser() == nil {
 		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
 	}
-	// no argument provided then remove the entire room
+	pub := su.currentRoom()
+	// no argument provided then close or leave the entire session
 	if len(com.Args) == 0 {
-		su.public.PrivateRemove(su)
-	} else if len(com.Args) == 1 && com.Args[0] == su.Username() {
-		su.Error() <- errors.New("user not removed: are you try'ng to remove yallself?")
-	} else {
-		for _, arg := range com.Args {
-			su.public.ToPublic(su, arg)
+		if err := pub.End(su, ""); err != nil {
+			return result.New(result.Failure, err.Error())
+		}
+	}
+	for _, arg := range com.Args {
+		if err := pub.End(su, arg); err != nil {
+			su.Error() <- err
 		}
 	}
 	return result.New(result.Success, "")
@@ -343,60 +601,117 @@ func (su *User) Exit(com *command.Command) *result.Result {
 	if su.getUser() != nil {
 		// remove have to wait until the remove operation is conducted
 		// as this user might want to hear extra messages
-		su.public.Remove(su.Username())
-		su.public.Broadcaster() <- message.NewConcrete(&color.Reset, fmt.Sprintf("%s left.", su.Username()))
+		pub := su.currentRoom()
+		pub.Remove(su.Username())
+		pub.Broadcaster() <- message.NewConcrete(&color.Reset, fmt.Sprintf("%s left.", su.Username()))
+		su.rooms.Release(su.Username())
 	} else {
 		log.Printf("End connection with %s", su.RemoteAddr().String())
 	}
-	close(su.done)
 	return result.New(result.Exit, "Signed out")
 }
 
-// Who prints all private users
+// Who prints all users of the current room
 func (su *User) Who(com *command.Command) *result.Result {
-	pub, pri := su.public.WhoIsOnline()
-	res := fmt.Sprintf("\n%sPublic:\n", color.Reset.String())
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	room := su.currentRoom()
+	pub, _ := room.WhoIsOnline()
+	res := fmt.Sprintf("\n%sPublic #%s:\n", color.Reset.String(), room.Name())
 	if len(pub) == 0 {
 		res += "\t...well...it's kinda empty now\n"
 	} else {
 		for _, user := range pub {
-			res += fmt.Sprintf("\t%s\n", user.String())
+			res += fmt.Sprintf("\t%s%s\n", user.String(), presenceOf(user))
 		}
 	}
 	res += fmt.Sprint("Private:\n")
-	if len(pri) == 0 {
+	if sessions, active := room.Sessions(su.Username()); len(sessions) == 0 {
 		res += "\t...no one is talking behind your back.\n"
 	} else {
-		for _, user := range pri {
-			res += fmt.Sprintf("\t%s\n", user.String())
+		for _, session := range sessions {
+			res += fmt.Sprintf("\t%s\n", describeSession(session, active))
+		}
+	}
+	if invites := room.Invites(su.Username()); len(invites) > 0 {
+		res += "Invites:\n"
+		for _, inv := range invites {
+			res += fmt.Sprintf("\t%s\n", describeInvite(inv, su.Username()))
 		}
 	}
 
 	return result.New(result.Success, res)
 }
 
-// Create creates an user
+// Help explains a command, or lists them all without arguments
+func Help(com *command.Command) *result.Result {
+	var name string
+	if len(com.Args) > 0 {
+		name = com.Args[0]
+	}
+	help, err := command.Explain(name)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return result.New(result.Success, help)
+}
+
+// Create creates a guest user
 func (su *User) Create(com *command.Command) *result.Result {
 	if su.getUser() != nil {
 		return result.New(result.Failure, "You already had a name")
 	}
-	if len(com.Args) == 0 || len(com.Args) > 1 {
-		su.errChan <- errors.New("create a name: username is not provided or more than enough")
+	// The client certificate names the user
+	if su.certName != "" {
+		if len(com.Args) == 1 && com.Args[0] != su.certName {
+			return result.New(result.Failure,
+				fmt.Sprintf("create a name: your certificate names you %s", su.certName))
+		}
+		com.Args = []string{su.certName}
+	}
+	if len(com.Args) == 0 {
+		su.errChan <- errors.New("create a name: username is not provided")
 		return result.New(result.Success, "")
-	} else if len(com.Args[0]) > 100 {
-		su.errChan <- errors.New("create a name: username is too long ")
+	} else if err := su.rooms.Settings().CheckUsername("create a name", com.Args[0]); err != nil {
+		su.errChan <- err
 		return result.New(result.Success, "")
 	}
+	username := com.Args[0]
+	// Reserve the username server-wide
+	lobby, err := su.rooms.Claim(username, su)
+	if err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	return su.enter(username, lobby, true)
+}
+
+// enter creates the user model of the claimed username and adds the user
+// to the lobby
+func (su *User) enter(username string, lobby *public.Room, guest bool) *result.Result {
 	uc := userCreator{
-		username: com.Args[0],
+		username: username,
+		guest:    guest,
 	}
 	uc.Add(1)
 	su.createRequest <- &uc
 	uc.Wait()
 	if uc.err != nil {
+		su.rooms.Release(username)
 		return result.New(result.Failure, uc.err.Error())
 	}
-	// Add the user to the public room
-	su.public.Adder() <- su
+	if !guest {
+		su.role = su.rooms.Role(username)
+	}
+	// Add the user to the lobby
+	su.historyCursor = 0
+	su.setRoom <- lobby
+	lobby.Adder() <- su
+	token := result.New(result.Token, su.rooms.ResumeToken(username))
+	token.Author = username
+	su.enqueue(token)
+	if motd := su.rooms.Settings().MOTD; motd != "" {
+		su.enqueue(result.New(result.Message, motd))
+	}
 	return result.New(result.Success, "Name registering...")
 }
@@ -0,0 +1,41 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+)
+
+// describeSession prints a private session and its members, the session
+// the user talks in is marked
+func describeSession(session public.Session, active string) string {
+	res := fmt.Sprintf("%s hosted by %s: %s", session.ID, session.Host,
+		strings.Join(session.Members, ", "))
+	if session.ID == active {
+		res += " (you talk here)"
+	}
+	return res
+}
+
+// Switch changes the conversation the user talks in, no argument or the
+// name of the room makes the user talk in the room again
+func (su *User) Switch(com *command.Command) *result.Result {
+	if su.getUser() == nil {
+		return result.New(result.Failure, "you didn't pick a username. Pick one with @name")
+	}
+	id := ""
+	if len(com.Args) == 1 {
+		id = strings.TrimPrefix(com.Args[0], "#")
+	}
+	pub := su.currentRoom()
+	if err := pub.Switch(su, id); err != nil {
+		return result.New(result.Failure, err.Error())
+	}
+	if id == "" || id == pub.Name() {
+		return result.New(result.Success, fmt.Sprintf("You are talking in #%s", pub.Name()))
+	}
+	return result.New(result.Success, fmt.Sprintf("You are talking in private session %s", id))
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultMaxUsername is the longest username in bytes by default
+	DefaultMaxUsername = 100
+	// DefaultMaxMessage is the longest chat message in bytes by default
+	DefaultMaxMessage = 4096
+)
+
+// Settings are the limits the users are held to and what they are told
+// once they picked a name. They can change while the server runs
+type Settings struct {
+	// MaxUsername and MaxMessage are the longest username and chat
+	// message in bytes, zero is no limit
+	MaxUsername int
+	MaxMessage  int
+	// MOTD is the message of the day, it is sent to every user after
+	// picking a name unless empty
+	MOTD string
+	// IdleAfter is how long the users wait without sending a command
+	// before they are away, zero never makes them away
+	IdleAfter time.Duration
+	// ResumeGrace is how long the seat of a disconnected user is held
+	// for the client to resume the session, zero signs the user out
+	// right away
+	ResumeGrace time.Duration
+	Flood       Flood
+}
+
+// Flood limits how fast the users send messages and commands. A zero rate
+// is no limit
+type Flood struct {
+	// MessageRate is the number of chat messages a user sends per second
+	// on average, MessageBurst the number the user sends at once
+	MessageRate  float64
+	MessageBurst int
+	// CommandRate and CommandBurst limit every command alike
+	CommandRate  float64
+	CommandBurst int
+	// Strikes is the number of refused commands within a minute that
+	// punishes the user, zero never punishes
+	Strikes int
+	// Disconnect signs the punished users out, they are muted for
+	// MuteFor otherwise
+	Disconnect bool
+	MuteFor    time.Duration
+}
+
+// DefaultSettings returns the settings of a server that was not
+// configured, the sessions are not resumed and the users are not rate
+// limited
+func DefaultSettings() Settings {
+	return Settings{
+		MaxUsername: DefaultMaxUsername,
+		MaxMessage:  DefaultMaxMessage,
+		IdleAfter:   DefaultIdleAfter,
+	}
+}
+
+// CheckUsername checks the length of a username, action prefixes the
+// error
+func (s Settings) CheckUsername(action, username string) error {
+	if s.MaxUsername > 0 && len(username) > s.MaxUsername {
+		return fmt.Errorf("%s: username is longer than %d characters", action, s.MaxUsername)
+	}
+	return nil
+}
+
+// CheckMessage checks the length of a chat message, action prefixes the
+// error
+func (s Settings) CheckMessage(action, text string) error {
+	if s.MaxMessage > 0 && len(text) > s.MaxMessage {
+		return fmt.Errorf("%s: the message is longer than %d characters", action, s.MaxMessage)
+	}
+	return nil
+}
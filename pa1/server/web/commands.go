@@ -0,0 +1,204 @@
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/model/user"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+var errNoName = resultEvent(result.New(result.Failure, "you didn't pick a username"))
+
+func failure(format string, args ...interface{}) *Event {
+	return resultEvent(result.New(result.Failure, fmt.Sprintf(format, args...)))
+}
+
+func (wu *User) create(com *command.Command) *Event {
+	if wu.getUser() != nil {
+		return failure("You already had a name")
+	}
+	if len(com.Args) == 0 || len(com.Args[0]) == 0 {
+		return failure("create a name: username is not provided")
+	}
+	if err := wu.rooms.Settings().CheckUsername("create a name", com.Args[0]); err != nil {
+		return failure("%s", err)
+	}
+	usr, err := user.NewGuest(com.Args[0], color.Randomize(), nil)
+	if err != nil {
+		return failure("create a name: %s", err)
+	}
+	lobby, err := wu.rooms.Claim(com.Args[0], wu)
+	if err != nil {
+		return failure("%s", err)
+	}
+	return wu.enter(usr, lobby)
+}
+
+// signIn registers or logs in to an account depending on the claim, the
+// messages that waited in the mailbox are delivered afterwards
+func (wu *User) signIn(action string, com *command.Command,
+	claim func(username, password string, usr room.User) (*public.Room, error)) *Event {
+	if wu.getUser() != nil {
+		return failure("You already had a name")
+	}
+	if len(com.Args[0]) == 0 {
+		return failure("%s: please provide a username and a password", action)
+	}
+	if err := wu.rooms.Settings().CheckUsername(action, com.Args[0]); err != nil {
+		return failure("%s", err)
+	}
+	usr, err := user.New(com.Args[0], color.Randomize(), nil)
+	if err != nil {
+		return failure("%s: %s", action, err)
+	}
+	lobby, err := claim(com.Args[0], com.Args[1], wu)
+	if err != nil {
+		return failure("%s", err)
+	}
+	wu.role = wu.rooms.Role(usr.Username())
+	ev := wu.enter(usr, lobby)
+	letters := wu.rooms.Collect(usr.Username())
+	if len(letters) == 0 {
+		return ev
+	}
+	wu.send(ev)
+	return resultEvent(seruser.DeliverMail(letters, func(delivered *result.Result) {
+		wu.send(mailEvent(delivered))
+	}))
+}
+
+// enter keeps the user model of the claimed username and adds the user
+// to the lobby
+func (wu *User) enter(usr user.User, lobby *public.Room) *Event {
+	wu.profile.Store(usr)
+	wu.setRoom(lobby)
+	lobby.Adder() <- wu
+	if motd := wu.rooms.Settings().MOTD; motd != "" {
+		wu.send(&Event{Type: "notice", Text: motd})
+	}
+	return &Event{Type: "created", From: usr.Username(), Room: lobby.Name()}
+}
+
+// sendMessage sends the message through the handler of the terminal
+// users, the browser is told about the failures and the mentions
+func (wu *User) sendMessage(com *command.Command) *Event {
+	usr := wu.getUser()
+	if usr == nil {
+		return errNoName
+	}
+	for _, res := range seruser.Say(wu.rooms, usr, wu.getState().broadcaster, com) {
+		wu.send(resultEvent(res))
+	}
+	return nil
+}
+
+func (wu *User) join(com *command.Command) *Event {
+	if wu.getUser() == nil {
+		return errNoName
+	}
+	return wu.moved(seruser.JoinRoom(wu.rooms, wu, wu.getState().room, com, wu.setRoom))
+}
+
+func (wu *User) leave(com *command.Command) *Event {
+	if wu.getUser() == nil {
+		return errNoName
+	}
+	return wu.moved(seruser.LeaveRoom(wu.rooms, wu, wu.getState().room, com, wu.setRoom))
+}
+
+// moved turns the result of a move into a joined event
+func (wu *User) moved(res *result.Result) *Event {
+	if res.Rtype != result.Success {
+		return resultEvent(res)
+	}
+	return &Event{Type: "joined", Room: wu.getState().room.Name()}
+}
+
+// export sends the history of the room as a file the page downloads
+func (wu *User) export(com *command.Command) *Event {
+	if wu.getUser() == nil {
+		return errNoName
+	}
+	return resultEvent(seruser.ExportRoom(wu.getState().room, com.Args))
+}
+
+func (wu *User) listRooms() *Event {
+	return &Event{
+		Type:  "rooms",
+		Room:  wu.getState().room.Name(),
+		Rooms: wu.rooms.Rooms(),
+	}
+}
+
+func (wu *User) who() *Event {
+	pub := wu.getState().room
+	public, private := pub.WhoIsOnline()
+	ev := &Event{Type: "who", Room: pub.Name(), Users: []string{}, Private: []string{}}
+	for _, usr := range public {
+		ev.Users = append(ev.Users, usr.Username())
+		if status := seruser.StatusOf(usr); status.Presence != seruser.Online {
+			if ev.Presence == nil {
+				ev.Presence = make(map[string]string)
+			}
+			ev.Presence[usr.Username()] = status.String()
+		}
+	}
+	for _, usr := range private {
+		ev.Private = append(ev.Private, usr.Username())
+	}
+	return ev
+}
+
+func (wu *User) msg(com *command.Command) *Event {
+	usr := wu.getUser()
+	if usr == nil {
+		return errNoName
+	}
+	whisper, res := seruser.Whisper(wu.rooms, usr, com)
+	if whisper == nil {
+		return resultEvent(res)
+	} else if res != nil {
+		wu.send(messageEvent(whisper))
+		return resultEvent(res)
+	}
+	return messageEvent(whisper)
+}
+
+// limit checks the command against the flood limits, it reports whether
+// the command was refused. A flooder is muted, or disconnected if the
+// server is configured so or the flooder keeps on while muted
+func (wu *User) limit(com *command.Command) bool {
+	if com.Ctype == command.Exit {
+		return false
+	}
+	flood := wu.rooms.Settings().Flood
+	usr := wu.getUser()
+	var slowMode time.Duration
+	if com.Ctype == command.Send && usr != nil && wu.role < seruser.Moderator {
+		slowMode = wu.getState().room.SlowModeOf(usr.Username(), 0)
+	}
+	punish, err := wu.limiter.Allow(flood, seruser.IsMessage(com.Ctype), slowMode, time.Now())
+	if err == nil {
+		return false
+	} else if !punish {
+		wu.send(failure("%s", err))
+		return true
+	}
+	if usr != nil && !flood.Disconnect {
+		if _, muted := wu.rooms.Muted(usr.Username()); !muted {
+			wu.rooms.Mute(usr.Username(), flood.MuteFor)
+			wu.getState().room.Broadcaster() <- public.Notification(
+				fmt.Sprintf("%s was muted %s for flooding.", usr.Username(), seruser.ForWhile(flood.MuteFor)))
+			wu.send(failure("You were muted %s for flooding.", seruser.ForWhile(flood.MuteFor)))
+			return true
+		}
+	}
+	wu.Kick("disconnected for flooding")
+	return true
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/private"
+	"github.com/iocat/rutgers-cs352/pa1/model/user"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+)
+
+// Event is the JSON value sent to the browser. Type is one of
+// message, whisper, notice, edited, deleted, created, joined, rooms, who,
+// file, token, success, failure and exit. Name is the file name of a file
+// event. ID and Time are the stamp of a message, Conversation is the ID
+// of the private session a message belongs to, ReplyTo and Quote name the
+// message a reply answers. Presence maps the users of
+// a who event that are not online to their status, Mentioned is set on
+// the messages that mention the browser user
+type Event struct {
+	Type         string             `json:"type"`
+	ID           uint64             `json:"id,omitempty"`
+	Time         *time.Time         `json:"time,omitempty"`
+	Conversation string             `json:"conversation,omitempty"`
+	Room         string             `json:"room,omitempty"`
+	From         string             `json:"from,omitempty"`
+	To           string             `json:"to,omitempty"`
+	Text         string             `json:"text,omitempty"`
+	ReplyTo      uint64             `json:"replyTo,omitempty"`
+	Quote        string             `json:"quote,omitempty"`
+	Color        *Color             `json:"color,omitempty"`
+	Users        []string           `json:"users,omitempty"`
+	Private      []string           `json:"private,omitempty"`
+	Presence     map[string]string  `json:"presence,omitempty"`
+	Mentioned    bool               `json:"mentioned,omitempty"`
+	Rooms        []seruser.RoomInfo `json:"rooms,omitempty"`
+	Name         string             `json:"name,omitempty"`
+}
+
+// Color is the color of the author, in ANSI codes
+type Color struct {
+	Display int `json:"display"`
+	Fg      int `json:"fg"`
+	Bg      int `json:"bg"`
+}
+
+func newColor(col *color.Color) *Color {
+	return &Color{Display: col.Display(), Fg: col.Fg(), Bg: col.Bg()}
+}
+
+// messageEvent turns a room message into an event, messages that are not
+// written by a user are notices
+func messageEvent(mes message.Message) *Event {
+	switch m := mes.(type) {
+	case *message.Update:
+		if m.Deleted {
+			return stamped(&Event{Type: "deleted"}, m)
+		}
+		return stamped(&Event{Type: "edited", Text: color.Strip(m.String())}, m)
+	case *private.Message:
+		ev := messageEvent(m.Stamper)
+		ev.Conversation = m.Conversation
+		return ev
+	case *message.Stamped:
+		return stamped(messageEvent(m.Message), m)
+	case *user.Whisper:
+		return &Event{
+			Type:  "whisper",
+			From:  m.Username(),
+			To:    m.To(),
+			Text:  m.Text(),
+			Color: newColor(&m.Color),
+		}
+	case *user.Reply:
+		return &Event{
+			Type:    "message",
+			From:    m.Username(),
+			Text:    m.Text(),
+			Color:   newColor(&m.Color),
+			ReplyTo: m.ReplyTo(),
+			Quote:   color.Strip(m.Quote()),
+		}
+	case *user.Message:
+		return &Event{
+			Type:  "message",
+			From:  m.Username(),
+			Text:  m.Text(),
+			Color: newColor(&m.Color),
+		}
+	}
+	ev := &Event{Type: "notice", Text: color.Strip(mes.String())}
+	if stamper, ok := mes.(message.Stamper); ok {
+		// the messages replayed from the history
+		stamped(ev, stamper)
+	}
+	return ev
+}
+
+// stamped adds the stamp of the message to the event
+func stamped(ev *Event, mes message.Stamper) *Event {
+	stamp := mes.Stamp()
+	ev.ID, ev.Time = stamp.ID, &stamp.Time
+	return ev
+}
+
+var resultTypes = map[int]string{
+	result.Success: "success",
+	result.Message: "notice",
+	result.Failure: "failure",
+	result.Exit:    "exit",
+	result.Created: "created",
+	result.Token:   "token",
+	result.File:    "file",
+}
+
+func resultEvent(res *result.Result) *Event {
+	return &Event{Type: resultTypes[res.Rtype], Text: color.Strip(res.Message), Name: res.Name}
+}
+
+// mailEvent turns a message that waited in the mailbox into a notice that
+// keeps the stamp of the message
+func mailEvent(res *result.Result) *Event {
+	ev := resultEvent(res)
+	if res.ID != 0 {
+		ev.ID, ev.Time, ev.From, ev.Mentioned = res.ID, &res.Time, res.Author, res.Mentioned
+		ev.ReplyTo = res.ReplyTo
+	}
+	return ev
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"io"
+	"net/http"
+)
+
+// page is the minimal chat page served to the browsers
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat</title>
+<style>
+body { font-family: monospace; background: #111; color: #ddd; margin: 0; }
+#log { height: calc(100vh - 3em); overflow-y: auto; padding: 0.5em; }
+#log div { white-space: pre-wrap; }
+.notice { color: #6c6; }
+.failure { color: #e66; }
+.whisper { color: #c6c; font-style: italic; }
+.mention { background: #442; font-weight: bold; }
+form { display: flex; height: 3em; }
+input { flex: 1; background: #222; color: #ddd; border: none; padding: 0 0.5em; }
+</style>
+</head>
+<body>
+<div id="log"></div>
+<form id="form"><input id="input" autocomplete="off" placeholder="@name yourname"></form>
+<script>
+var colors = {30: "#888", 31: "#e66", 32: "#6c6", 33: "#cc6", 34: "#69f", 35: "#c6c", 36: "#6cc", 37: "#eee"};
+var log = document.getElementById("log");
+var input = document.getElementById("input");
+var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+ws.onclose = function () { print("notice", "Connection closed"); };
+ws.onmessage = function (e) {
+	var ev = JSON.parse(e.data);
+	switch (ev.type) {
+	case "message":
+		print(ev.mentioned ? "mention" : "", tag(ev) + ev.from + ": " + ev.text, ev.color);
+		break;
+	case "whisper":
+		print("whisper", "(whisper to " + ev.to + ") " + ev.from + ": " + ev.text, ev.color);
+		break;
+	case "who":
+		var presence = ev.presence || {};
+		print("notice", "#" + ev.room + ": " + (ev.users || []).map(function (u) {
+			return presence[u] ? u + " (" + presence[u] + ")" : u;
+		}).join(", ") +
+			(ev.private ? " | private: " + ev.private.join(", ") : ""));
+		break;
+	case "edited":
+		print("notice", "edited #" + ev.id + ": " + ev.text);
+		break;
+	case "deleted":
+		print("notice", "message #" + ev.id + " deleted");
+		break;
+	case "rooms":
+		print("notice", (ev.rooms || []).map(function (r) { return "#" + r.Name + " (" + r.Users + ")"; }).join(" "));
+		break;
+	case "created":
+		print("notice", "You are " + ev.from + " in #" + ev.room);
+		break;
+	case "joined":
+		print("notice", "You are now in #" + ev.room);
+		break;
+	case "file":
+		var link = document.createElement("a");
+		link.href = URL.createObjectURL(new Blob([ev.text], {type: ev.name.slice(-5) === ".html" ? "text/html" : "text/plain"}));
+		link.download = ev.name;
+		link.click();
+		setTimeout(function () { URL.revokeObjectURL(link.href); }, 0);
+		print("notice", "Saved " + ev.name);
+		break;
+	default:
+		if (ev.text) { print(ev.mentioned ? "mention" : ev.type, tag(ev) + ev.text); }
+	}
+};
+function tag(ev) {
+	return (ev.conversation ? "[" + ev.conversation + "] " : "") +
+		(ev.replyTo ? "(re #" + ev.replyTo + (ev.quote ? " " + ev.quote : "") + ") " : "");
+}
+function print(cls, text, color) {
+	var line = document.createElement("div");
+	line.className = cls;
+	line.textContent = text;
+	if (color && colors[color.fg]) { line.style.color = colors[color.fg]; }
+	log.appendChild(line);
+	log.scrollTop = log.scrollHeight;
+}
+document.getElementById("form").onsubmit = function (e) {
+	e.preventDefault();
+	var text = input.value.trim();
+	input.value = "";
+	if (!text) { return; }
+	// the server parses the line with command.Parse
+	ws.send(JSON.stringify({Line: text}));
+};
+</script>
+</body>
+</html>
+`
+
+func servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, page)
+}
@@ -0,0 +1,399 @@
+// Package web lets browsers join the chat rooms. Every WebSocket
+// connection is adapted into a room user: the browser sends the same JSON
+// commands as the terminal clients (see doc/protocol.md) and receives
+// structured JSON events instead of ANSI colored strings
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	"github.com/iocat/rutgers-cs352/pa1/model/color"
+	"github.com/iocat/rutgers-cs352/pa1/model/message"
+	room "github.com/iocat/rutgers-cs352/pa1/model/room/interf"
+	"github.com/iocat/rutgers-cs352/pa1/model/room/public"
+	"github.com/iocat/rutgers-cs352/pa1/model/user"
+	"github.com/iocat/rutgers-cs352/pa1/result"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+	"github.com/iocat/rutgers-cs352/pa1/websocket"
+)
+
+// writeTimeout is how long a single event may take to be written, a
+// browser that stops reading is disconnected afterwards
+const writeTimeout = 30 * time.Second
+
+// Handler serves the chat page on / and the WebSocket endpoint on /ws,
+// connected is called with every new browser user unless nil
+func Handler(rooms seruser.Rooms, connected func(*User)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", servePage)
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && rooms.Banned(host) {
+			log.Printf("%s: refused, the address is banned", r.RemoteAddr)
+			http.Error(w, "banned", http.StatusForbidden)
+			return
+		}
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			log.Printf("%s: %s", r.RemoteAddr, err)
+			return
+		}
+		log.Printf("Accepted WebSocket connection from %s\n", r.RemoteAddr)
+		wu := New(rooms, conn)
+		if connected != nil {
+			connected(wu)
+		}
+	})
+	return mux
+}
+
+// User is a browser user. User implements the room.User interface
+type User struct {
+	conn  *websocket.Conn
+	rooms seruser.Rooms
+
+	// outbox queues the events sent to the browser
+	outbox  chan []byte
+	errChan chan error
+
+	// profile holds the user model once the browser picked a username,
+	// it never changes afterwards
+	profile atomic.Value
+	// kicked holds the reason the user was kicked for
+	kicked atomic.Value
+	// limiter keeps the browser from flooding and role is set when the
+	// user signs in to an account, they are only accessed by
+	// receiveCommands
+	limiter seruser.Limiter
+	role    seruser.Role
+	// state is only accessed by synchronize
+	state        userState
+	stateRequest chan *stateGetter
+	update       chan func(*userState)
+
+	done      chan struct{}
+	closeOnce sync.Once
+	// closed is closed by writeEvents once the connection is closed
+	closed chan struct{}
+}
+
+type userState struct {
+	room        *public.Room
+	broadcaster room.Broadcaster
+}
+
+type stateGetter struct {
+	sync.WaitGroup
+	userState
+}
+
+// New creates a browser user and spawns the subroutines that serve the
+// connection
+func New(rooms seruser.Rooms, conn *websocket.Conn) *User {
+	wu := &User{
+		conn:         conn,
+		rooms:        rooms,
+		outbox:       make(chan []byte, seruser.DefaultQueueSize),
+		errChan:      make(chan error),
+		state:        userState{room: rooms.Lobby(), broadcaster: rooms.Lobby()},
+		stateRequest: make(chan *stateGetter),
+		update:       make(chan func(*userState)),
+		done:         make(chan struct{}),
+		closed:       make(chan struct{}),
+	}
+	go wu.synchronize()
+	go wu.writeEvents()
+	go wu.receiveError()
+	go wu.receiveCommands()
+	return wu
+}
+
+// synchronize controls the concurrent access to the user states
+func (wu *User) synchronize() {
+	for {
+		select {
+		case <-wu.done:
+			return
+		case getter := <-wu.stateRequest:
+			getter.userState = wu.state
+			getter.Done()
+		case update := <-wu.update:
+			update(&wu.state)
+		}
+	}
+}
+
+func (wu *User) getState() userState {
+	getter := stateGetter{}
+	getter.Add(1)
+	select {
+	case wu.stateRequest <- &getter:
+	case <-wu.done:
+		return userState{}
+	}
+	getter.Wait()
+	return getter.userState
+}
+
+// getUser returns the user model, nil if no username was picked
+func (wu *User) getUser() user.User {
+	if usr, ok := wu.profile.Load().(user.User); ok {
+		return usr
+	}
+	return nil
+}
+
+// Error implements the room.User interface
+func (wu *User) Error() chan<- error {
+	return wu.errChan
+}
+
+// Receive implements the room.User interface, the message is queued as a
+// JSON event without blocking the room
+func (wu *User) Receive(mes message.Message) {
+	ev := messageEvent(mes)
+	if stamper, ok := mes.(message.Stamper); ok && ev.Type == "message" {
+		ev.Mentioned = stamper.Stamp().Mentioned(wu.Username())
+	}
+	wu.send(ev)
+}
+
+// Username implements the room.User interface
+func (wu *User) Username() string {
+	if usr := wu.getUser(); usr != nil {
+		return usr.Username()
+	}
+	return ""
+}
+
+// String implements the room.User interface
+func (wu *User) String() string {
+	if usr := wu.getUser(); usr != nil {
+		return usr.String()
+	}
+	return ""
+}
+
+// RemoteAddr returns the address of the browser
+func (wu *User) RemoteAddr() net.Addr {
+	return wu.conn.RemoteAddr()
+}
+
+// Kick implements the server/user.Kickable interface, the pending read
+// is interrupted so that the user is signed out by receiveCommands
+func (wu *User) Kick(reason string) {
+	wu.kicked.Store(reason)
+	wu.send(resultEvent(result.New(result.Exit, fmt.Sprintf("You were %s", reason))))
+	wu.conn.SetReadDeadline(time.Now())
+}
+
+// Closed implements the server/user.Drainable interface
+func (wu *User) Closed() <-chan struct{} {
+	return wu.closed
+}
+
+// ForceClose implements the server/user.Drainable interface, the
+// connection is closed under the WebSocket so no close frame is written
+func (wu *User) ForceClose() {
+	wu.conn.Conn.Close()
+}
+
+// SetBroadcaster implements the room.User interface
+func (wu *User) SetBroadcaster(broadcaster room.Broadcaster) {
+	wu.setState(func(state *userState) {
+		state.broadcaster = broadcaster
+	})
+}
+
+func (wu *User) setRoom(pub *public.Room) {
+	wu.setState(func(state *userState) {
+		state.room = pub
+	})
+}
+
+func (wu *User) setState(update func(*userState)) {
+	select {
+	case wu.update <- update:
+	case <-wu.done:
+	}
+}
+
+// send queues an event, the oldest event is dropped if the queue is full
+func (wu *User) send(ev *Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("encode event: %s", err)
+		return
+	}
+	for {
+		select {
+		case wu.outbox <- data:
+			return
+		default:
+		}
+		select {
+		case <-wu.outbox:
+		default:
+		}
+	}
+}
+
+func (wu *User) close() {
+	wu.closeOnce.Do(func() {
+		close(wu.done)
+	})
+}
+
+// writeEvents is the only subroutine that writes to the connection, the
+// queued events are flushed before the connection is closed
+func (wu *User) writeEvents() {
+	defer close(wu.closed)
+	defer func() {
+		wu.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		wu.conn.Close()
+	}()
+	for {
+		select {
+		case <-wu.done:
+			for {
+				select {
+				case data := <-wu.outbox:
+					if wu.write(data) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case data := <-wu.outbox:
+			if err := wu.write(data); err != nil {
+				log.Printf("sends events to the browser: %s", err)
+				wu.conn.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// write sends an event to the browser within writeTimeout
+func (wu *User) write(data []byte) error {
+	wu.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return wu.conn.WriteMessage(data)
+}
+
+func (wu *User) receiveError() {
+	for {
+		select {
+		case <-wu.done:
+			return
+		case err := <-wu.errChan:
+			wu.send(resultEvent(result.New(result.Failure, err.Error())))
+		}
+	}
+}
+
+// browserCommand is a command the browser sends, or the line the user
+// typed for the server to parse
+type browserCommand struct {
+	command.Command
+	Line string
+}
+
+// receiveCommands reads the JSON commands until the connection is closed
+func (wu *User) receiveCommands() {
+	for {
+		select {
+		case <-wu.done:
+			return
+		default:
+		}
+		data, err := wu.conn.ReadMessage()
+		if reason, ok := wu.kicked.Load().(string); ok {
+			wu.signOut(fmt.Sprintf("was %s", reason))
+			return
+		} else if err != nil {
+			if err != io.EOF {
+				log.Printf("receives command from browser: %s", err)
+			}
+			wu.signOut("disconnected")
+			return
+		}
+		var received browserCommand
+		if err := json.Unmarshal(data, &received); err != nil {
+			wu.send(resultEvent(result.New(result.Failure, fmt.Sprintf("bad command: %s", err))))
+			continue
+		}
+		com := &received.Command
+		if received.Line != "" {
+			if com, err = command.Parse(received.Line); err != nil {
+				wu.send(resultEvent(result.New(result.Failure, err.Error())))
+				continue
+			}
+		}
+		wu.handleCommand(com)
+	}
+}
+
+// handlers serve the commands the browsers send, the arguments are
+// checked against the registry of the command package beforehand
+var handlers = map[int]func(*User, *command.Command) *Event{
+	command.Create: (*User).create,
+	command.Register: func(wu *User, com *command.Command) *Event {
+		return wu.signIn("register", com, wu.rooms.Register)
+	},
+	command.Login: func(wu *User, com *command.Command) *Event {
+		return wu.signIn("login", com, wu.rooms.Login)
+	},
+	command.Send:  (*User).sendMessage,
+	command.Join:  (*User).join,
+	command.Leave: (*User).leave,
+	command.Rooms: func(wu *User, _ *command.Command) *Event { return wu.listRooms() },
+	command.Who:   func(wu *User, _ *command.Command) *Event { return wu.who() },
+	command.Help: func(_ *User, com *command.Command) *Event {
+		return resultEvent(seruser.Help(com))
+	},
+	command.Export: (*User).export,
+	command.Msg:    (*User).msg,
+	command.Exit: func(wu *User, _ *command.Command) *Event {
+		wu.signOut("left")
+		return nil
+	},
+}
+
+func (wu *User) handleCommand(com *command.Command) {
+	if wu.limit(com) {
+		return
+	}
+	var ev *Event
+	if handler, ok := handlers[com.Ctype]; !ok {
+		ev = resultEvent(result.New(result.Failure, "command not supported from the browser"))
+	} else if err := command.Validate(com); err != nil {
+		ev = resultEvent(result.New(result.Failure, err.Error()))
+	} else {
+		ev = handler(wu, com)
+	}
+	if ev != nil {
+		wu.send(ev)
+	}
+}
+
+// signOut removes the user from the room and closes the connection
+func (wu *User) signOut(reason string) {
+	defer wu.close()
+	if usr := wu.getUser(); usr != nil {
+		pub := wu.getState().room
+		pub.Remove(usr.Username())
+		pub.Broadcaster() <- message.NewConcrete(&color.Reset,
+			fmt.Sprintf("%s %s.", usr.String(), reason))
+		wu.rooms.Release(usr.Username())
+	}
+	wu.send(resultEvent(result.New(result.Exit, "Signed out")))
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iocat/rutgers-cs352/pa1/command"
+	seruser "github.com/iocat/rutgers-cs352/pa1/server/user"
+	"github.com/iocat/rutgers-cs352/pa1/server/web"
+	"github.com/iocat/rutgers-cs352/pa1/websocket"
+)
+
+// browser is a WebSocket client of the chat server
+type browser struct {
+	*websocket.Conn
+	events chan *web.Event
+}
+
+func openBrowser(t *testing.T, url string) *browser {
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(url, "http") + "/ws")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	b := &browser{Conn: conn, events: make(chan *web.Event, 1024)}
+	go func() {
+		defer close(b.events)
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var ev web.Event
+			if err := json.Unmarshal(data, &ev); err != nil {
+				t.Errorf("decode event %q: %s", data, err)
+				return
+			}
+			b.events <- &ev
+		}
+	}()
+	return b
+}
+
+func (b *browser) send(t *testing.T, ctype int, args ...string) {
+	data, _ := json.Marshal(command.New(ctype, args))
+	if err := b.WriteMessage(data); err != nil {
+		t.Fatalf("send command: %s", err)
+	}
+}
+
+// sendLine sends a line the user typed on the page
+func (b *browser) sendLine(t *testing.T, line string) {
+	data, _ := json.Marshal(map[string]string{"Line": line})
+	if err := b.WriteMessage(data); err != nil {
+		t.Fatalf("send line: %s", err)
+	}
+}
+
+// waitForEvent reads the events until one matches
+func (b *browser) waitForEvent(t *testing.T, match func(*web.Event) bool) *web.Event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-b.events:
+			if !ok {
+				t.Fatal("connection closed while waiting for an event")
+			}
+			if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out while waiting for an event")
+		}
+	}
+}
+
+// TestBrowserJoinsRoom tests whether a browser and a terminal user chat
+// in the same room and whether the browser receives structured messages
+func TestBrowserJoinsRoom(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	b := openBrowser(t, srv.URL)
+	defer b.Close()
+	b.send(t, command.Create, "webby")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "created" && ev.Room == lobbyName
+	})
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+
+	alice.send(t, command.Send, "hello browser")
+	ev := b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "message"
+	})
+	if ev.From != "alice" || ev.Text != "hello browser" || ev.Color == nil {
+		t.Fatalf("message: received %+v", ev)
+	}
+	if strings.Contains(ev.Text, "\x1b") {
+		t.Fatalf("message: the text should not hold escape codes, received %q", ev.Text)
+	}
+
+	b.send(t, command.Send, "hello terminal")
+	waitFor(t, aliceResults, "hello terminal")
+
+	alice.send(t, command.Msg, "webby", "psst")
+	ev = b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "whisper"
+	})
+	if ev.From != "alice" || ev.To != "webby" || ev.Text != "psst" {
+		t.Fatalf("whisper: received %+v", ev)
+	}
+
+	b.send(t, command.Who)
+	ev = b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "who"
+	})
+	if len(ev.Users) != 2 {
+		t.Fatalf("who: expected 2 users, received %v", ev.Users)
+	}
+
+	b.send(t, command.Export)
+	ev = b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "file"
+	})
+	if ev.Name == "" || !strings.Contains(ev.Text, "hello terminal") {
+		t.Fatalf("export: received %+v", ev)
+	}
+}
+
+// TestBrowserSharesHandlers tests whether the browser moves between rooms,
+// whispers and mentions the way the terminal users do
+func TestBrowserSharesHandlers(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	bob := handshake(t, reg, seruser.QueueConfig{})
+	bobResults := bob.results()
+	bob.send(t, command.Register, "bob", "secret")
+	waitFor(t, bobResults, "Signed in as bob")
+	bob.send(t, command.Exit)
+	waitFor(t, bobResults, "Signed out")
+	bob.Close()
+
+	b := openBrowser(t, srv.URL)
+	defer b.Close()
+	b.send(t, command.Create, "webby")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "created"
+	})
+	text := func(rtype, text string) func(*web.Event) bool {
+		return func(ev *web.Event) bool {
+			return ev.Type == rtype && ev.Text == text
+		}
+	}
+	b.send(t, command.Msg, "bob", "see you tomorrow")
+	b.waitForEvent(t, text("success", "bob is offline, the message waits in the mailbox."))
+	b.send(t, command.Send, "ask @bob about it")
+	b.waitForEvent(t, text("notice", "bob is offline, the mention waits in the mailbox"))
+	b.send(t, command.Msg, "carol", "are you there?")
+	b.waitForEvent(t, text("failure", "message not sent: carol is offline"))
+	b.send(t, command.Msg, "webby", "hi me")
+	b.waitForEvent(t, text("failure", "message not sent: talking to yourself?"))
+	b.send(t, command.Send)
+	b.waitForEvent(t, text("failure", "message not sent: please provide a message"))
+
+	b.send(t, command.Leave)
+	b.waitForEvent(t, text("failure", "leave room: you cannot leave the lobby, use @exit to sign out"))
+	b.send(t, command.Join, "#dev")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "joined" && ev.Room == "dev"
+	})
+	b.send(t, command.Leave, "den")
+	b.waitForEvent(t, text("failure", "leave room: you are not in #den"))
+	b.send(t, command.Leave)
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "joined" && ev.Room == lobbyName
+	})
+}
+
+// TestBrowserReply tests whether a browser receives the replies of the
+// terminal users with their author, their quote and the replied-to ID
+func TestBrowserReply(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	b := openBrowser(t, srv.URL)
+	defer b.Close()
+	b.send(t, command.Create, "webby")
+	b.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "created" })
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+
+	b.send(t, command.Send, "anyone here?")
+	id := waitFor(t, aliceResults, "anyone here?").ID
+	alice.send(t, command.Reply, fmt.Sprint(id), "@webby right here")
+	ev := b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "message" && ev.From == "alice"
+	})
+	if ev.Text != "@webby right here" || ev.ReplyTo != id || ev.Quote != "webby: anyone here?" ||
+		ev.Color == nil || ev.ID == 0 || !ev.Mentioned {
+		t.Fatalf("reply: received %+v", ev)
+	}
+}
+
+// TestBrowserRole tests whether the browser that signs in to the account
+// of a moderator skips the slow mode while a guest of the same name does
+// not
+func TestBrowserRole(t *testing.T) {
+	mod, err := OpenModeration("", "olive", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, mod)
+	defer reg.Close()
+	reg.Lobby().SetSlowMode(time.Minute)
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	guest := openBrowser(t, srv.URL)
+	defer guest.Close()
+	guest.send(t, command.Create, "olive")
+	guest.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "created" })
+	guest.send(t, command.Send, "first")
+	guest.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "message" && ev.Text == "first" })
+	guest.send(t, command.Send, "second")
+	guest.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "failure" && ev.Text == "slow mode: wait 1m0s before talking again"
+	})
+	guest.send(t, command.Exit)
+	guest.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "exit" })
+
+	olive := openBrowser(t, srv.URL)
+	defer olive.Close()
+	olive.send(t, command.Register, "olive", "secret")
+	olive.waitForEvent(t, func(ev *web.Event) bool { return ev.Type == "created" })
+	for _, line := range []string{"third", "fourth"} {
+		olive.send(t, command.Send, line)
+		olive.waitForEvent(t, func(ev *web.Event) bool {
+			if ev.Type == "failure" {
+				t.Fatalf("%s: %s", line, ev.Text)
+			}
+			return ev.Type == "message" && ev.Text == line
+		})
+	}
+}
+
+// TestBrowserMailbox tests whether the messages that waited for a user
+// are delivered when the user logs in from the browser
+func TestBrowserMailbox(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	bob := handshake(t, reg, seruser.QueueConfig{})
+	bobResults := bob.results()
+	bob.send(t, command.Register, "bob", "secret")
+	waitFor(t, bobResults, "Signed in as bob")
+	bob.send(t, command.Exit)
+	waitFor(t, bobResults, "Signed out")
+	bob.Close()
+
+	alice := connect(t, reg, seruser.QueueConfig{}, "alice")
+	defer alice.Close()
+	aliceResults := alice.results()
+	waitFor(t, aliceResults, "Name registering")
+	alice.send(t, command.Msg, "bob", "see you tomorrow")
+	waitFor(t, aliceResults, "the message waits in the mailbox")
+	alice.send(t, command.Send, "ask @bob about it")
+	waitFor(t, aliceResults, "the mention waits in the mailbox")
+
+	b := openBrowser(t, srv.URL)
+	defer b.Close()
+	b.send(t, command.Login, "bob", "secret")
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "created" && ev.From == "bob"
+	})
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "success" && ev.Text == "2 messages waited for you:"
+	})
+	ev := b.waitForEvent(t, func(ev *web.Event) bool {
+		return strings.Contains(ev.Text, "see you tomorrow")
+	})
+	if ev.From != "alice" || ev.ID == 0 || ev.Mentioned {
+		t.Fatalf("mailbox: unexpected whisper %+v", ev)
+	}
+	ev = b.waitForEvent(t, func(ev *web.Event) bool {
+		return strings.Contains(ev.Text, "ask @bob")
+	})
+	if ev.From != "alice" || !ev.Mentioned {
+		t.Fatalf("mailbox: unexpected mention %+v", ev)
+	}
+	b.waitForEvent(t, func(ev *web.Event) bool {
+		return ev.Type == "success" && ev.Text == "End of mailbox."
+	})
+}
+
+// TestCrossOrigin tests whether the WebSocket endpoint refuses the pages
+// of other sites
+func TestCrossOrigin(t *testing.T) {
+	reg := NewRegistry(DefaultUserLimit, HistoryConfig{}, nil, nil)
+	defer reg.Close()
+	srv := httptest.NewServer(web.Handler(reg, nil))
+	defer srv.Close()
+
+	for origin, status := range map[string]int{
+		"http://evil.example": http.StatusForbidden,
+		srv.URL:               http.StatusSwitchingProtocols,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Origin", origin)
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("origin %s: %s", origin, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Errorf("origin %s: expected status %d, received %d", origin, status, res.StatusCode)
+		}
+	}
+}